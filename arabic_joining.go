@@ -0,0 +1,89 @@
+package nxpdf
+
+import (
+	"unicode"
+)
+
+//joining type of arabic character https://www.unicode.org/versions/latest/ch09.pdf
+const (
+	joiningTypeNone        = iota //U
+	joiningTypeRight              //R, join with character before it
+	joiningTypeDual               //D, join with character before and after it
+	joiningTypeCausing            //C (tatweel, zwj)
+	joiningTypeTransparent        //T (marks)
+)
+
+//arabicRightJoining arabic letters that join with character before it only (ex. alef, dal, reh, waw)
+var arabicRightJoining = []rune{
+	0x0622, 0x0623, 0x0624, 0x0625, 0x0627, 0x0629, 0x062F, 0x0630, 0x0631, 0x0632, 0x0648,
+	0x0671, 0x0672, 0x0673, 0x0675, 0x0676, 0x0677,
+	0x0688, 0x0689, 0x068A, 0x068B, 0x068C, 0x068D, 0x068E, 0x068F, 0x0690, 0x0691, 0x0692,
+	0x0693, 0x0694, 0x0695, 0x0696, 0x0697, 0x0698, 0x0699,
+	0x06C0, 0x06C3, 0x06C4, 0x06C5, 0x06C6, 0x06C7, 0x06C8, 0x06C9, 0x06CA, 0x06CB, 0x06CD,
+	0x06CF, 0x06D2, 0x06D3, 0x06D5, 0x06EE, 0x06EF,
+}
+
+//arabicJoiningType joining type of r (letters in arabic block that are not right joining and not hamza are dual joining)
+func arabicJoiningType(r rune) int {
+	if r == 0x0640 || r == 0x200D {
+		return joiningTypeCausing
+	}
+	if unicode.In(r, unicode.Mn, unicode.Me) {
+		return joiningTypeTransparent
+	}
+	if r < 0x0620 || r > 0x06FF || !unicode.IsLetter(r) {
+		return joiningTypeNone
+	}
+	for _, right := range arabicRightJoining {
+		if r == right {
+			return joiningTypeRight
+		}
+	}
+	switch {
+	case r == 0x0621, r == 0x0674, r >= 0x06D5 && r <= 0x06F9, r == 0x06FD, r == 0x06FE:
+		return joiningTypeNone
+	}
+	return joiningTypeDual
+}
+
+//arabicJoiningForms GSUB feature (isol, init, medi, fina) of each rune, empty if rune does not join,
+//runes should be whole paragraph (before it is split into lines and runs) so letters join across runs
+func arabicJoiningForms(runes []rune) []string {
+
+	types := make([]int, len(runes))
+	for i, r := range runes {
+		types[i] = arabicJoiningType(r)
+	}
+
+	//index of character before and after i (transparent characters are skipped)
+	neighbor := func(i int, step int) int {
+		for j := i + step; j >= 0 && j < len(runes); j += step {
+			if types[j] != joiningTypeTransparent {
+				return j
+			}
+		}
+		return -1
+	}
+
+	forms := make([]string, len(runes))
+	for i, t := range types {
+		if t != joiningTypeRight && t != joiningTypeDual {
+			continue
+		}
+		prev, next := neighbor(i, -1), neighbor(i, 1)
+		joinPrev := prev >= 0 && (types[prev] == joiningTypeDual || types[prev] == joiningTypeCausing)
+		joinNext := t == joiningTypeDual && next >= 0 &&
+			(types[next] == joiningTypeRight || types[next] == joiningTypeDual || types[next] == joiningTypeCausing)
+		switch {
+		case joinPrev && joinNext:
+			forms[i] = "medi"
+		case joinPrev:
+			forms[i] = "fina"
+		case joinNext:
+			forms[i] = "init"
+		default:
+			forms[i] = "isol"
+		}
+	}
+	return forms
+}
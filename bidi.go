@@ -0,0 +1,315 @@
+package nxpdf
+
+import (
+	"sort"
+)
+
+//bidiType bidi class of character (explicit formatting characters are BN, they are not supported)
+//https://www.unicode.org/reports/tr9/#Bidirectional_Character_Types
+type bidiType int
+
+//bidi class
+const (
+	bidiL   bidiType = iota //left-to-right
+	bidiR                   //right-to-left
+	bidiAL                  //arabic letter
+	bidiEN                  //european number
+	bidiES                  //european separator
+	bidiET                  //european number terminator
+	bidiAN                  //arabic number
+	bidiCS                  //common number separator
+	bidiNSM                 //nonspacing mark
+	bidiBN                  //boundary neutral
+	bidiB                   //paragraph separator
+	bidiS                   //segment separator
+	bidiWS                  //whitespace
+	bidiON                  //other neutrals
+)
+
+//bidiRun text that has same embedding level
+type bidiRun struct {
+	text  string
+	level int //embedding level, odd level is right-to-left
+}
+
+//isRTLParagraph direction of paragraph from first strong character (rule P2 and P3 of unicode bidi algorithm)
+func isRTLParagraph(text string) bool {
+	for _, r := range text {
+		switch bidiClass(r) {
+		case bidiL:
+			return false
+		case bidiR, bidiAL:
+			return true
+		}
+	}
+	return false
+}
+
+//splitBidiRuns split a line of paragraph into runs in logical order by rule W1-W7, N1-N2, I1-I2 and L1
+//of unicode bidi algorithm (explicit embeddings, isolates and bracket pairs are not supported)
+func splitBidiRuns(text string, rtl bool) []bidiRun {
+
+	runes := []rune(text)
+	if len(runes) == 0 {
+		return nil
+	}
+
+	paragraphLevel := 0
+	sos := bidiL //type of start and end of sequence
+	if rtl {
+		paragraphLevel = 1
+		sos = bidiR
+	}
+
+	classes := make([]bidiType, len(runes))
+	for i, r := range runes {
+		classes[i] = bidiClass(r)
+	}
+
+	//W1: nsm get type of previous character
+	for i, class := range classes {
+		if class == bidiNSM {
+			if i == 0 {
+				classes[i] = sos
+			} else {
+				classes[i] = classes[i-1]
+			}
+		}
+	}
+
+	//W2: european number after arabic letter is arabic number, W3: arabic letter is R
+	lastStrong := sos
+	for i, class := range classes {
+		switch class {
+		case bidiL, bidiR, bidiAL:
+			lastStrong = class
+		case bidiEN:
+			if lastStrong == bidiAL {
+				classes[i] = bidiAN
+			}
+		}
+	}
+	for i, class := range classes {
+		if class == bidiAL {
+			classes[i] = bidiR
+		}
+	}
+
+	//W4: single separator between numbers
+	for i := 1; i < len(classes)-1; i++ {
+		prev, next := classes[i-1], classes[i+1]
+		if classes[i] == bidiES && prev == bidiEN && next == bidiEN {
+			classes[i] = bidiEN
+		} else if classes[i] == bidiCS && prev == next && (prev == bidiEN || prev == bidiAN) {
+			classes[i] = prev
+		}
+	}
+
+	//W5: terminators next to european number
+	for i := 0; i < len(classes); i++ {
+		if classes[i] != bidiET {
+			continue
+		}
+		j := i
+		for j < len(classes) && classes[j] == bidiET {
+			j++
+		}
+		if (i > 0 && classes[i-1] == bidiEN) || (j < len(classes) && classes[j] == bidiEN) {
+			for k := i; k < j; k++ {
+				classes[k] = bidiEN
+			}
+		}
+		i = j - 1
+	}
+
+	//W6: other separators and terminators are neutral
+	for i, class := range classes {
+		if class == bidiES || class == bidiET || class == bidiCS {
+			classes[i] = bidiON
+		}
+	}
+
+	//W7: european number after L is L
+	lastStrong = sos
+	for i, class := range classes {
+		switch class {
+		case bidiL, bidiR:
+			lastStrong = class
+		case bidiEN:
+			if lastStrong == bidiL {
+				classes[i] = bidiL
+			}
+		}
+	}
+
+	//N1, N2: neutrals get direction of surrounding strong characters (numbers are R) or embedding direction
+	for i := 0; i < len(classes); i++ {
+		if !isBidiNeutral(classes[i]) {
+			continue
+		}
+		j := i
+		for j < len(classes) && isBidiNeutral(classes[j]) {
+			j++
+		}
+		before, after := sos, sos
+		if i > 0 {
+			before = strongDirection(classes[i-1])
+		}
+		if j < len(classes) {
+			after = strongDirection(classes[j])
+		}
+		direction := sos
+		if before == after {
+			direction = before
+		}
+		for k := i; k < j; k++ {
+			classes[k] = direction
+		}
+		i = j - 1
+	}
+
+	//I1, I2: resolve levels
+	levels := make([]int, len(runes))
+	for i, class := range classes {
+		levels[i] = paragraphLevel
+		if paragraphLevel%2 == 0 {
+			if class == bidiR {
+				levels[i]++
+			} else if class == bidiAN || class == bidiEN {
+				levels[i] += 2
+			}
+		} else if class == bidiL || class == bidiEN || class == bidiAN {
+			levels[i]++
+		}
+	}
+
+	//L1: whitespaces at end of line and before separators get paragraph level
+	isTrailing := true
+	for i := len(runes) - 1; i >= 0; i-- {
+		class := bidiClass(runes[i])
+		if class == bidiS || class == bidiB {
+			levels[i] = paragraphLevel
+			isTrailing = true
+		} else if isTrailing && (class == bidiWS || class == bidiBN) {
+			levels[i] = paragraphLevel
+		} else {
+			isTrailing = false
+		}
+	}
+
+	var runs []bidiRun
+	start := 0
+	for i := 1; i <= len(runes); i++ {
+		if i == len(runes) || levels[i] != levels[start] {
+			runs = append(runs, bidiRun{text: string(runes[start:i]), level: levels[start]})
+			start = i
+		}
+	}
+	return runs
+}
+
+//reorderRuns reorder runs of line from logical order to visual order (rule L2 of unicode bidi algorithm)
+func reorderRuns(runs []textRun) []textRun {
+	levels := make([]int, len(runs))
+	for i, run := range runs {
+		levels[i] = run.level
+	}
+	results := make([]textRun, len(runs))
+	for i, index := range visualOrder(levels) {
+		results[i] = runs[index]
+	}
+	return results
+}
+
+//visualOrder indexes of items of line (in logical order) in visual order by their embedding levels
+//(rule L2 of unicode bidi algorithm)
+func visualOrder(levels []int) []int {
+
+	indexes := make([]int, len(levels))
+	for i := range indexes {
+		indexes[i] = i
+	}
+
+	maxLevel, minOddLevel := 0, -1
+	for _, level := range levels {
+		if level > maxLevel {
+			maxLevel = level
+		}
+		if level%2 == 1 && (minOddLevel < 0 || level < minOddLevel) {
+			minOddLevel = level
+		}
+	}
+	if minOddLevel < 0 {
+		return indexes
+	}
+
+	for level := maxLevel; level >= minOddLevel; level-- {
+		for i := 0; i < len(indexes); i++ {
+			if levels[indexes[i]] < level {
+				continue
+			}
+			j := i
+			for j < len(indexes) && levels[indexes[j]] >= level {
+				j++
+			}
+			for a, b := i, j-1; a < b; a, b = a+1, b-1 {
+				indexes[a], indexes[b] = indexes[b], indexes[a]
+			}
+			i = j - 1
+		}
+	}
+	return indexes
+}
+
+//bidiRange characters from first to last that have same bidi class
+type bidiRange struct {
+	first, last rune
+	class       bidiType
+}
+
+//go:generate go run bidi_table_gen.go
+
+//bidiClass bidi class of r from bidiRanges (characters that are not in bidiRanges are L)
+func bidiClass(r rune) bidiType {
+	i := sort.Search(len(bidiRanges), func(i int) bool { return bidiRanges[i].last >= r })
+	if i < len(bidiRanges) && bidiRanges[i].first <= r {
+		return bidiRanges[i].class
+	}
+	return bidiL
+}
+
+func isBidiNeutral(class bidiType) bool {
+	return class == bidiB || class == bidiS || class == bidiWS || class == bidiON || class == bidiBN
+}
+
+//strongDirection direction of class for rule N1 (numbers are R)
+func strongDirection(class bidiType) bidiType {
+	if class == bidiL {
+		return bidiL
+	}
+	return bidiR
+}
+
+//mirroredPairs characters that are mirrored in right-to-left text and are not paired brackets (see bracketPairs),
+//other characters of Bidi_Mirroring_Glyph (mostly mathematical operators) are not supported
+var mirroredPairs = [][2]rune{
+	{'<', '>'}, {'«', '»'}, {'‹', '›'},
+	{0x2208, 0x220B}, {0x2209, 0x220C}, {0x220A, 0x220D}, {0x2264, 0x2265}, {0x2266, 0x2267},
+	{0x226A, 0x226B}, {0x226E, 0x226F}, {0x2270, 0x2271}, {0x2272, 0x2273}, {0x227A, 0x227B},
+	{0x2282, 0x2283}, {0x2284, 0x2285}, {0x2286, 0x2287}, {0x2288, 0x2289}, {0x228A, 0x228B},
+	{0xFE64, 0xFE65}, {0xFF1C, 0xFF1E},
+}
+
+//mirrorRune mirrored character of right-to-left text (rule L4 of unicode bidi algorithm)
+func mirrorRune(r rune) rune {
+	for _, pairs := range [][][2]rune{bracketPairs, mirroredPairs} {
+		for _, pair := range pairs {
+			if r == pair[0] {
+				return pair[1]
+			} else if r == pair[1] {
+				return pair[0]
+			}
+		}
+	}
+	return r
+}
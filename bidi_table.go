@@ -0,0 +1,793 @@
+// Code generated by bidi_table_gen.go; DO NOT EDIT.
+
+package nxpdf
+
+//bidiUnicodeVersion version of unicode data of bidiRanges and bracketPairs
+const bidiUnicodeVersion = "15.0.0"
+
+//bidiRanges sorted ranges of characters that bidi class is not L
+var bidiRanges = []bidiRange{
+	{0x0000, 0x0008, bidiBN},
+	{0x0009, 0x0009, bidiS},
+	{0x000A, 0x000A, bidiB},
+	{0x000B, 0x000B, bidiS},
+	{0x000C, 0x000C, bidiWS},
+	{0x000D, 0x000D, bidiB},
+	{0x000E, 0x001B, bidiBN},
+	{0x001C, 0x001E, bidiB},
+	{0x001F, 0x001F, bidiS},
+	{0x0020, 0x0020, bidiWS},
+	{0x0021, 0x0022, bidiON},
+	{0x0023, 0x0025, bidiET},
+	{0x0026, 0x002A, bidiON},
+	{0x002B, 0x002B, bidiES},
+	{0x002C, 0x002C, bidiCS},
+	{0x002D, 0x002D, bidiES},
+	{0x002E, 0x002F, bidiCS},
+	{0x0030, 0x0039, bidiEN},
+	{0x003A, 0x003A, bidiCS},
+	{0x003B, 0x0040, bidiON},
+	{0x005B, 0x0060, bidiON},
+	{0x007B, 0x007E, bidiON},
+	{0x007F, 0x0084, bidiBN},
+	{0x0085, 0x0085, bidiB},
+	{0x0086, 0x009F, bidiBN},
+	{0x00A0, 0x00A0, bidiCS},
+	{0x00A1, 0x00A1, bidiON},
+	{0x00A2, 0x00A5, bidiET},
+	{0x00A6, 0x00A9, bidiON},
+	{0x00AB, 0x00AC, bidiON},
+	{0x00AD, 0x00AD, bidiBN},
+	{0x00AE, 0x00AF, bidiON},
+	{0x00B0, 0x00B1, bidiET},
+	{0x00B2, 0x00B3, bidiEN},
+	{0x00B4, 0x00B4, bidiON},
+	{0x00B6, 0x00B8, bidiON},
+	{0x00B9, 0x00B9, bidiEN},
+	{0x00BB, 0x00BF, bidiON},
+	{0x00D7, 0x00D7, bidiON},
+	{0x00F7, 0x00F7, bidiON},
+	{0x02B9, 0x02BA, bidiON},
+	{0x02C2, 0x02CF, bidiON},
+	{0x02D2, 0x02DF, bidiON},
+	{0x02E5, 0x02ED, bidiON},
+	{0x02EF, 0x02FF, bidiON},
+	{0x0300, 0x036F, bidiNSM},
+	{0x0374, 0x0375, bidiON},
+	{0x037E, 0x037E, bidiON},
+	{0x0384, 0x0385, bidiON},
+	{0x0387, 0x0387, bidiON},
+	{0x03F6, 0x03F6, bidiON},
+	{0x0483, 0x0489, bidiNSM},
+	{0x058A, 0x058A, bidiON},
+	{0x058D, 0x058E, bidiON},
+	{0x058F, 0x058F, bidiET},
+	{0x0590, 0x0590, bidiR},
+	{0x0591, 0x05BD, bidiNSM},
+	{0x05BE, 0x05BE, bidiR},
+	{0x05BF, 0x05BF, bidiNSM},
+	{0x05C0, 0x05C0, bidiR},
+	{0x05C1, 0x05C2, bidiNSM},
+	{0x05C3, 0x05C3, bidiR},
+	{0x05C4, 0x05C5, bidiNSM},
+	{0x05C6, 0x05C6, bidiR},
+	{0x05C7, 0x05C7, bidiNSM},
+	{0x05C8, 0x05FF, bidiR},
+	{0x0600, 0x0605, bidiAN},
+	{0x0606, 0x0607, bidiON},
+	{0x0608, 0x0608, bidiAL},
+	{0x0609, 0x060A, bidiET},
+	{0x060B, 0x060B, bidiAL},
+	{0x060C, 0x060C, bidiCS},
+	{0x060D, 0x060D, bidiAL},
+	{0x060E, 0x060F, bidiON},
+	{0x0610, 0x061A, bidiNSM},
+	{0x061B, 0x064A, bidiAL},
+	{0x064B, 0x065F, bidiNSM},
+	{0x0660, 0x0669, bidiAN},
+	{0x066A, 0x066A, bidiET},
+	{0x066B, 0x066C, bidiAN},
+	{0x066D, 0x066F, bidiAL},
+	{0x0670, 0x0670, bidiNSM},
+	{0x0671, 0x06D5, bidiAL},
+	{0x06D6, 0x06DC, bidiNSM},
+	{0x06DD, 0x06DD, bidiAN},
+	{0x06DE, 0x06DE, bidiON},
+	{0x06DF, 0x06E4, bidiNSM},
+	{0x06E5, 0x06E6, bidiAL},
+	{0x06E7, 0x06E8, bidiNSM},
+	{0x06E9, 0x06E9, bidiON},
+	{0x06EA, 0x06ED, bidiNSM},
+	{0x06EE, 0x06EF, bidiAL},
+	{0x06F0, 0x06F9, bidiEN},
+	{0x06FA, 0x0710, bidiAL},
+	{0x0711, 0x0711, bidiNSM},
+	{0x0712, 0x072F, bidiAL},
+	{0x0730, 0x074A, bidiNSM},
+	{0x074B, 0x07A5, bidiAL},
+	{0x07A6, 0x07B0, bidiNSM},
+	{0x07B1, 0x07BF, bidiAL},
+	{0x07C0, 0x07EA, bidiR},
+	{0x07EB, 0x07F3, bidiNSM},
+	{0x07F4, 0x07F5, bidiR},
+	{0x07F6, 0x07F9, bidiON},
+	{0x07FA, 0x07FC, bidiR},
+	{0x07FD, 0x07FD, bidiNSM},
+	{0x07FE, 0x0815, bidiR},
+	{0x0816, 0x0819, bidiNSM},
+	{0x081A, 0x081A, bidiR},
+	{0x081B, 0x0823, bidiNSM},
+	{0x0824, 0x0824, bidiR},
+	{0x0825, 0x0827, bidiNSM},
+	{0x0828, 0x0828, bidiR},
+	{0x0829, 0x082D, bidiNSM},
+	{0x082E, 0x0858, bidiR},
+	{0x0859, 0x085B, bidiNSM},
+	{0x085C, 0x085F, bidiR},
+	{0x0860, 0x086A, bidiAL},
+	{0x086B, 0x086F, bidiR},
+	{0x0870, 0x088E, bidiAL},
+	{0x088F, 0x088F, bidiR},
+	{0x0890, 0x0891, bidiAN},
+	{0x0892, 0x0897, bidiR},
+	{0x0898, 0x089F, bidiNSM},
+	{0x08A0, 0x08C9, bidiAL},
+	{0x08CA, 0x08E1, bidiNSM},
+	{0x08E2, 0x08E2, bidiAN},
+	{0x08E3, 0x0902, bidiNSM},
+	{0x093A, 0x093A, bidiNSM},
+	{0x093C, 0x093C, bidiNSM},
+	{0x0941, 0x0948, bidiNSM},
+	{0x094D, 0x094D, bidiNSM},
+	{0x0951, 0x0957, bidiNSM},
+	{0x0962, 0x0963, bidiNSM},
+	{0x0981, 0x0981, bidiNSM},
+	{0x09BC, 0x09BC, bidiNSM},
+	{0x09C1, 0x09C4, bidiNSM},
+	{0x09CD, 0x09CD, bidiNSM},
+	{0x09E2, 0x09E3, bidiNSM},
+	{0x09F2, 0x09F3, bidiET},
+	{0x09FB, 0x09FB, bidiET},
+	{0x09FE, 0x09FE, bidiNSM},
+	{0x0A01, 0x0A02, bidiNSM},
+	{0x0A3C, 0x0A3C, bidiNSM},
+	{0x0A41, 0x0A42, bidiNSM},
+	{0x0A47, 0x0A48, bidiNSM},
+	{0x0A4B, 0x0A4D, bidiNSM},
+	{0x0A51, 0x0A51, bidiNSM},
+	{0x0A70, 0x0A71, bidiNSM},
+	{0x0A75, 0x0A75, bidiNSM},
+	{0x0A81, 0x0A82, bidiNSM},
+	{0x0ABC, 0x0ABC, bidiNSM},
+	{0x0AC1, 0x0AC5, bidiNSM},
+	{0x0AC7, 0x0AC8, bidiNSM},
+	{0x0ACD, 0x0ACD, bidiNSM},
+	{0x0AE2, 0x0AE3, bidiNSM},
+	{0x0AF1, 0x0AF1, bidiET},
+	{0x0AFA, 0x0AFF, bidiNSM},
+	{0x0B01, 0x0B01, bidiNSM},
+	{0x0B3C, 0x0B3C, bidiNSM},
+	{0x0B3F, 0x0B3F, bidiNSM},
+	{0x0B41, 0x0B44, bidiNSM},
+	{0x0B4D, 0x0B4D, bidiNSM},
+	{0x0B55, 0x0B56, bidiNSM},
+	{0x0B62, 0x0B63, bidiNSM},
+	{0x0B82, 0x0B82, bidiNSM},
+	{0x0BC0, 0x0BC0, bidiNSM},
+	{0x0BCD, 0x0BCD, bidiNSM},
+	{0x0BF3, 0x0BF8, bidiON},
+	{0x0BF9, 0x0BF9, bidiET},
+	{0x0BFA, 0x0BFA, bidiON},
+	{0x0C00, 0x0C00, bidiNSM},
+	{0x0C04, 0x0C04, bidiNSM},
+	{0x0C3C, 0x0C3C, bidiNSM},
+	{0x0C3E, 0x0C40, bidiNSM},
+	{0x0C46, 0x0C48, bidiNSM},
+	{0x0C4A, 0x0C4D, bidiNSM},
+	{0x0C55, 0x0C56, bidiNSM},
+	{0x0C62, 0x0C63, bidiNSM},
+	{0x0C78, 0x0C7E, bidiON},
+	{0x0C81, 0x0C81, bidiNSM},
+	{0x0CBC, 0x0CBC, bidiNSM},
+	{0x0CCC, 0x0CCD, bidiNSM},
+	{0x0CE2, 0x0CE3, bidiNSM},
+	{0x0D00, 0x0D01, bidiNSM},
+	{0x0D3B, 0x0D3C, bidiNSM},
+	{0x0D41, 0x0D44, bidiNSM},
+	{0x0D4D, 0x0D4D, bidiNSM},
+	{0x0D62, 0x0D63, bidiNSM},
+	{0x0D81, 0x0D81, bidiNSM},
+	{0x0DCA, 0x0DCA, bidiNSM},
+	{0x0DD2, 0x0DD4, bidiNSM},
+	{0x0DD6, 0x0DD6, bidiNSM},
+	{0x0E31, 0x0E31, bidiNSM},
+	{0x0E34, 0x0E3A, bidiNSM},
+	{0x0E3F, 0x0E3F, bidiET},
+	{0x0E47, 0x0E4E, bidiNSM},
+	{0x0EB1, 0x0EB1, bidiNSM},
+	{0x0EB4, 0x0EBC, bidiNSM},
+	{0x0EC8, 0x0ECE, bidiNSM},
+	{0x0F18, 0x0F19, bidiNSM},
+	{0x0F35, 0x0F35, bidiNSM},
+	{0x0F37, 0x0F37, bidiNSM},
+	{0x0F39, 0x0F39, bidiNSM},
+	{0x0F3A, 0x0F3D, bidiON},
+	{0x0F71, 0x0F7E, bidiNSM},
+	{0x0F80, 0x0F84, bidiNSM},
+	{0x0F86, 0x0F87, bidiNSM},
+	{0x0F8D, 0x0F97, bidiNSM},
+	{0x0F99, 0x0FBC, bidiNSM},
+	{0x0FC6, 0x0FC6, bidiNSM},
+	{0x102D, 0x1030, bidiNSM},
+	{0x1032, 0x1037, bidiNSM},
+	{0x1039, 0x103A, bidiNSM},
+	{0x103D, 0x103E, bidiNSM},
+	{0x1058, 0x1059, bidiNSM},
+	{0x105E, 0x1060, bidiNSM},
+	{0x1071, 0x1074, bidiNSM},
+	{0x1082, 0x1082, bidiNSM},
+	{0x1085, 0x1086, bidiNSM},
+	{0x108D, 0x108D, bidiNSM},
+	{0x109D, 0x109D, bidiNSM},
+	{0x135D, 0x135F, bidiNSM},
+	{0x1390, 0x1399, bidiON},
+	{0x1400, 0x1400, bidiON},
+	{0x1680, 0x1680, bidiWS},
+	{0x169B, 0x169C, bidiON},
+	{0x1712, 0x1714, bidiNSM},
+	{0x1732, 0x1733, bidiNSM},
+	{0x1752, 0x1753, bidiNSM},
+	{0x1772, 0x1773, bidiNSM},
+	{0x17B4, 0x17B5, bidiNSM},
+	{0x17B7, 0x17BD, bidiNSM},
+	{0x17C6, 0x17C6, bidiNSM},
+	{0x17C9, 0x17D3, bidiNSM},
+	{0x17DB, 0x17DB, bidiET},
+	{0x17DD, 0x17DD, bidiNSM},
+	{0x17F0, 0x17F9, bidiON},
+	{0x1800, 0x180A, bidiON},
+	{0x180B, 0x180D, bidiNSM},
+	{0x180E, 0x180E, bidiBN},
+	{0x180F, 0x180F, bidiNSM},
+	{0x1885, 0x1886, bidiNSM},
+	{0x18A9, 0x18A9, bidiNSM},
+	{0x1920, 0x1922, bidiNSM},
+	{0x1927, 0x1928, bidiNSM},
+	{0x1932, 0x1932, bidiNSM},
+	{0x1939, 0x193B, bidiNSM},
+	{0x1940, 0x1940, bidiON},
+	{0x1944, 0x1945, bidiON},
+	{0x19DE, 0x19FF, bidiON},
+	{0x1A17, 0x1A18, bidiNSM},
+	{0x1A1B, 0x1A1B, bidiNSM},
+	{0x1A56, 0x1A56, bidiNSM},
+	{0x1A58, 0x1A5E, bidiNSM},
+	{0x1A60, 0x1A60, bidiNSM},
+	{0x1A62, 0x1A62, bidiNSM},
+	{0x1A65, 0x1A6C, bidiNSM},
+	{0x1A73, 0x1A7C, bidiNSM},
+	{0x1A7F, 0x1A7F, bidiNSM},
+	{0x1AB0, 0x1ACE, bidiNSM},
+	{0x1B00, 0x1B03, bidiNSM},
+	{0x1B34, 0x1B34, bidiNSM},
+	{0x1B36, 0x1B3A, bidiNSM},
+	{0x1B3C, 0x1B3C, bidiNSM},
+	{0x1B42, 0x1B42, bidiNSM},
+	{0x1B6B, 0x1B73, bidiNSM},
+	{0x1B80, 0x1B81, bidiNSM},
+	{0x1BA2, 0x1BA5, bidiNSM},
+	{0x1BA8, 0x1BA9, bidiNSM},
+	{0x1BAB, 0x1BAD, bidiNSM},
+	{0x1BE6, 0x1BE6, bidiNSM},
+	{0x1BE8, 0x1BE9, bidiNSM},
+	{0x1BED, 0x1BED, bidiNSM},
+	{0x1BEF, 0x1BF1, bidiNSM},
+	{0x1C2C, 0x1C33, bidiNSM},
+	{0x1C36, 0x1C37, bidiNSM},
+	{0x1CD0, 0x1CD2, bidiNSM},
+	{0x1CD4, 0x1CE0, bidiNSM},
+	{0x1CE2, 0x1CE8, bidiNSM},
+	{0x1CED, 0x1CED, bidiNSM},
+	{0x1CF4, 0x1CF4, bidiNSM},
+	{0x1CF8, 0x1CF9, bidiNSM},
+	{0x1DC0, 0x1DFF, bidiNSM},
+	{0x1FBD, 0x1FBD, bidiON},
+	{0x1FBF, 0x1FC1, bidiON},
+	{0x1FCD, 0x1FCF, bidiON},
+	{0x1FDD, 0x1FDF, bidiON},
+	{0x1FED, 0x1FEF, bidiON},
+	{0x1FFD, 0x1FFE, bidiON},
+	{0x2000, 0x200A, bidiWS},
+	{0x200B, 0x200D, bidiBN},
+	{0x200F, 0x200F, bidiR},
+	{0x2010, 0x2027, bidiON},
+	{0x2028, 0x2028, bidiWS},
+	{0x2029, 0x2029, bidiB},
+	{0x202A, 0x202E, bidiBN},
+	{0x202F, 0x202F, bidiCS},
+	{0x2030, 0x2034, bidiET},
+	{0x2035, 0x2043, bidiON},
+	{0x2044, 0x2044, bidiCS},
+	{0x2045, 0x205E, bidiON},
+	{0x205F, 0x205F, bidiWS},
+	{0x2060, 0x206F, bidiBN},
+	{0x2070, 0x2070, bidiEN},
+	{0x2074, 0x2079, bidiEN},
+	{0x207A, 0x207B, bidiES},
+	{0x207C, 0x207E, bidiON},
+	{0x2080, 0x2089, bidiEN},
+	{0x208A, 0x208B, bidiES},
+	{0x208C, 0x208E, bidiON},
+	{0x20A0, 0x20CF, bidiET},
+	{0x20D0, 0x20F0, bidiNSM},
+	{0x2100, 0x2101, bidiON},
+	{0x2103, 0x2106, bidiON},
+	{0x2108, 0x2109, bidiON},
+	{0x2114, 0x2114, bidiON},
+	{0x2116, 0x2118, bidiON},
+	{0x211E, 0x2123, bidiON},
+	{0x2125, 0x2125, bidiON},
+	{0x2127, 0x2127, bidiON},
+	{0x2129, 0x2129, bidiON},
+	{0x212E, 0x212E, bidiET},
+	{0x213A, 0x213B, bidiON},
+	{0x2140, 0x2144, bidiON},
+	{0x214A, 0x214D, bidiON},
+	{0x2150, 0x215F, bidiON},
+	{0x2189, 0x218B, bidiON},
+	{0x2190, 0x2211, bidiON},
+	{0x2212, 0x2212, bidiES},
+	{0x2213, 0x2213, bidiET},
+	{0x2214, 0x2335, bidiON},
+	{0x237B, 0x2394, bidiON},
+	{0x2396, 0x2426, bidiON},
+	{0x2440, 0x244A, bidiON},
+	{0x2460, 0x2487, bidiON},
+	{0x2488, 0x249B, bidiEN},
+	{0x24EA, 0x26AB, bidiON},
+	{0x26AD, 0x27FF, bidiON},
+	{0x2900, 0x2B73, bidiON},
+	{0x2B76, 0x2B95, bidiON},
+	{0x2B97, 0x2BFF, bidiON},
+	{0x2CE5, 0x2CEA, bidiON},
+	{0x2CEF, 0x2CF1, bidiNSM},
+	{0x2CF9, 0x2CFF, bidiON},
+	{0x2D7F, 0x2D7F, bidiNSM},
+	{0x2DE0, 0x2DFF, bidiNSM},
+	{0x2E00, 0x2E5D, bidiON},
+	{0x2E80, 0x2E99, bidiON},
+	{0x2E9B, 0x2EF3, bidiON},
+	{0x2F00, 0x2FD5, bidiON},
+	{0x2FF0, 0x2FFB, bidiON},
+	{0x3000, 0x3000, bidiWS},
+	{0x3001, 0x3004, bidiON},
+	{0x3008, 0x3020, bidiON},
+	{0x302A, 0x302D, bidiNSM},
+	{0x3030, 0x3030, bidiON},
+	{0x3036, 0x3037, bidiON},
+	{0x303D, 0x303F, bidiON},
+	{0x3099, 0x309A, bidiNSM},
+	{0x309B, 0x309C, bidiON},
+	{0x30A0, 0x30A0, bidiON},
+	{0x30FB, 0x30FB, bidiON},
+	{0x31C0, 0x31E3, bidiON},
+	{0x321D, 0x321E, bidiON},
+	{0x3250, 0x325F, bidiON},
+	{0x327C, 0x327E, bidiON},
+	{0x32B1, 0x32BF, bidiON},
+	{0x32CC, 0x32CF, bidiON},
+	{0x3377, 0x337A, bidiON},
+	{0x33DE, 0x33DF, bidiON},
+	{0x33FF, 0x33FF, bidiON},
+	{0x4DC0, 0x4DFF, bidiON},
+	{0xA490, 0xA4C6, bidiON},
+	{0xA60D, 0xA60F, bidiON},
+	{0xA66F, 0xA672, bidiNSM},
+	{0xA673, 0xA673, bidiON},
+	{0xA674, 0xA67D, bidiNSM},
+	{0xA67E, 0xA67F, bidiON},
+	{0xA69E, 0xA69F, bidiNSM},
+	{0xA6F0, 0xA6F1, bidiNSM},
+	{0xA700, 0xA721, bidiON},
+	{0xA788, 0xA788, bidiON},
+	{0xA802, 0xA802, bidiNSM},
+	{0xA806, 0xA806, bidiNSM},
+	{0xA80B, 0xA80B, bidiNSM},
+	{0xA825, 0xA826, bidiNSM},
+	{0xA828, 0xA82B, bidiON},
+	{0xA82C, 0xA82C, bidiNSM},
+	{0xA838, 0xA839, bidiET},
+	{0xA874, 0xA877, bidiON},
+	{0xA8C4, 0xA8C5, bidiNSM},
+	{0xA8E0, 0xA8F1, bidiNSM},
+	{0xA8FF, 0xA8FF, bidiNSM},
+	{0xA926, 0xA92D, bidiNSM},
+	{0xA947, 0xA951, bidiNSM},
+	{0xA980, 0xA982, bidiNSM},
+	{0xA9B3, 0xA9B3, bidiNSM},
+	{0xA9B6, 0xA9B9, bidiNSM},
+	{0xA9BC, 0xA9BD, bidiNSM},
+	{0xA9E5, 0xA9E5, bidiNSM},
+	{0xAA29, 0xAA2E, bidiNSM},
+	{0xAA31, 0xAA32, bidiNSM},
+	{0xAA35, 0xAA36, bidiNSM},
+	{0xAA43, 0xAA43, bidiNSM},
+	{0xAA4C, 0xAA4C, bidiNSM},
+	{0xAA7C, 0xAA7C, bidiNSM},
+	{0xAAB0, 0xAAB0, bidiNSM},
+	{0xAAB2, 0xAAB4, bidiNSM},
+	{0xAAB7, 0xAAB8, bidiNSM},
+	{0xAABE, 0xAABF, bidiNSM},
+	{0xAAC1, 0xAAC1, bidiNSM},
+	{0xAAEC, 0xAAED, bidiNSM},
+	{0xAAF6, 0xAAF6, bidiNSM},
+	{0xAB6A, 0xAB6B, bidiON},
+	{0xABE5, 0xABE5, bidiNSM},
+	{0xABE8, 0xABE8, bidiNSM},
+	{0xABED, 0xABED, bidiNSM},
+	{0xD800, 0xDFFF, bidiON},
+	{0xFB1D, 0xFB1D, bidiR},
+	{0xFB1E, 0xFB1E, bidiNSM},
+	{0xFB1F, 0xFB28, bidiR},
+	{0xFB29, 0xFB29, bidiES},
+	{0xFB2A, 0xFB4F, bidiR},
+	{0xFB50, 0xFD3D, bidiAL},
+	{0xFD3E, 0xFD4F, bidiON},
+	{0xFD50, 0xFDCE, bidiAL},
+	{0xFDCF, 0xFDCF, bidiON},
+	{0xFDD0, 0xFDEF, bidiBN},
+	{0xFDF0, 0xFDFC, bidiAL},
+	{0xFDFD, 0xFDFF, bidiON},
+	{0xFE00, 0xFE0F, bidiNSM},
+	{0xFE10, 0xFE19, bidiON},
+	{0xFE20, 0xFE2F, bidiNSM},
+	{0xFE30, 0xFE4F, bidiON},
+	{0xFE50, 0xFE50, bidiCS},
+	{0xFE51, 0xFE51, bidiON},
+	{0xFE52, 0xFE52, bidiCS},
+	{0xFE54, 0xFE54, bidiON},
+	{0xFE55, 0xFE55, bidiCS},
+	{0xFE56, 0xFE5E, bidiON},
+	{0xFE5F, 0xFE5F, bidiET},
+	{0xFE60, 0xFE61, bidiON},
+	{0xFE62, 0xFE63, bidiES},
+	{0xFE64, 0xFE66, bidiON},
+	{0xFE68, 0xFE68, bidiON},
+	{0xFE69, 0xFE6A, bidiET},
+	{0xFE6B, 0xFE6B, bidiON},
+	{0xFE70, 0xFEFE, bidiAL},
+	{0xFEFF, 0xFEFF, bidiBN},
+	{0xFF01, 0xFF02, bidiON},
+	{0xFF03, 0xFF05, bidiET},
+	{0xFF06, 0xFF0A, bidiON},
+	{0xFF0B, 0xFF0B, bidiES},
+	{0xFF0C, 0xFF0C, bidiCS},
+	{0xFF0D, 0xFF0D, bidiES},
+	{0xFF0E, 0xFF0F, bidiCS},
+	{0xFF10, 0xFF19, bidiEN},
+	{0xFF1A, 0xFF1A, bidiCS},
+	{0xFF1B, 0xFF20, bidiON},
+	{0xFF3B, 0xFF40, bidiON},
+	{0xFF5B, 0xFF65, bidiON},
+	{0xFFE0, 0xFFE1, bidiET},
+	{0xFFE2, 0xFFE4, bidiON},
+	{0xFFE5, 0xFFE6, bidiET},
+	{0xFFE8, 0xFFEE, bidiON},
+	{0xFFF0, 0xFFF8, bidiBN},
+	{0xFFF9, 0xFFFD, bidiON},
+	{0xFFFE, 0xFFFF, bidiBN},
+	{0x10101, 0x10101, bidiON},
+	{0x10140, 0x1018C, bidiON},
+	{0x10190, 0x1019C, bidiON},
+	{0x101A0, 0x101A0, bidiON},
+	{0x101FD, 0x101FD, bidiNSM},
+	{0x102E0, 0x102E0, bidiNSM},
+	{0x102E1, 0x102FB, bidiEN},
+	{0x10376, 0x1037A, bidiNSM},
+	{0x10800, 0x1091E, bidiR},
+	{0x1091F, 0x1091F, bidiON},
+	{0x10920, 0x10A00, bidiR},
+	{0x10A01, 0x10A03, bidiNSM},
+	{0x10A04, 0x10A04, bidiR},
+	{0x10A05, 0x10A06, bidiNSM},
+	{0x10A07, 0x10A0B, bidiR},
+	{0x10A0C, 0x10A0F, bidiNSM},
+	{0x10A10, 0x10A37, bidiR},
+	{0x10A38, 0x10A3A, bidiNSM},
+	{0x10A3B, 0x10A3E, bidiR},
+	{0x10A3F, 0x10A3F, bidiNSM},
+	{0x10A40, 0x10AE4, bidiR},
+	{0x10AE5, 0x10AE6, bidiNSM},
+	{0x10AE7, 0x10B38, bidiR},
+	{0x10B39, 0x10B3F, bidiON},
+	{0x10B40, 0x10CFF, bidiR},
+	{0x10D00, 0x10D23, bidiAL},
+	{0x10D24, 0x10D27, bidiNSM},
+	{0x10D28, 0x10D2F, bidiR},
+	{0x10D30, 0x10D39, bidiAN},
+	{0x10D3A, 0x10E5F, bidiR},
+	{0x10E60, 0x10E7E, bidiAN},
+	{0x10E7F, 0x10EAA, bidiR},
+	{0x10EAB, 0x10EAC, bidiNSM},
+	{0x10EAD, 0x10EFC, bidiR},
+	{0x10EFD, 0x10EFF, bidiNSM},
+	{0x10F00, 0x10F2F, bidiR},
+	{0x10F30, 0x10F45, bidiAL},
+	{0x10F46, 0x10F50, bidiNSM},
+	{0x10F51, 0x10F59, bidiAL},
+	{0x10F5A, 0x10F81, bidiR},
+	{0x10F82, 0x10F85, bidiNSM},
+	{0x10F86, 0x10FFF, bidiR},
+	{0x11001, 0x11001, bidiNSM},
+	{0x11038, 0x11046, bidiNSM},
+	{0x11052, 0x11065, bidiON},
+	{0x11070, 0x11070, bidiNSM},
+	{0x11073, 0x11074, bidiNSM},
+	{0x1107F, 0x11081, bidiNSM},
+	{0x110B3, 0x110B6, bidiNSM},
+	{0x110B9, 0x110BA, bidiNSM},
+	{0x110C2, 0x110C2, bidiNSM},
+	{0x11100, 0x11102, bidiNSM},
+	{0x11127, 0x1112B, bidiNSM},
+	{0x1112D, 0x11134, bidiNSM},
+	{0x11173, 0x11173, bidiNSM},
+	{0x11180, 0x11181, bidiNSM},
+	{0x111B6, 0x111BE, bidiNSM},
+	{0x111C9, 0x111CC, bidiNSM},
+	{0x111CF, 0x111CF, bidiNSM},
+	{0x1122F, 0x11231, bidiNSM},
+	{0x11234, 0x11234, bidiNSM},
+	{0x11236, 0x11237, bidiNSM},
+	{0x1123E, 0x1123E, bidiNSM},
+	{0x11241, 0x11241, bidiNSM},
+	{0x112DF, 0x112DF, bidiNSM},
+	{0x112E3, 0x112EA, bidiNSM},
+	{0x11300, 0x11301, bidiNSM},
+	{0x1133B, 0x1133C, bidiNSM},
+	{0x11340, 0x11340, bidiNSM},
+	{0x11366, 0x1136C, bidiNSM},
+	{0x11370, 0x11374, bidiNSM},
+	{0x11438, 0x1143F, bidiNSM},
+	{0x11442, 0x11444, bidiNSM},
+	{0x11446, 0x11446, bidiNSM},
+	{0x1145E, 0x1145E, bidiNSM},
+	{0x114B3, 0x114B8, bidiNSM},
+	{0x114BA, 0x114BA, bidiNSM},
+	{0x114BF, 0x114C0, bidiNSM},
+	{0x114C2, 0x114C3, bidiNSM},
+	{0x115B2, 0x115B5, bidiNSM},
+	{0x115BC, 0x115BD, bidiNSM},
+	{0x115BF, 0x115C0, bidiNSM},
+	{0x115DC, 0x115DD, bidiNSM},
+	{0x11633, 0x1163A, bidiNSM},
+	{0x1163D, 0x1163D, bidiNSM},
+	{0x1163F, 0x11640, bidiNSM},
+	{0x11660, 0x1166C, bidiON},
+	{0x116AB, 0x116AB, bidiNSM},
+	{0x116AD, 0x116AD, bidiNSM},
+	{0x116B0, 0x116B5, bidiNSM},
+	{0x116B7, 0x116B7, bidiNSM},
+	{0x1171D, 0x1171F, bidiNSM},
+	{0x11722, 0x11725, bidiNSM},
+	{0x11727, 0x1172B, bidiNSM},
+	{0x1182F, 0x11837, bidiNSM},
+	{0x11839, 0x1183A, bidiNSM},
+	{0x1193B, 0x1193C, bidiNSM},
+	{0x1193E, 0x1193E, bidiNSM},
+	{0x11943, 0x11943, bidiNSM},
+	{0x119D4, 0x119D7, bidiNSM},
+	{0x119DA, 0x119DB, bidiNSM},
+	{0x119E0, 0x119E0, bidiNSM},
+	{0x11A01, 0x11A06, bidiNSM},
+	{0x11A09, 0x11A0A, bidiNSM},
+	{0x11A33, 0x11A38, bidiNSM},
+	{0x11A3B, 0x11A3E, bidiNSM},
+	{0x11A47, 0x11A47, bidiNSM},
+	{0x11A51, 0x11A56, bidiNSM},
+	{0x11A59, 0x11A5B, bidiNSM},
+	{0x11A8A, 0x11A96, bidiNSM},
+	{0x11A98, 0x11A99, bidiNSM},
+	{0x11C30, 0x11C36, bidiNSM},
+	{0x11C38, 0x11C3D, bidiNSM},
+	{0x11C92, 0x11CA7, bidiNSM},
+	{0x11CAA, 0x11CB0, bidiNSM},
+	{0x11CB2, 0x11CB3, bidiNSM},
+	{0x11CB5, 0x11CB6, bidiNSM},
+	{0x11D31, 0x11D36, bidiNSM},
+	{0x11D3A, 0x11D3A, bidiNSM},
+	{0x11D3C, 0x11D3D, bidiNSM},
+	{0x11D3F, 0x11D45, bidiNSM},
+	{0x11D47, 0x11D47, bidiNSM},
+	{0x11D90, 0x11D91, bidiNSM},
+	{0x11D95, 0x11D95, bidiNSM},
+	{0x11D97, 0x11D97, bidiNSM},
+	{0x11EF3, 0x11EF4, bidiNSM},
+	{0x11F00, 0x11F01, bidiNSM},
+	{0x11F36, 0x11F3A, bidiNSM},
+	{0x11F40, 0x11F40, bidiNSM},
+	{0x11F42, 0x11F42, bidiNSM},
+	{0x11FD5, 0x11FDC, bidiON},
+	{0x11FDD, 0x11FE0, bidiET},
+	{0x11FE1, 0x11FF1, bidiON},
+	{0x13440, 0x13440, bidiNSM},
+	{0x13447, 0x13455, bidiNSM},
+	{0x16AF0, 0x16AF4, bidiNSM},
+	{0x16B30, 0x16B36, bidiNSM},
+	{0x16F4F, 0x16F4F, bidiNSM},
+	{0x16F8F, 0x16F92, bidiNSM},
+	{0x16FE2, 0x16FE2, bidiON},
+	{0x16FE4, 0x16FE4, bidiNSM},
+	{0x1BC9D, 0x1BC9E, bidiNSM},
+	{0x1BCA0, 0x1BCA3, bidiBN},
+	{0x1CF00, 0x1CF2D, bidiNSM},
+	{0x1CF30, 0x1CF46, bidiNSM},
+	{0x1D167, 0x1D169, bidiNSM},
+	{0x1D173, 0x1D17A, bidiBN},
+	{0x1D17B, 0x1D182, bidiNSM},
+	{0x1D185, 0x1D18B, bidiNSM},
+	{0x1D1AA, 0x1D1AD, bidiNSM},
+	{0x1D1E9, 0x1D1EA, bidiON},
+	{0x1D200, 0x1D241, bidiON},
+	{0x1D242, 0x1D244, bidiNSM},
+	{0x1D245, 0x1D245, bidiON},
+	{0x1D300, 0x1D356, bidiON},
+	{0x1D6DB, 0x1D6DB, bidiON},
+	{0x1D715, 0x1D715, bidiON},
+	{0x1D74F, 0x1D74F, bidiON},
+	{0x1D789, 0x1D789, bidiON},
+	{0x1D7C3, 0x1D7C3, bidiON},
+	{0x1D7CE, 0x1D7FF, bidiEN},
+	{0x1DA00, 0x1DA36, bidiNSM},
+	{0x1DA3B, 0x1DA6C, bidiNSM},
+	{0x1DA75, 0x1DA75, bidiNSM},
+	{0x1DA84, 0x1DA84, bidiNSM},
+	{0x1DA9B, 0x1DA9F, bidiNSM},
+	{0x1DAA1, 0x1DAAF, bidiNSM},
+	{0x1E000, 0x1E006, bidiNSM},
+	{0x1E008, 0x1E018, bidiNSM},
+	{0x1E01B, 0x1E021, bidiNSM},
+	{0x1E023, 0x1E024, bidiNSM},
+	{0x1E026, 0x1E02A, bidiNSM},
+	{0x1E08F, 0x1E08F, bidiNSM},
+	{0x1E130, 0x1E136, bidiNSM},
+	{0x1E2AE, 0x1E2AE, bidiNSM},
+	{0x1E2EC, 0x1E2EF, bidiNSM},
+	{0x1E2FF, 0x1E2FF, bidiET},
+	{0x1E4EC, 0x1E4EF, bidiNSM},
+	{0x1E800, 0x1E8CF, bidiR},
+	{0x1E8D0, 0x1E8D6, bidiNSM},
+	{0x1E8D7, 0x1E943, bidiR},
+	{0x1E944, 0x1E94A, bidiNSM},
+	{0x1E94B, 0x1EC70, bidiR},
+	{0x1EC71, 0x1ECB4, bidiAL},
+	{0x1ECB5, 0x1ED00, bidiR},
+	{0x1ED01, 0x1ED3D, bidiAL},
+	{0x1ED3E, 0x1EDFF, bidiR},
+	{0x1EE00, 0x1EEEF, bidiAL},
+	{0x1EEF0, 0x1EEF1, bidiON},
+	{0x1EEF2, 0x1EEFF, bidiAL},
+	{0x1EF00, 0x1EFFF, bidiR},
+	{0x1F000, 0x1F02B, bidiON},
+	{0x1F030, 0x1F093, bidiON},
+	{0x1F0A0, 0x1F0AE, bidiON},
+	{0x1F0B1, 0x1F0BF, bidiON},
+	{0x1F0C1, 0x1F0CF, bidiON},
+	{0x1F0D1, 0x1F0F5, bidiON},
+	{0x1F100, 0x1F10A, bidiEN},
+	{0x1F10B, 0x1F10F, bidiON},
+	{0x1F12F, 0x1F12F, bidiON},
+	{0x1F16A, 0x1F16F, bidiON},
+	{0x1F1AD, 0x1F1AD, bidiON},
+	{0x1F260, 0x1F265, bidiON},
+	{0x1F300, 0x1F6D7, bidiON},
+	{0x1F6DC, 0x1F6EC, bidiON},
+	{0x1F6F0, 0x1F6FC, bidiON},
+	{0x1F700, 0x1F776, bidiON},
+	{0x1F77B, 0x1F7D9, bidiON},
+	{0x1F7E0, 0x1F7EB, bidiON},
+	{0x1F7F0, 0x1F7F0, bidiON},
+	{0x1F800, 0x1F80B, bidiON},
+	{0x1F810, 0x1F847, bidiON},
+	{0x1F850, 0x1F859, bidiON},
+	{0x1F860, 0x1F887, bidiON},
+	{0x1F890, 0x1F8AD, bidiON},
+	{0x1F8B0, 0x1F8B1, bidiON},
+	{0x1F900, 0x1FA53, bidiON},
+	{0x1FA60, 0x1FA6D, bidiON},
+	{0x1FA70, 0x1FA7C, bidiON},
+	{0x1FA80, 0x1FA88, bidiON},
+	{0x1FA90, 0x1FABD, bidiON},
+	{0x1FABF, 0x1FAC5, bidiON},
+	{0x1FACE, 0x1FADB, bidiON},
+	{0x1FAE0, 0x1FAE8, bidiON},
+	{0x1FAF0, 0x1FAF8, bidiON},
+	{0x1FB00, 0x1FB92, bidiON},
+	{0x1FB94, 0x1FBCA, bidiON},
+	{0x1FBF0, 0x1FBF9, bidiEN},
+	{0x1FFFE, 0x1FFFF, bidiBN},
+	{0x2FFFE, 0x2FFFF, bidiBN},
+	{0x3FFFE, 0x3FFFF, bidiBN},
+	{0x4FFFE, 0x4FFFF, bidiBN},
+	{0x5FFFE, 0x5FFFF, bidiBN},
+	{0x6FFFE, 0x6FFFF, bidiBN},
+	{0x7FFFE, 0x7FFFF, bidiBN},
+	{0x8FFFE, 0x8FFFF, bidiBN},
+	{0x9FFFE, 0x9FFFF, bidiBN},
+	{0xAFFFE, 0xAFFFF, bidiBN},
+	{0xBFFFE, 0xBFFFF, bidiBN},
+	{0xCFFFE, 0xCFFFF, bidiBN},
+	{0xDFFFE, 0xE00FF, bidiBN},
+	{0xE0100, 0xE01EF, bidiNSM},
+	{0xE01F0, 0xE0FFF, bidiBN},
+	{0xEFFFE, 0xEFFFF, bidiBN},
+	{0xFFFFE, 0xFFFFF, bidiBN},
+	{0x10FFFE, 0x10FFFF, bidiBN},
+}
+
+//bracketPairs opening and closing paired brackets, they are mirrored in right-to-left text
+var bracketPairs = [][2]rune{
+	{0x0028, 0x0029},
+	{0x005B, 0x005D},
+	{0x007B, 0x007D},
+	{0x0F3A, 0x0F3B},
+	{0x0F3C, 0x0F3D},
+	{0x169B, 0x169C},
+	{0x2045, 0x2046},
+	{0x207D, 0x207E},
+	{0x208D, 0x208E},
+	{0x2308, 0x2309},
+	{0x230A, 0x230B},
+	{0x2329, 0x232A},
+	{0x2768, 0x2769},
+	{0x276A, 0x276B},
+	{0x276C, 0x276D},
+	{0x276E, 0x276F},
+	{0x2770, 0x2771},
+	{0x2772, 0x2773},
+	{0x2774, 0x2775},
+	{0x27C5, 0x27C6},
+	{0x27E6, 0x27E7},
+	{0x27E8, 0x27E9},
+	{0x27EA, 0x27EB},
+	{0x27EC, 0x27ED},
+	{0x27EE, 0x27EF},
+	{0x2983, 0x2984},
+	{0x2985, 0x2986},
+	{0x2987, 0x2988},
+	{0x2989, 0x298A},
+	{0x298B, 0x298C},
+	{0x298D, 0x2990},
+	{0x298F, 0x298E},
+	{0x2991, 0x2992},
+	{0x2993, 0x2994},
+	{0x2995, 0x2996},
+	{0x2997, 0x2998},
+	{0x29D8, 0x29D9},
+	{0x29DA, 0x29DB},
+	{0x29FC, 0x29FD},
+	{0x2E22, 0x2E23},
+	{0x2E24, 0x2E25},
+	{0x2E26, 0x2E27},
+	{0x2E28, 0x2E29},
+	{0x2E55, 0x2E56},
+	{0x2E57, 0x2E58},
+	{0x2E59, 0x2E5A},
+	{0x2E5B, 0x2E5C},
+	{0x3008, 0x3009},
+	{0x300A, 0x300B},
+	{0x300C, 0x300D},
+	{0x300E, 0x300F},
+	{0x3010, 0x3011},
+	{0x3014, 0x3015},
+	{0x3016, 0x3017},
+	{0x3018, 0x3019},
+	{0x301A, 0x301B},
+	{0xFE59, 0xFE5A},
+	{0xFE5B, 0xFE5C},
+	{0xFE5D, 0xFE5E},
+	{0xFF08, 0xFF09},
+	{0xFF3B, 0xFF3D},
+	{0xFF5B, 0xFF5D},
+	{0xFF5F, 0xFF60},
+	{0xFF62, 0xFF63},
+}
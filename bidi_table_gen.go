@@ -0,0 +1,84 @@
+//go:build ignore
+// +build ignore
+
+//generate bidi_table.go from unicode data of golang.org/x/text/unicode/bidi (go run bidi_table_gen.go)
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"log"
+
+	"golang.org/x/text/unicode/bidi"
+)
+
+//classNames name of bidiType in nxpdf of bidi class, explicit formatting characters are BN (they are not supported)
+var classNames = map[bidi.Class]string{
+	bidi.L:   "bidiL",
+	bidi.R:   "bidiR",
+	bidi.AL:  "bidiAL",
+	bidi.EN:  "bidiEN",
+	bidi.ES:  "bidiES",
+	bidi.ET:  "bidiET",
+	bidi.AN:  "bidiAN",
+	bidi.CS:  "bidiCS",
+	bidi.NSM: "bidiNSM",
+	bidi.BN:  "bidiBN",
+	bidi.B:   "bidiB",
+	bidi.S:   "bidiS",
+	bidi.WS:  "bidiWS",
+	bidi.ON:  "bidiON",
+}
+
+func className(r rune) string {
+	props, _ := bidi.LookupRune(r)
+	if name, ok := classNames[props.Class()]; ok {
+		return name
+	}
+	return "bidiBN"
+}
+
+func main() {
+
+	var buff bytes.Buffer
+	buff.WriteString("// Code generated by bidi_table_gen.go; DO NOT EDIT.\n\n")
+	buff.WriteString("package nxpdf\n\n")
+	buff.WriteString("//bidiUnicodeVersion version of unicode data of bidiRanges and bracketPairs\n")
+	fmt.Fprintf(&buff, "const bidiUnicodeVersion = %q\n\n", bidi.UnicodeVersion)
+
+	buff.WriteString("//bidiRanges sorted ranges of characters that bidi class is not L\n")
+	buff.WriteString("var bidiRanges = []bidiRange{\n")
+	start, curr := rune(0), className(0)
+	for r := rune(1); r <= 0x110000; r++ {
+		name := "bidiL"
+		if r < 0x110000 {
+			name = className(r)
+		}
+		if name == curr && r < 0x110000 {
+			continue
+		}
+		if curr != "bidiL" {
+			fmt.Fprintf(&buff, "\t{0x%04X, 0x%04X, %s},\n", start, r-1, curr)
+		}
+		start, curr = r, name
+	}
+	buff.WriteString("}\n\n")
+
+	buff.WriteString("//bracketPairs opening and closing paired brackets, they are mirrored in right-to-left text\n")
+	buff.WriteString("var bracketPairs = [][2]rune{\n")
+	for r := rune(0); r < 0x110000; r++ {
+		props, _ := bidi.LookupRune(r)
+		if !props.IsOpeningBracket() {
+			continue
+		}
+		closing := []rune(bidi.ReverseString(string(r)))[0]
+		fmt.Fprintf(&buff, "\t{0x%04X, 0x%04X},\n", r, closing)
+	}
+	buff.WriteString("}\n")
+
+	err := ioutil.WriteFile("bidi_table.go", buff.Bytes(), 0644)
+	if err != nil {
+		log.Fatal(err)
+	}
+}
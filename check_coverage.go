@@ -0,0 +1,30 @@
+package nxpdf
+
+func checkCoverage(p *PdfData, fontRef FontRef, text string) (*CoverageResult, error) {
+
+	ssf, found := p.subsetFonts[fontRef]
+	if !found {
+		return nil, ErrFontRefNotFound
+	}
+
+	var result CoverageResult
+	checked := make(map[rune]bool)
+	for _, r := range text {
+
+		if r == '\n' || r == '\r' || checked[r] { //line break is not drawn
+			continue
+		}
+		checked[r] = true
+
+		if !ssf.isInCmap(r) {
+			result.Missing = append(result.Missing, r)
+			continue
+		}
+
+		if ssf.charCodeToGlyphIndex(r) == 0 {
+			result.Notdef = append(result.Notdef, r)
+		}
+	}
+
+	return &result, nil
+}
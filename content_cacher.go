@@ -4,89 +4,533 @@ import (
 	"bytes"
 	"fmt"
 	"io"
-	"strconv"
+	"math"
+	"strings"
 
+	"github.com/oneplus1000/nxpdf/font"
 	"github.com/pkg/errors"
 )
 
 type contentCacher interface {
-	build(w io.Writer) (int64, error)
+	build(w io.Writer, info *pageInfo) (int64, error)
+	layer() int //LayerOverlay or LayerUnderlay
+}
+
+//pageInfo information of page that use while build content
+type pageInfo struct {
+	fontResNames map[FontRef]string //font resource name (without /) of each FontRef in resources of page
+	matrix       *Matrix            //map coordinates of page as displayed to pdf user space (nil if page is not rotated)
+}
+
+func (p *pageInfo) fontResName(fontRef FontRef) (string, error) {
+	if p != nil {
+		if name, ok := p.fontResNames[fontRef]; ok {
+			return name, nil
+		}
+	}
+	return "", ErrFontRefNotFound
 }
 
 //contenteCacheText
 
+const defaultFontSize = 14.0
+
+//defaultMinFontSize smallest font size of auto shrink mode
+const defaultMinFontSize = 4.0
+
+//shrinkStep font size that reduce in each step of auto shrink mode
+const shrinkStep = 0.5
+
 type contenteCacheText struct {
-	ssf      *subsetFont
-	textRaw  string
-	x, y     int
-	fontSize int
+	fontRef   FontRef
+	ssf       *subsetFont
+	textRaw   string
+	rect      Position
+	option    TextOption
+	fallbacks []textFont //fonts for rune that font of fontRef does not have
+	thaiDict  *thaiDict  //for find line break of thai text
+	lines     []textLine //result of layout()
 }
 
-func (c *contenteCacheText) build(w io.Writer) (int64, error) {
+func (c *contenteCacheText) layer() int {
+	return c.option.Layer
+}
+
+func (c *contenteCacheText) build(w io.Writer, info *pageInfo) (int64, error) {
+
+	fontResName, err := info.fontResName(c.fontRef)
+	if err != nil {
+		return 0, errors.Wrapf(err, "info.fontResName(%s) fail", c.fontRef)
+	}
+
+	fontSize := c.fontSize()
 
-	var buffText bytes.Buffer
-	var leftRune rune
-	var leftRuneIndex uint
-	unitsPerEm := int(c.ssf.ttfp.UnitsPerEm())
-	for _, currRune := range c.textRaw {
+	hasState := c.hasState()
 
-		currRuneIndex, err := c.ssf.getGlyphIndex(currRune)
+	var buff bytes.Buffer
+	if hasState {
+		buff.WriteString("q\n")
+		err = c.writeColors(&buff)
+		if err != nil {
+			return 0, errors.Wrap(err, "")
+		}
+		c.writeTransform(&buff)
+	}
+	buff.WriteString("BT\n")
+	buff.WriteString(fmt.Sprintf("/%s %0.2f Tf\n", fontResName, fontSize))
+	if hasState {
+		c.writeTextState(&buff)
+	}
+	currFontRef := c.fontRef
+	prevX, prevY := 0.0, 0.0
+	for i, line := range c.lines {
+		x, y := c.position(i, c.runsWidth(line.runs)*fontSize/1000.0*c.lineScaling())
+		x, y = round2(x), round2(y)
+		buff.WriteString(fmt.Sprintf("%0.2f %0.2f TD\n", x-prevX, y-prevY))
+		err = c.writeRuns(&buff, line.runs, info, &currFontRef)
 		if err != nil {
-			return 0, errors.Wrapf(err, "c.ssf.getGlyphIndex(%s) fail", string(currRune))
+			return 0, errors.Wrap(err, "")
+		}
+		prevX, prevY = x, y
+	}
+	buff.WriteString("ET\n")
+	c.writeDecorations(&buff)
+	if hasState {
+		buff.WriteString("Q\n")
+	}
+
+	//fmt.Printf("%s\n", buff.String()) //debug
+
+	return buff.WriteTo(w)
+}
+
+//writeRuns write Tf and TJ operators of runs in line (currFontRef is font that is set by last Tf),
+//offset of glyph is made by number in TJ (x) and Ts operator (y)
+func (c *contenteCacheText) writeRuns(buff *bytes.Buffer, runs []textRun, info *pageInfo, currFontRef *FontRef) error {
+
+	fontSize := c.fontSize()
+	charSpacing := c.charSpacing()
+	penX := 0.0 //position of glyph in line (without offset)
+	pdfX := 0.0 //position that pdf viewer draw next glyph
+	yOffset := 0
+	for _, run := range runs {
+
+		if len(run.glyphs) <= 0 {
+			continue
 		}
 
-		//kerning
-		pairval := convertTTFUnit2PDFUnit(int(c.kerning(leftRune, currRune, leftRuneIndex, currRuneIndex)), unitsPerEm)
-		if pairval != 0 {
-			buffText.WriteString(fmt.Sprintf(">%d<", (-1)*pairval))
+		if run.fontRef != *currFontRef {
+			fontResName, err := info.fontResName(run.fontRef)
+			if err != nil {
+				return errors.Wrapf(err, "info.fontResName(%s) fail", run.fontRef)
+			}
+			buff.WriteString(fmt.Sprintf("/%s %0.2f Tf\n", fontResName, fontSize))
+			*currFontRef = run.fontRef
+		}
+
+		isInHex := false //inside <...> of TJ
+		buff.WriteString("[")
+		for _, glyph := range run.glyphs {
+
+			if glyph.yOffset != yOffset {
+				if isInHex {
+					buff.WriteString(">")
+					isInHex = false
+				}
+				buff.WriteString("] TJ\n")
+				buff.WriteString(fmt.Sprintf("%0.2f Ts\n", round2(c.option.Rise+float64(glyph.yOffset)*fontSize/1000.0)))
+				buff.WriteString("[")
+				yOffset = glyph.yOffset
+			}
+
+			//move to position of glyph (number in TJ move forward in vertical writing)
+			x := penX + float64(glyph.xOffset)
+			if adjust := math.Round(pdfX - x); adjust != 0 {
+				if isInHex {
+					buff.WriteString(">")
+					isInHex = false
+				}
+				if run.ssf.vertical {
+					buff.WriteString(fmt.Sprintf("%d", -int(adjust)))
+				} else {
+					buff.WriteString(fmt.Sprintf("%d", int(adjust)))
+				}
+				pdfX -= adjust
+			}
+
+			//write glyph index
+			if !isInHex {
+				buff.WriteString("<")
+				isInHex = true
+			}
+			buff.WriteString(fmt.Sprintf("%04X", glyph.glyph))
+			pdfX += float64(run.ssf.glyphIndexToPdfAdvance(glyph.glyph)) + charSpacing
+			penX += float64(glyph.xAdvance)
+			if !glyph.isMark {
+				penX += charSpacing
+			}
 		}
+		buff.WriteString(">] TJ\n")
+	}
+
+	if yOffset != 0 {
+		buff.WriteString(fmt.Sprintf("%0.2f Ts\n", round2(c.option.Rise)))
+	}
+
+	return nil
+}
+
+//writeDecorations write rules of underline and strikeout of each line (filled by fill color),
+//rules are not drawn if text is not painted (RenderMode is invisible or clip)
+func (c *contenteCacheText) writeDecorations(buff *bytes.Buffer) {
+
+	rules := c.decorationRules()
+	if len(rules) == 0 {
+		return
+	}
+
+	fontSize := c.fontSize()
+	for i, line := range c.lines {
+		width := c.runsWidth(line.runs) * fontSize / 1000.0 * c.lineScaling()
+		x, y := c.position(i, width)
+		writeRules(buff, rules, x, y, width)
+	}
+}
+
+//decorationRules top and thickness (relative to baseline) of underline and strikeout,
+//nil if rules are not drawn
+func (c *contenteCacheText) decorationRules() [][2]float64 {
+
+	if (!c.option.Underline && !c.option.Strikeout) || c.option.RenderMode > TextRenderFillStroke || c.isVertical() {
+		return nil
+	}
+
+	var rules [][2]float64
+	if c.option.Underline {
+		top, thickness := c.underlineMetrics()
+		rules = append(rules, [2]float64{top, thickness})
+	}
+	if c.option.Strikeout {
+		top, thickness := c.strikeoutMetrics()
+		rules = append(rules, [2]float64{top, thickness})
+	}
+	return rules
+}
 
-		//write rune index
-		buffText.WriteString(fmt.Sprintf("%04X", currRuneIndex))
+//writeRules write rules (from decorationRules) of text at (x, baseline y) that width is width
+func writeRules(buff *bytes.Buffer, rules [][2]float64, x float64, y float64, width float64) {
+	if width <= 0 {
+		return
+	}
+	for _, rule := range rules {
+		buff.WriteString(fmt.Sprintf("%0.2f %0.2f %0.2f %0.2f re f\n", round2(x), round2(y+rule[0]-rule[1]), round2(width), round2(rule[1])))
+	}
+}
 
-		//next loop
-		leftRune = currRune
-		leftRuneIndex = currRuneIndex
+//underlineMetrics top and thickness of underline (from post table) in text space unit
+func (c *contenteCacheText) underlineMetrics() (float64, float64) {
+	ttfp := &c.ssf.ttfp
+	unitsPerEm := float64(ttfp.UnitsPerEm())
+	thickness := float64(ttfp.UnderlineThickness())
+	if thickness <= 0 {
+		thickness = unitsPerEm / 20
+	}
+	top := float64(ttfp.UnderlinePosition())
+	if top == 0 {
+		top = -unitsPerEm / 10
+	}
+	return top * c.fontSize() / unitsPerEm, thickness * c.fontSize() / unitsPerEm
+}
+
+//strikeoutMetrics top and thickness of strikeout (from OS/2 table) in text space unit
+func (c *contenteCacheText) strikeoutMetrics() (float64, float64) {
+	ttfp := &c.ssf.ttfp
+	unitsPerEm := float64(ttfp.UnitsPerEm())
+	thickness := float64(ttfp.StrikeoutSize())
+	if thickness <= 0 {
+		thickness = float64(ttfp.UnderlineThickness())
+	}
+	if thickness <= 0 {
+		thickness = unitsPerEm / 20
 	}
+	top := float64(ttfp.StrikeoutPosition())
+	if top <= 0 {
+		top = float64(ttfp.XHeight())/2 + thickness/2
+	}
+	return top * c.fontSize() / unitsPerEm, thickness * c.fontSize() / unitsPerEm
+}
 
-	x := 10.0           //FIXME: this hard code
-	y := 800.00         //FIXME: this hard code
-	fontCountIndex := 2 //FIXME: this hard code
-	fontSize := 14      //FIXME: this hard code
+//hasState option has color, text state or transform (that must be restored by Q)
+func (c *contenteCacheText) hasState() bool {
+	o := c.option
+	return o.FillColor != nil || o.StrokeColor != nil || o.RenderMode != TextRenderFill ||
+		o.CharSpacing != 0 || (o.HorizontalScaling != 0 && o.HorizontalScaling != 100) || o.Rise != 0 ||
+		o.Rotate != 0 || o.Matrix != nil
+}
+
+//writeTransform write cm operators of Matrix and Rotate (pdf apply last cm first)
+func (c *contenteCacheText) writeTransform(buff *bytes.Buffer) {
+	if m := c.option.Matrix; m != nil {
+		writeMatrix(buff, *m)
+	}
+	if c.option.Rotate != 0 {
+		x, y := c.anchor()
+		rad := c.option.Rotate * math.Pi / 180
+		cos, sin := math.Cos(rad), math.Sin(rad)
+		//move anchor to origin, rotate and move back
+		writeMatrix(buff, Matrix{
+			A: cos, B: sin,
+			C: -sin, D: cos,
+			E: x - x*cos + y*sin,
+			F: y - x*sin - y*cos,
+		})
+	}
+}
+
+//anchor point of c.rect that is center of rotation
+func (c *contenteCacheText) anchor() (float64, float64) {
+	anchor := c.option.Anchor
+	x := c.rect.X //AlignLeft
+	if anchor&AlignRight == AlignRight {
+		x = c.rect.X + c.rect.W
+	} else if anchor&AlignCenter == AlignCenter {
+		x = c.rect.X + c.rect.W/2
+	}
+	y := c.rect.Y //AlignBottom
+	if anchor&AlignTop == AlignTop {
+		y = c.rect.Y + c.rect.H
+	} else if anchor&AlignMiddle == AlignMiddle {
+		y = c.rect.Y + c.rect.H/2
+	}
+	return x, y
+}
+
+func writeMatrix(buff *bytes.Buffer, m Matrix) {
+	//+ 0 convert -0 (ex. cos of 90 degrees after rounding) to 0
+	r5 := func(n float64) float64 { return math.Round(n*100000)/100000 + 0 }
+	r2 := func(n float64) float64 { return round2(n) + 0 }
+	buff.WriteString(fmt.Sprintf("%0.5f %0.5f %0.5f %0.5f %0.2f %0.2f cm\n", r5(m.A), r5(m.B), r5(m.C), r5(m.D), r2(m.E), r2(m.F)))
+}
+
+func (c *contenteCacheText) writeColors(buff *bytes.Buffer) error {
+	if c.option.FillColor != nil {
+		op, err := colorOperator(c.option.FillColor, false)
+		if err != nil {
+			return errors.Wrap(err, "")
+		}
+		buff.WriteString(op)
+	}
+	if c.option.StrokeColor != nil {
+		op, err := colorOperator(c.option.StrokeColor, true)
+		if err != nil {
+			return errors.Wrap(err, "")
+		}
+		buff.WriteString(op)
+	}
+	return nil
+}
+
+//writeTextState write Tr, Tc, Tz and Ts operators (word spacing is in TJ, see shapeRun)
+func (c *contenteCacheText) writeTextState(buff *bytes.Buffer) {
+	o := c.option
+	if o.RenderMode != TextRenderFill {
+		buff.WriteString(fmt.Sprintf("%d Tr\n", o.RenderMode))
+	}
+	if o.CharSpacing != 0 {
+		//Tc move glyph up in vertical writing
+		charSpacing := round2(o.CharSpacing)
+		if c.isVertical() {
+			charSpacing = -charSpacing
+		}
+		buff.WriteString(fmt.Sprintf("%0.2f Tc\n", charSpacing))
+	}
+	if o.HorizontalScaling != 0 && o.HorizontalScaling != 100 {
+		buff.WriteString(fmt.Sprintf("%0.2f Tz\n", round2(o.HorizontalScaling)))
+	}
+	if o.Rise != 0 {
+		buff.WriteString(fmt.Sprintf("%0.2f Ts\n", round2(o.Rise)))
+	}
+}
+
+//colorOperator operator that set fill (or stroke) color
+func colorOperator(color *Color, isStroke bool) (string, error) {
+
+	var op string
+	var size int
+	switch color.Space {
+	case ColorSpaceGray:
+		op, size = "g", 1
+	case ColorSpaceRGB:
+		op, size = "rg", 3
+	case ColorSpaceCMYK:
+		op, size = "k", 4
+	default:
+		return "", ErrInvalidColor
+	}
+	if len(color.Values) != size {
+		return "", ErrInvalidColor
+	}
+
+	if isStroke {
+		op = strings.ToUpper(op)
+	}
 
 	var buff bytes.Buffer
-	buff.WriteString("BT\n")
-	buff.WriteString(fmt.Sprintf("%0.2f %0.2f TD\n", x, y))
-	buff.WriteString("/F" + strconv.Itoa(fontCountIndex) + " " + strconv.Itoa(fontSize) + " Tf\n")
-	buff.WriteString("[<")
-	buffText.WriteTo(&buff)
-	buff.WriteString(">] TJ\n")
-	buff.WriteString("ET\n")
+	for _, v := range color.Values {
+		if v < 0 || v > 1 {
+			return "", ErrInvalidColor
+		}
+		buff.WriteString(fmt.Sprintf("%0.3f ", v))
+	}
+	buff.WriteString(op + "\n")
+	return buff.String(), nil
+}
 
-	//fmt.Printf("%s\n", buff.String()) //debug
+//charSpacing character spacing in 1/1000 of text space unit
+func (c *contenteCacheText) charSpacing() float64 {
+	return round2(c.option.CharSpacing) * 1000 / c.fontSize()
+}
 
-	return buff.WriteTo(w)
+//wordSpacing word spacing in 1/1000 of text space unit
+func (c *contenteCacheText) wordSpacing() int {
+	return int(math.Round(c.option.WordSpacing * 1000 / c.fontSize()))
 }
 
-func (c *contenteCacheText) kerning(leftRune rune, rightRune rune, leftIndex uint, rightIndex uint) int16 {
+//horizontalScaling horizontal scaling (1 is 100 percent)
+func (c *contenteCacheText) horizontalScaling() float64 {
+	if c.option.HorizontalScaling <= 0 {
+		return 1
+	}
+	return round2(c.option.HorizontalScaling) / 100
+}
 
-	pairVal := int16(0)
-	if haveKerning, kval := c.ssf.kernValueByLeft(leftIndex); haveKerning {
-		if ok, v := kval.ValueByRight(rightIndex); ok {
-			pairVal = v
+//lineScaling scaling of advance along line (horizontal scaling does not change advance in vertical writing)
+func (c *contenteCacheText) lineScaling() float64 {
+	if c.isVertical() {
+		return 1
+	}
+	return c.horizontalScaling()
+}
+
+//isVertical text is written in columns (font is vertical)
+func (c *contenteCacheText) isVertical() bool {
+	return c.ssf.vertical
+}
+
+func (c *contenteCacheText) fontSize() float64 {
+	if c.option.Size <= 0 {
+		return defaultFontSize
+	}
+	return c.option.Size
+}
+
+//ascentAndDescent ascent and descent (less than zero) of font in text space unit
+func (c *contenteCacheText) ascentAndDescent() (float64, float64) {
+	fontSize := c.fontSize()
+	unitsPerEm := float64(c.ssf.ttfp.UnitsPerEm())
+	ascent := float64(c.ssf.ttfp.Ascender()) * fontSize / unitsPerEm
+	descent := float64(c.ssf.ttfp.Descender()) * fontSize / unitsPerEm
+	return ascent, descent
+}
+
+func (c *contenteCacheText) lineHeight() float64 {
+	if c.option.LineHeight > 0 {
+		return c.option.LineHeight
+	}
+	ascent, descent := c.ascentAndDescent()
+	return ascent - descent
+}
+
+//position find start point (x, baseline) of line at lineIndex that width is textWidth in c.rect
+func (c *contenteCacheText) position(lineIndex int, textWidth float64) (float64, float64) {
+
+	if c.isVertical() {
+		return c.verticalPosition(lineIndex, textWidth)
+	}
+
+	ascent, descent := c.ascentAndDescent()
+	lineHeight := c.lineHeight()
+	linesHeight := float64(len(c.lines)-1) * lineHeight //from first baseline to last baseline
+
+	align := c.option.Align
+	if align&(AlignLeft|AlignRight|AlignCenter) == 0 && lineIndex < len(c.lines) && c.lines[lineIndex].rtl {
+		align |= AlignRight //right-to-left paragraph
+	}
+	x := c.rect.X //AlignLeft
+	if align&AlignRight == AlignRight {
+		x = c.rect.X + c.rect.W - textWidth
+	} else if align&AlignCenter == AlignCenter {
+		x = c.rect.X + (c.rect.W-textWidth)/2
+	}
+
+	y := c.rect.Y + c.rect.H - ascent //AlignTop
+	if align&AlignBottom == AlignBottom {
+		y = c.rect.Y - descent + linesHeight
+	} else if align&AlignMiddle == AlignMiddle {
+		y = c.rect.Y + c.rect.H/2 - (ascent+descent-linesHeight)/2
+	}
+
+	return x, y - float64(lineIndex)*lineHeight
+}
+
+//verticalPosition find start point (center, top) of column at lineIndex that height is textHeight in c.rect,
+//columns are from right to left (zero align mean AlignRight|AlignTop)
+func (c *contenteCacheText) verticalPosition(lineIndex int, textHeight float64) (float64, float64) {
+
+	ascent, descent := c.ascentAndDescent()
+	columnWidth := ascent - descent
+	lineHeight := c.lineHeight()
+	columnsWidth := float64(len(c.lines)-1)*lineHeight + columnWidth //from right of first column to left of last column
+
+	align := c.option.Align
+	x := c.rect.X + c.rect.W //AlignRight
+	if align&AlignLeft == AlignLeft {
+		x = c.rect.X + columnsWidth
+	} else if align&AlignCenter == AlignCenter {
+		x = c.rect.X + (c.rect.W+columnsWidth)/2
+	}
+
+	y := c.rect.Y + c.rect.H //AlignTop
+	if align&AlignBottom == AlignBottom {
+		y = c.rect.Y + textHeight
+	} else if align&AlignMiddle == AlignMiddle {
+		y = c.rect.Y + (c.rect.H+textHeight)/2
+	}
+
+	return x - columnWidth/2 - float64(lineIndex)*lineHeight, y
+}
+
+func round2(n float64) float64 {
+	return math.Round(n*100) / 100
+}
+
+func (c *contenteCacheText) kerning(ssf *subsetFont, script string, leftRune rune, rightRune rune, leftIndex uint, rightIndex uint) font.PairValue {
+
+	var pairVal font.PairValue
+	if ssf.ttfp.Kern() != nil {
+		if haveKerning, kval := ssf.kernValueByLeft(leftIndex); haveKerning {
+			if ok, v := kval.ValueByRight(rightIndex); ok {
+				pairVal.First.XAdvance = int(v)
+			}
 		}
+	} else if ok, v := ssf.gposKerning(leftIndex, rightIndex, script); ok {
+		//font has no kern table, use pair adjustment of GPOS
+		pairVal = v
 	}
-	/*
-		if f.funcKernOverride != nil {
-			pairVal = f.funcKernOverride(
+	if ssf.funcKernOverride != nil {
+		val := pairVal.First.XAdvance + pairVal.Second.XAdvance
+		overrideVal := ssf.funcKernOverride(
 			leftRune,
 			rightRune,
 			leftIndex,
 			rightIndex,
-			pairVal,
-			)
+			val,
+		)
+		if overrideVal != val {
+			//placements and advance of right glyph from GPOS are dropped too
+			pairVal = font.PairValue{First: font.ValueRecord{XAdvance: overrideVal}}
 		}
-	*/
+	}
 	return pairVal
 }
 
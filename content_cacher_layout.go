@@ -0,0 +1,352 @@
+package nxpdf
+
+import (
+	"math"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/pkg/errors"
+)
+
+//textLine a line of text after layout
+type textLine struct {
+	text  string
+	start int       //byte offset of line in textRaw
+	rtl   bool      //paragraph of line is right-to-left
+	forms []string  //joining form of each rune of text (see arabicJoiningForms)
+	isEnd bool      //last line of paragraph
+	runs  []textRun //result of shape() in visual order
+}
+
+//layout split c.textRaw into c.lines and return text that does not fit in c.rect (only when option.Wrap)
+func (c *contenteCacheText) layout() (string, error) {
+
+	c.lines = nil
+	start := 0
+	for _, rawParagraph := range strings.Split(c.textRaw, "\n") {
+		paragraph := strings.TrimSuffix(rawParagraph, "\r")
+		first := len(c.lines)
+		if c.option.Wrap && c.lineExtent() > 0 {
+			err := c.wrap(paragraph, start)
+			if err != nil {
+				return "", errors.Wrapf(err, "c.wrap(%s) fail", paragraph)
+			}
+		} else {
+			c.lines = append(c.lines, textLine{text: paragraph, start: start})
+		}
+		rtl := isRTLParagraph(paragraph)
+		forms := arabicJoiningForms([]rune(paragraph))
+		for i := first; i < len(c.lines); i++ {
+			c.lines[i].rtl = rtl
+			offset := utf8.RuneCountInString(c.textRaw[start:c.lines[i].start])
+			c.lines[i].forms = forms[offset : offset+utf8.RuneCountInString(c.lines[i].text)]
+		}
+		c.lines[len(c.lines)-1].isEnd = true
+		start += len(rawParagraph) + 1
+	}
+
+	overflow := ""
+	if c.option.Wrap && c.crossExtent() > 0 {
+		//remove lines that overflow c.rect.H (c.rect.W in vertical writing)
+		ascent, descent := c.ascentAndDescent()
+		lineHeight := c.lineHeight()
+		for i, line := range c.lines {
+			if float64(i)*lineHeight+ascent-descent > c.crossExtent()+0.001 {
+				c.lines = c.lines[:i]
+				overflow = c.textRaw[line.start:]
+				break
+			}
+		}
+	}
+
+	for i := range c.lines {
+		runs, err := c.shape(c.lines[i].text, c.lines[i].rtl, c.lines[i].forms)
+		if err != nil {
+			return "", errors.Wrapf(err, "c.shape(%s) fail", c.lines[i].text)
+		}
+		c.lines[i].runs = reorderRuns(runs)
+		if c.option.Align&AlignJustify == AlignJustify && c.option.Wrap && !c.lines[i].isEnd {
+			c.justify(&c.lines[i])
+		}
+	}
+
+	return overflow, nil
+}
+
+//shrink reduce font size (not less than option.MinSize) and layout until text fit in c.rect,
+//return text that does not fit in c.rect at smallest size
+func (c *contenteCacheText) shrink() (string, error) {
+
+	minSize := c.option.MinSize
+	if minSize <= 0 {
+		minSize = defaultMinFontSize
+	}
+
+	for {
+		overflow, err := c.layout()
+		if err != nil {
+			return "", errors.Wrap(err, "")
+		}
+
+		fontSize := c.fontSize()
+		if c.isFit(overflow) || fontSize <= minSize {
+			return overflow, nil
+		}
+
+		fontSize -= shrinkStep
+		if fontSize < minSize {
+			fontSize = minSize
+		}
+		c.option.Size = fontSize
+	}
+}
+
+//isFit all lines are in c.rect
+func (c *contenteCacheText) isFit(overflow string) bool {
+
+	if overflow != "" {
+		return false
+	}
+
+	if c.lineExtent() > 0 {
+		maxWidth := c.maxLineWidth()
+		for _, line := range c.lines {
+			if c.runsWidth(line.runs) > maxWidth {
+				return false
+			}
+		}
+	}
+
+	if c.crossExtent() > 0 {
+		ascent, descent := c.ascentAndDescent()
+		height := float64(len(c.lines)-1)*c.lineHeight() + ascent - descent
+		if height > c.crossExtent()+0.001 {
+			return false
+		}
+	}
+
+	return true
+}
+
+//addGlyphs add characters of text and shaped glyphs of lines to subset fonts,
+//call it after layout is success so failed insertion does not change subset fonts
+func (c *contenteCacheText) addGlyphs() {
+	for _, run := range c.splitRuns(c.textRaw) {
+		run.ssf.addChars(run.text)
+	}
+	for _, line := range c.lines {
+		for _, run := range line.runs {
+			run.ssf.addShapedGlyphs(run.glyphs)
+		}
+	}
+}
+
+//wrap split paragraph into lines that fit in c.rect.W (c.rect.H in vertical writing), start is byte offset of paragraph in textRaw,
+//each word is shaped once and width of line is sum of width of its words
+func (c *contenteCacheText) wrap(paragraph string, start int) error {
+
+	maxWidth := c.maxLineWidth()
+	line := ""
+	lineStart := start
+	lineWidth := 0.0 //width of line (with spaces at end of line)
+	for _, word := range c.splitWords(paragraph) {
+
+		trimmed := strings.TrimRightFunc(word, unicode.IsSpace)
+		trimmedWidth, err := c.textWidth(trimmed)
+		if err != nil {
+			return errors.Wrap(err, "")
+		}
+		width := trimmedWidth
+		if len(trimmed) < len(word) {
+			spacesWidth, err := c.textWidth(word[len(trimmed):])
+			if err != nil {
+				return errors.Wrap(err, "")
+			}
+			width += spacesWidth
+		}
+
+		if line != "" {
+			if lineWidth+trimmedWidth <= maxWidth {
+				line += word
+				lineWidth += width
+				start += len(word)
+				continue
+			}
+			c.lines = append(c.lines, textLine{text: strings.TrimRightFunc(line, unicode.IsSpace), start: lineStart})
+			line = ""
+			lineStart = start
+		}
+
+		//word longer than line, break it by cluster
+		for trimmedWidth > maxWidth {
+			size, sizeWidth, err := c.fitLength(trimmed, maxWidth)
+			if err != nil {
+				return errors.Wrap(err, "")
+			}
+			if size >= len(trimmed) {
+				break
+			}
+			c.lines = append(c.lines, textLine{text: word[:size], start: lineStart})
+			word = word[size:]
+			trimmed = trimmed[size:]
+			trimmedWidth -= sizeWidth
+			width -= sizeWidth
+			start += size
+			lineStart = start
+		}
+		line = word
+		lineWidth = width
+		start += len(word)
+	}
+	c.lines = append(c.lines, textLine{text: strings.TrimRightFunc(line, unicode.IsSpace), start: lineStart})
+
+	return nil
+}
+
+//justify add space to spaces between words of line, so line fill c.rect
+func (c *contenteCacheText) justify(line *textLine) {
+	spaces := spaceGlyphs(line.runs)
+	extra := int(math.Round(c.maxLineWidth() - c.runsWidth(line.runs)))
+	if len(spaces) == 0 || extra <= 0 {
+		return
+	}
+	for i, space := range spaces {
+		space.xAdvance += extra / len(spaces)
+		if i < extra%len(spaces) {
+			space.xAdvance++
+		}
+	}
+}
+
+//spaceGlyphs glyphs of space in runs
+func spaceGlyphs(runs []textRun) []*shapedGlyph {
+	var spaces []*shapedGlyph
+	for i := range runs {
+		for j := range runs[i].glyphs {
+			glyph := &runs[i].glyphs[j]
+			if len(glyph.runes) == 1 && glyph.runes[0] == ' ' {
+				spaces = append(spaces, glyph)
+			}
+		}
+	}
+	return spaces
+}
+
+//fitLength find length (in byte) and width of the longest prefix of text that fit in maxWidth, at least one cluster,
+//text is broken only between clusters so a line never start with a combining mark,
+//each cluster is shaped once and width of prefix is sum of width of its clusters
+func (c *contenteCacheText) fitLength(text string, maxWidth float64) (int, float64, error) {
+	runes := []rune(text)
+	rtl := isRTLParagraph(text)
+	forms := arabicJoiningForms(runes)
+	end := 0
+	width := 0.0
+	for end < len(runes) {
+		next := nextCluster(runes, end)
+		runs, err := c.shape(string(runes[end:next]), rtl, forms[end:next])
+		if err != nil {
+			return 0, 0, errors.Wrap(err, "")
+		}
+		clusterWidth := c.runsWidth(runs)
+		if end > 0 && width+clusterWidth > maxWidth {
+			break
+		}
+		width += clusterWidth
+		end = next
+	}
+	return len(string(runes[:end])), width, nil
+}
+
+//nextCluster find end of character cluster that start at i, a cluster is a character and combining marks that follow it
+//(thai character cluster for thai)
+func nextCluster(runes []rune, i int) int {
+	j := i + 1
+	for j < len(runes) {
+		if !unicode.In(runes[j], unicode.Mn, unicode.Mc, unicode.Me) && (!isThai(runes[j]) || canBreakThai(runes, j)) {
+			break
+		}
+		j++
+	}
+	return j
+}
+
+//textWidth width of text in 1/1000 of text space unit (without horizontal scaling)
+func (c *contenteCacheText) textWidth(text string) (float64, error) {
+	runs, err := c.shape(text, isRTLParagraph(text), arabicJoiningForms([]rune(text)))
+	if err != nil {
+		return 0, errors.Wrap(err, "")
+	}
+	return c.runsWidth(runs), nil
+}
+
+//runsWidth width of shaped runs in 1/1000 of text space unit (without horizontal scaling)
+func (c *contenteCacheText) runsWidth(runs []textRun) float64 {
+	width := 0.0
+	charSpacing := c.charSpacing()
+	for _, run := range runs {
+		for _, glyph := range run.glyphs {
+			width += float64(glyph.xAdvance)
+			if !glyph.isMark {
+				width += charSpacing
+			}
+		}
+	}
+	return width
+}
+
+//maxLineWidth lineExtent() in 1/1000 of text space unit (without horizontal scaling)
+func (c *contenteCacheText) maxLineWidth() float64 {
+	return c.lineExtent() * 1000 / (c.fontSize() * c.lineScaling())
+}
+
+//lineExtent size of c.rect along line (height in vertical writing)
+func (c *contenteCacheText) lineExtent() float64 {
+	if c.isVertical() {
+		return c.rect.H
+	}
+	return c.rect.W
+}
+
+//crossExtent size of c.rect across lines (width in vertical writing)
+func (c *contenteCacheText) crossExtent() float64 {
+	if c.isVertical() {
+		return c.rect.W
+	}
+	return c.rect.H
+}
+
+//splitWords split text into words by spaces and thai word boundaries, each word include spaces that follow it
+func (c *contenteCacheText) splitWords(text string) []string {
+	var words []string
+	for _, word := range splitWordsBySpace(text) {
+		trimmed := strings.TrimRightFunc(word, unicode.IsSpace)
+		if trimmed == "" || c.thaiDict == nil {
+			words = append(words, word)
+			continue
+		}
+		subWords := c.thaiDict.split(trimmed)
+		subWords[len(subWords)-1] += word[len(trimmed):]
+		words = append(words, subWords...)
+	}
+	return words
+}
+
+//splitWordsBySpace split text into words, each word include spaces that follow it
+func splitWordsBySpace(text string) []string {
+	var words []string
+	start := 0
+	prevIsSpace := false
+	for i, r := range text {
+		isSpace := unicode.IsSpace(r)
+		if prevIsSpace && !isSpace {
+			words = append(words, text[start:i])
+			start = i
+		}
+		prevIsSpace = isSpace
+	}
+	if start < len(text) {
+		words = append(words, text[start:])
+	}
+	return words
+}
@@ -0,0 +1,607 @@
+package nxpdf
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"math"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/pkg/errors"
+)
+
+//contenteCacheRichText text of many spans (each span has own font, size and color) on shared baselines
+type contenteCacheRichText struct {
+	spans  []*contenteCacheText //text, font and option (size, color) of each span
+	rect   Position
+	option TextOption
+	lines  []richLine //result of layout()
+}
+
+//richPiece part of span in line
+type richPiece struct {
+	span  int       //index of span
+	text  string    //text of piece
+	forms []string  //joining form of each rune of text (see arabicJoiningForms)
+	runs  []textRun //result of shape() in visual order
+	width float64   //in text space unit
+}
+
+//richLine a line of rich text after layout
+type richLine struct {
+	pieces    []richPiece //in logical order, in visual order after shapeLine()
+	text      string      //source text of line (with spaces at end of line)
+	isNewLine bool        //line start after "\n" (not wrapped)
+	rtl       bool        //paragraph of line is right-to-left
+	width     float64     //in text space unit
+	ascent    float64     //max ascent of spans in line
+	descent   float64     //min descent of spans in line
+}
+
+//richParagraph text of spans between "\n"
+type richParagraph struct {
+	pieces []richPiece //in logical order
+	span   int         //index of span that paragraph start in
+}
+
+//base contenteCacheText for graphics and text state of c.option
+func (c *contenteCacheRichText) base() *contenteCacheText {
+	return &contenteCacheText{
+		fontRef: c.spans[0].fontRef,
+		ssf:     c.spans[0].ssf,
+		rect:    c.rect,
+		option:  c.option,
+	}
+}
+
+//layout split spans into lines (wrap on word boundaries of paragraph when option.Wrap) and return text that does not fit in c.rect
+func (c *contenteCacheRichText) layout() (string, error) {
+
+	c.lines = nil
+	for i, paragraph := range c.paragraphs() {
+		err := c.wrap(paragraph, i > 0)
+		if err != nil {
+			return "", errors.Wrap(err, "")
+		}
+	}
+
+	for i := range c.lines {
+		err := c.shapeLine(&c.lines[i])
+		if err != nil {
+			return "", errors.Wrap(err, "")
+		}
+	}
+
+	if c.option.Align&AlignJustify == AlignJustify && c.option.Wrap {
+		//last line of paragraph is not justified
+		for i := 0; i+1 < len(c.lines); i++ {
+			if !c.lines[i+1].isNewLine {
+				c.justify(&c.lines[i])
+			}
+		}
+	}
+
+	overflow := ""
+	if c.option.Wrap && c.rect.H > 0 {
+		//remove lines that overflow c.rect.H
+		for i := range c.lines {
+			if c.linesHeight(c.lines[:i+1]) > c.rect.H+0.001 {
+				overflow = c.linesText(c.lines[i:])
+				c.lines = c.lines[:i]
+				break
+			}
+		}
+	}
+
+	return overflow, nil
+}
+
+//shrink reduce font size of spans (in proportion to option.Size, not less than option.MinSize) and layout until text fit in c.rect,
+//return text that does not fit in c.rect at smallest size
+func (c *contenteCacheRichText) shrink() (string, error) {
+
+	minSize := c.option.MinSize
+	if minSize <= 0 {
+		minSize = defaultMinFontSize
+	}
+
+	baseSize := c.base().fontSize()
+	sizes := make([]float64, len(c.spans))
+	for i, span := range c.spans {
+		sizes[i] = span.fontSize()
+	}
+
+	for {
+		overflow, err := c.layout()
+		if err != nil {
+			return "", errors.Wrap(err, "")
+		}
+
+		fontSize := c.base().fontSize()
+		if c.isFit(overflow) || fontSize <= minSize {
+			return overflow, nil
+		}
+
+		fontSize -= shrinkStep
+		if fontSize < minSize {
+			fontSize = minSize
+		}
+		c.option.Size = fontSize
+		for i, span := range c.spans {
+			span.option.Size = sizes[i] * fontSize / baseSize
+		}
+	}
+}
+
+//isFit all lines are in c.rect
+func (c *contenteCacheRichText) isFit(overflow string) bool {
+
+	if overflow != "" {
+		return false
+	}
+
+	if c.rect.W > 0 {
+		for _, line := range c.lines {
+			if line.width > c.rect.W+0.001 {
+				return false
+			}
+		}
+	}
+
+	return c.rect.H <= 0 || c.linesHeight(c.lines) <= c.rect.H+0.001
+}
+
+//addGlyphs add characters of spans and shaped glyphs of lines to subset fonts,
+//call it after layout is success so failed insertion does not change subset fonts
+func (c *contenteCacheRichText) addGlyphs() {
+	for _, span := range c.spans {
+		span.addGlyphs()
+	}
+	for _, line := range c.lines {
+		for _, piece := range line.pieces {
+			for _, run := range piece.runs {
+				run.ssf.addShapedGlyphs(run.glyphs)
+			}
+		}
+	}
+}
+
+//paragraphs split text of spans by "\n"
+func (c *contenteCacheRichText) paragraphs() []richParagraph {
+	paragraphs := []richParagraph{{span: 0}}
+	for i, span := range c.spans {
+		for j, rawParagraph := range strings.Split(span.textRaw, "\n") {
+			if j > 0 {
+				paragraphs = append(paragraphs, richParagraph{span: i})
+			}
+			text := strings.TrimSuffix(rawParagraph, "\r")
+			if text != "" {
+				last := &paragraphs[len(paragraphs)-1]
+				last.pieces = append(last.pieces, richPiece{span: i, text: text})
+			}
+		}
+	}
+	return paragraphs
+}
+
+//wrap split paragraph into lines that fit in c.rect.W (when option.Wrap), line can be broken at word boundaries
+//of whole paragraph only (not at boundaries of spans that are in a word)
+func (c *contenteCacheRichText) wrap(paragraph richParagraph, isNewLine bool) error {
+
+	text := piecesText(paragraph.pieces)
+	rtl := isRTLParagraph(text)
+	forms := arabicJoiningForms([]rune(text))
+	rest := make([]richPiece, len(paragraph.pieces))
+	offset := 0
+	for i, piece := range paragraph.pieces {
+		size := utf8.RuneCountInString(piece.text)
+		piece.forms = forms[offset : offset+size]
+		rest[i] = piece
+		offset += size
+	}
+
+	words := []string{text}
+	if c.option.Wrap && c.rect.W > 0 {
+		words = c.spans[paragraph.span].splitWords(text)
+	}
+
+	line := c.newLine(paragraph.span, isNewLine, rtl)
+	lineWidth := 0.0 //width of line (with spaces at end of line)
+	for _, word := range words {
+		var wordPieces []richPiece
+		wordPieces, rest = splitPieces(rest, len(word))
+		width, err := c.piecesWidth(wordPieces)
+		if err != nil {
+			return errors.Wrap(err, "")
+		}
+		trimmedWidth, err := c.piecesWidth(trimPiecesRight(wordPieces))
+		if err != nil {
+			return errors.Wrap(err, "")
+		}
+		if c.option.Wrap && c.rect.W > 0 && len(line.pieces) > 0 && lineWidth+trimmedWidth > c.rect.W+0.001 {
+			c.lines = append(c.lines, line)
+			line = c.newLine(wordPieces[0].span, false, rtl)
+			lineWidth = 0
+		}
+		for _, piece := range wordPieces {
+			line.addPiece(piece, c.spans[piece.span])
+		}
+		lineWidth += width
+	}
+	c.lines = append(c.lines, line)
+
+	return nil
+}
+
+//newLine create line that has ascent and descent of span at spanIndex (for empty line)
+func (c *contenteCacheRichText) newLine(spanIndex int, isNewLine bool, rtl bool) richLine {
+	ascent, descent := c.spans[spanIndex].ascentAndDescent()
+	return richLine{isNewLine: isNewLine, rtl: rtl, ascent: ascent, descent: descent}
+}
+
+//addPiece add piece of span to end of line
+func (r *richLine) addPiece(piece richPiece, span *contenteCacheText) {
+	r.text += piece.text
+	if len(r.pieces) > 0 && r.pieces[len(r.pieces)-1].span == piece.span {
+		last := &r.pieces[len(r.pieces)-1]
+		last.text += piece.text
+		last.forms = append(append([]string{}, last.forms...), piece.forms...)
+	} else {
+		r.pieces = append(r.pieces, piece)
+	}
+	ascent, descent := span.ascentAndDescent()
+	if ascent > r.ascent {
+		r.ascent = ascent
+	}
+	if descent < r.descent {
+		r.descent = descent
+	}
+}
+
+//piecesText text of pieces
+func piecesText(pieces []richPiece) string {
+	var buff bytes.Buffer
+	for _, piece := range pieces {
+		buff.WriteString(piece.text)
+	}
+	return buff.String()
+}
+
+//splitPieces split pieces at offset (in byte) of text of pieces, return pieces before and after offset
+func splitPieces(pieces []richPiece, offset int) ([]richPiece, []richPiece) {
+	var before []richPiece
+	for len(pieces) > 0 && offset > 0 {
+		piece := pieces[0]
+		if len(piece.text) > offset {
+			size := utf8.RuneCountInString(piece.text[:offset])
+			head, tail := piece, piece
+			head.text, head.forms = piece.text[:offset], piece.forms[:size]
+			tail.text, tail.forms = piece.text[offset:], piece.forms[size:]
+			return append(before, head), append([]richPiece{tail}, pieces[1:]...)
+		}
+		before = append(before, piece)
+		offset -= len(piece.text)
+		pieces = pieces[1:]
+	}
+	return before, pieces
+}
+
+//trimPiecesRight remove spaces at end of pieces (pieces that have only spaces are removed)
+func trimPiecesRight(pieces []richPiece) []richPiece {
+	for len(pieces) > 0 {
+		last := pieces[len(pieces)-1]
+		last.text = strings.TrimRightFunc(last.text, unicode.IsSpace)
+		if last.text != "" {
+			last.forms = last.forms[:utf8.RuneCountInString(last.text)]
+			return append(append([]richPiece{}, pieces[:len(pieces)-1]...), last)
+		}
+		pieces = pieces[:len(pieces)-1]
+	}
+	return nil
+}
+
+//piecesWidth width of pieces in font and size of their span (in text space unit)
+func (c *contenteCacheRichText) piecesWidth(pieces []richPiece) (float64, error) {
+	width := 0.0
+	for _, piece := range pieces {
+		pieceWidth, err := c.spanTextWidth(piece.span, piece.text)
+		if err != nil {
+			return 0, errors.Wrap(err, "")
+		}
+		width += pieceWidth
+	}
+	return width, nil
+}
+
+//shapeLine remove spaces at end of line, shape pieces by bidi runs of whole line
+//and reorder them (pieces of line are in visual order after shaping)
+func (c *contenteCacheRichText) shapeLine(line *richLine) error {
+
+	pieces := trimPiecesRight(line.pieces)
+
+	var runs []textRun
+	var runSpans []int //index of span of each run
+	for _, bidiRun := range splitBidiRuns(piecesText(pieces), line.rtl) {
+		var runPieces []richPiece
+		runPieces, pieces = splitPieces(pieces, len(bidiRun.text))
+		for _, piece := range runPieces {
+			pieceRuns, err := c.spans[piece.span].shapeBidiRun(piece.text, bidiRun.level, piece.forms)
+			if err != nil {
+				return errors.Wrapf(err, "shapeBidiRun(%s) fail", piece.text)
+			}
+			for _, run := range pieceRuns {
+				runs = append(runs, run)
+				runSpans = append(runSpans, piece.span)
+			}
+		}
+	}
+
+	levels := make([]int, len(runs))
+	for i, run := range runs {
+		levels[i] = run.level
+	}
+	line.pieces = nil
+	for _, i := range visualOrder(levels) {
+		run := runs[i]
+		if len(line.pieces) == 0 || line.pieces[len(line.pieces)-1].span != runSpans[i] {
+			line.pieces = append(line.pieces, richPiece{span: runSpans[i]})
+		}
+		last := &line.pieces[len(line.pieces)-1]
+		last.text += run.text
+		last.runs = append(last.runs, run)
+	}
+
+	c.updateLineWidth(line)
+	return nil
+}
+
+//justify add space to spaces between words of line, so line fill c.rect.W,
+//space of each gap is rounded and the rest is added to the last gap
+func (c *contenteCacheRichText) justify(line *richLine) {
+
+	count := 0
+	for _, piece := range line.pieces {
+		count += len(spaceGlyphs(piece.runs))
+	}
+	extra := c.rect.W - line.width
+	if count == 0 || extra <= 0 {
+		return
+	}
+
+	var last *shapedGlyph //space of the last gap
+	lastPiece := 0
+	for i := range line.pieces {
+		piece := &line.pieces[i]
+		span := c.spans[piece.span]
+		//extra space of each space in 1/1000 of text space unit of span
+		space := int(math.Round(extra / float64(count) * 1000 / (span.fontSize() * span.lineScaling())))
+		for _, glyph := range spaceGlyphs(piece.runs) {
+			glyph.xAdvance += space
+			last, lastPiece = glyph, i
+		}
+	}
+	c.updateLineWidth(line)
+
+	span := c.spans[line.pieces[lastPiece].span]
+	last.xAdvance += int(math.Round((c.rect.W - line.width) * 1000 / (span.fontSize() * span.lineScaling())))
+	c.updateLineWidth(line)
+}
+
+//updateLineWidth update width of pieces of line and width of line from their runs
+func (c *contenteCacheRichText) updateLineWidth(line *richLine) {
+	line.width = 0
+	for i := range line.pieces {
+		piece := &line.pieces[i]
+		span := c.spans[piece.span]
+		piece.width = span.runsWidth(piece.runs) * span.fontSize() / 1000.0 * span.lineScaling()
+		line.width += piece.width
+	}
+}
+
+//spanTextWidth width of text in font and size of span at spanIndex (in text space unit)
+func (c *contenteCacheRichText) spanTextWidth(spanIndex int, text string) (float64, error) {
+	span := c.spans[spanIndex]
+	width, err := span.textWidth(text)
+	if err != nil {
+		return 0, errors.Wrapf(err, "span.textWidth(%s) fail", text)
+	}
+	return width * span.fontSize() / 1000.0 * span.lineScaling(), nil
+}
+
+//lineGap distance from baseline of lines[i-1] to baseline of lines[i]
+func (c *contenteCacheRichText) lineGap(lines []richLine, i int) float64 {
+	if c.option.LineHeight > 0 {
+		return c.option.LineHeight
+	}
+	return lines[i].ascent - lines[i-1].descent
+}
+
+//linesHeight height from top of first line to bottom of last line
+func (c *contenteCacheRichText) linesHeight(lines []richLine) float64 {
+	if len(lines) == 0 {
+		return 0
+	}
+	height := lines[0].ascent - lines[len(lines)-1].descent
+	for i := 1; i < len(lines); i++ {
+		height += c.lineGap(lines, i)
+	}
+	return height
+}
+
+//linesText source text of lines
+func (c *contenteCacheRichText) linesText(lines []richLine) string {
+	var buff bytes.Buffer
+	for i, line := range lines {
+		if i > 0 && line.isNewLine {
+			buff.WriteString("\n")
+		}
+		buff.WriteString(line.text)
+	}
+	return buff.String()
+}
+
+//baselines y of baseline of each line in c.rect
+func (c *contenteCacheRichText) baselines() []float64 {
+
+	if len(c.lines) == 0 {
+		return nil
+	}
+
+	height := c.linesHeight(c.lines)
+	first := c.lines[0]
+	y := c.rect.Y + c.rect.H - first.ascent //AlignTop
+	if c.option.Align&AlignBottom == AlignBottom {
+		y = c.rect.Y + height - first.ascent
+	} else if c.option.Align&AlignMiddle == AlignMiddle {
+		y = c.rect.Y + (c.rect.H+height)/2 - first.ascent
+	}
+
+	baselines := []float64{y}
+	for i := 1; i < len(c.lines); i++ {
+		y -= c.lineGap(c.lines, i)
+		baselines = append(baselines, y)
+	}
+	return baselines
+}
+
+//lineX x of start of line in c.rect (right-to-left line is aligned right if option.Align has no horizontal alignment)
+func (c *contenteCacheRichText) lineX(line *richLine) float64 {
+	align := c.option.Align
+	if align&(AlignLeft|AlignRight|AlignCenter) == 0 && line.rtl {
+		align |= AlignRight
+	}
+	if align&AlignRight == AlignRight {
+		return c.rect.X + c.rect.W - line.width
+	} else if align&AlignCenter == AlignCenter {
+		return c.rect.X + (c.rect.W-line.width)/2
+	}
+	return c.rect.X
+}
+
+func (c *contenteCacheRichText) layer() int {
+	return c.option.Layer
+}
+
+func (c *contenteCacheRichText) build(w io.Writer, info *pageInfo) (int64, error) {
+
+	base := c.base()
+	hasState := base.hasState()
+	for _, span := range c.spans {
+		if span.option.FillColor != nil {
+			hasState = true
+		}
+	}
+
+	var buff bytes.Buffer
+	if hasState {
+		buff.WriteString("q\n")
+		err := base.writeColors(&buff)
+		if err != nil {
+			return 0, errors.Wrap(err, "")
+		}
+		base.writeTransform(&buff)
+	}
+	buff.WriteString("BT\n")
+	if hasState {
+		base.writeTextState(&buff)
+	}
+
+	currFontRef := FontRefEmpty
+	currSize := 0.0
+	currColor := c.option.FillColor
+	prevX, prevY := 0.0, 0.0
+	baselines := c.baselines()
+	for i, line := range c.lines {
+		x := round2(c.lineX(&line))
+		y := round2(baselines[i])
+		for _, piece := range line.pieces {
+			span := c.spans[piece.span]
+			fontSize := span.fontSize()
+			if span.fontRef != currFontRef || fontSize != currSize {
+				fontResName, err := info.fontResName(span.fontRef)
+				if err != nil {
+					return 0, errors.Wrapf(err, "info.fontResName(%s) fail", span.fontRef)
+				}
+				buff.WriteString(fmt.Sprintf("/%s %0.2f Tf\n", fontResName, fontSize))
+				currFontRef, currSize = span.fontRef, fontSize
+			}
+			err := writeColorChange(&buff, currColor, span.option.FillColor)
+			if err != nil {
+				return 0, errors.Wrap(err, "")
+			}
+			currColor = span.option.FillColor
+
+			buff.WriteString(fmt.Sprintf("%0.2f %0.2f TD\n", x-prevX, y-prevY))
+			prevX, prevY = x, y
+			err = span.writeRuns(&buff, piece.runs, info, &currFontRef)
+			if err != nil {
+				return 0, errors.Wrap(err, "")
+			}
+			x = round2(x + piece.width)
+		}
+	}
+	buff.WriteString("ET\n")
+
+	err := c.writeDecorations(&buff, baselines, currColor)
+	if err != nil {
+		return 0, errors.Wrap(err, "")
+	}
+	if hasState {
+		buff.WriteString("Q\n")
+	}
+
+	return buff.WriteTo(w)
+}
+
+//writeDecorations write underline and strikeout of each piece (in color of its span)
+func (c *contenteCacheRichText) writeDecorations(buff *bytes.Buffer, baselines []float64, currColor *Color) error {
+	for i, line := range c.lines {
+		x := c.lineX(&line)
+		for _, piece := range line.pieces {
+			span := c.spans[piece.span]
+			if rules := span.decorationRules(); len(rules) > 0 && piece.width > 0 {
+				err := writeColorChange(buff, currColor, span.option.FillColor)
+				if err != nil {
+					return errors.Wrap(err, "")
+				}
+				currColor = span.option.FillColor
+				writeRules(buff, rules, x, baselines[i], piece.width)
+			}
+			x += piece.width
+		}
+	}
+	return nil
+}
+
+//writeColorChange write fill color if color is not same as curr (nil is black)
+func writeColorChange(buff *bytes.Buffer, curr *Color, color *Color) error {
+	if isSameColor(curr, color) {
+		return nil
+	}
+	if color == nil {
+		color = ColorGray(0)
+	}
+	op, err := colorOperator(color, false)
+	if err != nil {
+		return errors.Wrap(err, "")
+	}
+	buff.WriteString(op)
+	return nil
+}
+
+func isSameColor(a *Color, b *Color) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	if a.Space != b.Space || len(a.Values) != len(b.Values) {
+		return false
+	}
+	for i := range a.Values {
+		if a.Values[i] != b.Values[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -22,3 +22,33 @@ var ErrKeyNameNotFound = errors.New("keyname not found")
 
 //ErrStreamNotFound stream not found
 var ErrStreamNotFound = errors.New("stream not found")
+
+//ErrInvalidColor color space or number of values of color is wrong
+var ErrInvalidColor = errors.New("invalid color")
+
+//ErrInvalidRenderMode text render mode is not 0 to 7
+var ErrInvalidRenderMode = errors.New("invalid render mode")
+
+//ErrInvalidMatrix matrix can not be inverted
+var ErrInvalidMatrix = errors.New("invalid matrix")
+
+//ErrWritingModeMismatch font and its fallback font are not both vertical or both horizontal
+var ErrWritingModeMismatch = errors.New("writing mode of font and fallback font mismatch")
+
+//ErrNoTextSpan rich text has no span
+var ErrNoTextSpan = errors.New("no text span")
+
+//ErrInvalidLayer layer is not LayerOverlay or LayerUnderlay
+var ErrInvalidLayer = errors.New("invalid layer")
+
+//ErrInvalidUnit unit is not UnitPT, UnitMM, UnitCM or UnitInch
+var ErrInvalidUnit = errors.New("invalid unit")
+
+//ErrInvalidOrigin origin is not OriginBottomLeft or OriginTopLeft
+var ErrInvalidOrigin = errors.New("invalid origin")
+
+//ErrPageNotFound page index is out of range
+var ErrPageNotFound = errors.New("page not found")
+
+//ErrInvalidPageBox MediaBox or CropBox of page is not array of 4 numbers
+var ErrInvalidPageBox = errors.New("invalid page box")
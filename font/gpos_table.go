@@ -0,0 +1,129 @@
+package font
+
+//GPOS lookup type https://www.microsoft.com/typography/otspec/gpos.htm
+const (
+	GPOSLookupTypeSingle       = 1
+	GPOSLookupTypePair         = 2
+	GPOSLookupTypeCursive      = 3
+	GPOSLookupTypeMarkToBase   = 4
+	GPOSLookupTypeMarkToLig    = 5
+	GPOSLookupTypeMarkToMark   = 6
+	GPOSLookupTypeContext      = 7
+	GPOSLookupTypeChainContext = 8
+	GPOSLookupTypeExtension    = 9
+)
+
+//GPOSTable glyph positioning table https://www.microsoft.com/typography/otspec/gpos.htm
+type GPOSTable struct {
+	LayoutTable
+	Lookups []GPOSLookup
+}
+
+//GPOSLookup lookup of GPOS, type of Subtables depend on Type
+//(*SinglePos, *PairPos, *MarkBasePos, *MarkLigPos or *ChainContext), subtable that not support is nil
+type GPOSLookup struct {
+	Type             uint
+	Flag             uint
+	MarkFilteringSet uint
+	Subtables        []interface{}
+}
+
+//ValueRecord positioning value (in font unit)
+type ValueRecord struct {
+	XPlacement int
+	YPlacement int
+	XAdvance   int
+	YAdvance   int
+}
+
+//SinglePos single adjustment positioning subtable, map[glyph]value
+type SinglePos struct {
+	Values map[uint]ValueRecord
+}
+
+//PairValue values of first and second glyph in pair
+type PairValue struct {
+	First  ValueRecord
+	Second ValueRecord
+}
+
+//PairPos pair adjustment positioning subtable
+type PairPos struct {
+	Format   uint
+	Coverage Coverage
+	//format 1: map[first glyph]map[second glyph]value
+	Pairs map[uint]map[uint]PairValue
+	//format 2: ClassValues[class of first glyph][class of second glyph]
+	ClassDef1   ClassDef
+	ClassDef2   ClassDef
+	ClassValues [][]PairValue
+}
+
+//Value value of pair of glyph, in format 2, second glyph that is class 0 (not in ClassDef2) is not matched
+//so that next subtable can be tried
+func (p *PairPos) Value(first uint, second uint) (PairValue, bool) {
+	if _, ok := p.Coverage.Index(first); !ok {
+		return PairValue{}, false
+	}
+	if p.Format == 1 {
+		value, ok := p.Pairs[first][second]
+		return value, ok
+	}
+	class1 := p.ClassDef1.Class(first)
+	class2 := p.ClassDef2.Class(second)
+	if class2 == 0 {
+		return PairValue{}, false
+	}
+	if int(class1) >= len(p.ClassValues) || int(class2) >= len(p.ClassValues[class1]) {
+		return PairValue{}, false
+	}
+	return p.ClassValues[class1][class2], true
+}
+
+//Kerning values of pair of glyph from pair adjustment lookups of feature kern in script
+//(or script DFLT if font has no script) and its default language system.
+//YPlacement, YAdvance and device tables of values, lookup flag and other lookup types of feature kern are not supported.
+func (g *GPOSTable) Kerning(first uint, second uint, script string) (PairValue, bool) {
+	for _, lookupIndex := range g.LookupIndexes(script, "", []string{"kern"}) {
+		if int(lookupIndex) >= len(g.Lookups) {
+			continue
+		}
+		for _, subtable := range g.Lookups[lookupIndex].Subtables {
+			pairPos, ok := subtable.(*PairPos)
+			if !ok {
+				continue
+			}
+			if value, ok := pairPos.Value(first, second); ok {
+				return value, true
+			}
+		}
+	}
+	return PairValue{}, false
+}
+
+//Anchor attachment point (in font unit)
+type Anchor struct {
+	X, Y int
+}
+
+//MarkRecord class and anchor of mark
+type MarkRecord struct {
+	Class  uint
+	Anchor Anchor
+}
+
+//MarkBasePos mark-to-base (or mark-to-mark, base is mark2) attachment positioning subtable
+type MarkBasePos struct {
+	MarkCoverage Coverage
+	BaseCoverage Coverage
+	Marks        []MarkRecord //by index of MarkCoverage
+	Bases        [][]*Anchor  //by index of BaseCoverage then mark class, nil if no anchor
+}
+
+//MarkLigPos mark-to-ligature attachment positioning subtable
+type MarkLigPos struct {
+	MarkCoverage     Coverage
+	LigatureCoverage Coverage
+	Marks            []MarkRecord  //by index of MarkCoverage
+	Ligatures        [][][]*Anchor //by index of LigatureCoverage, component then mark class, nil if no anchor
+}
@@ -0,0 +1,48 @@
+package font
+
+//GSUB lookup type https://www.microsoft.com/typography/otspec/gsub.htm
+const (
+	GSUBLookupTypeSingle       = 1
+	GSUBLookupTypeMultiple     = 2
+	GSUBLookupTypeAlternate    = 3
+	GSUBLookupTypeLigature     = 4
+	GSUBLookupTypeContext      = 5
+	GSUBLookupTypeChainContext = 6
+	GSUBLookupTypeExtension    = 7
+)
+
+//GSUBTable glyph substitution table https://www.microsoft.com/typography/otspec/gsub.htm
+type GSUBTable struct {
+	LayoutTable
+	Lookups []GSUBLookup
+}
+
+//GSUBLookup lookup of GSUB, type of Subtables depend on Type
+//(*SingleSubst, *MultipleSubst, *LigatureSubst or *ChainContext), subtable that not support is nil
+type GSUBLookup struct {
+	Type             uint
+	Flag             uint
+	MarkFilteringSet uint
+	Subtables        []interface{}
+}
+
+//SingleSubst single substitution subtable, map[glyph]substitute glyph
+type SingleSubst struct {
+	Substitutes map[uint]uint
+}
+
+//MultipleSubst multiple substitution subtable, map[glyph]sequence of substitute glyphs
+type MultipleSubst struct {
+	Sequences map[uint][]uint
+}
+
+//Ligature ligature glyph and components (without first component)
+type Ligature struct {
+	Glyph      uint
+	Components []uint
+}
+
+//LigatureSubst ligature substitution subtable, map[first component]ligatures (in order of preference)
+type LigatureSubst struct {
+	Ligatures map[uint][]Ligature
+}
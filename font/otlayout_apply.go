@@ -0,0 +1,458 @@
+package font
+
+//maxNestingLevel max depth of lookup that called from contextual lookup
+const maxNestingLevel = 8
+
+//GlyphInfo glyph in shaping, XAdvance, XOffset and YOffset are in font unit
+type GlyphInfo struct {
+	Glyph    uint
+	Cluster  int //index of source (ex. rune) that glyph come from
+	XAdvance int
+	XOffset  int
+	YOffset  int
+}
+
+//ApplyGSUB apply GSUB lookups of features in script and language to glyphs
+func (t *TTFParser) ApplyGSUB(glyphs []GlyphInfo, script string, lang string, features []string) []GlyphInfo {
+	if t.gsub == nil {
+		return glyphs
+	}
+	a := otApplier{
+		gdef:   t.gdef,
+		gsub:   t.gsub,
+		glyphs: glyphs,
+	}
+	for _, lookupIndex := range t.gsub.LookupIndexes(script, lang, features) {
+		a.applyLookup(lookupIndex)
+	}
+	return a.glyphs
+}
+
+//ApplyGPOS apply GPOS lookups of features in script and language to glyphs,
+//XAdvance of glyphs must be set before call (advance of mark glyphs in GDEF are set to zero)
+func (t *TTFParser) ApplyGPOS(glyphs []GlyphInfo, script string, lang string, features []string) []GlyphInfo {
+	if t.gpos == nil {
+		return glyphs
+	}
+	if t.gdef != nil {
+		for i := range glyphs {
+			if t.gdef.GlyphClassDef.Class(glyphs[i].Glyph) == GlyphClassMark {
+				glyphs[i].XAdvance = 0
+			}
+		}
+	}
+	a := otApplier{
+		gdef:   t.gdef,
+		gpos:   t.gpos,
+		glyphs: glyphs,
+	}
+	for _, lookupIndex := range t.gpos.LookupIndexes(script, lang, features) {
+		a.applyLookup(lookupIndex)
+	}
+	return a.glyphs
+}
+
+//otApplier apply lookups of GSUB or GPOS (only one of gsub and gpos is set)
+type otApplier struct {
+	gdef             *GDEFTable
+	gsub             *GSUBTable
+	gpos             *GPOSTable
+	glyphs           []GlyphInfo
+	flag             uint //lookup flag of current lookup
+	markFilteringSet uint
+}
+
+func (a *otApplier) lookup(lookupIndex uint) (lookupType uint, flag uint, markFilteringSet uint, subtables []interface{}, ok bool) {
+	if a.gsub != nil && int(lookupIndex) < len(a.gsub.Lookups) {
+		l := a.gsub.Lookups[lookupIndex]
+		return l.Type, l.Flag, l.MarkFilteringSet, l.Subtables, true
+	}
+	if a.gpos != nil && int(lookupIndex) < len(a.gpos.Lookups) {
+		l := a.gpos.Lookups[lookupIndex]
+		return l.Type, l.Flag, l.MarkFilteringSet, l.Subtables, true
+	}
+	return 0, 0, 0, nil, false
+}
+
+//applyLookup apply lookup to all glyphs
+func (a *otApplier) applyLookup(lookupIndex uint) {
+	_, flag, markFilteringSet, _, ok := a.lookup(lookupIndex)
+	if !ok {
+		return
+	}
+	i := 0
+	for i < len(a.glyphs) {
+		a.flag, a.markFilteringSet = flag, markFilteringSet
+		if a.skip(a.glyphs[i].Glyph) {
+			i++
+			continue
+		}
+		applied, next := a.applyLookupAt(lookupIndex, i, 0)
+		if applied {
+			i = next
+		} else {
+			i++
+		}
+	}
+}
+
+//applyLookupAt apply first subtable of lookup that match glyph at i, return position of next glyph
+func (a *otApplier) applyLookupAt(lookupIndex uint, i int, depth int) (bool, int) {
+
+	lookupType, flag, markFilteringSet, subtables, ok := a.lookup(lookupIndex)
+	if !ok || depth > maxNestingLevel || i >= len(a.glyphs) {
+		return false, i + 1
+	}
+
+	prevFlag, prevMarkFilteringSet := a.flag, a.markFilteringSet
+	a.flag, a.markFilteringSet = flag, markFilteringSet
+	defer func() {
+		a.flag, a.markFilteringSet = prevFlag, prevMarkFilteringSet
+	}()
+
+	for _, subtable := range subtables {
+		var applied bool
+		var next int
+		switch s := subtable.(type) {
+		case *SingleSubst:
+			applied, next = a.applySingleSubst(s, i)
+		case *MultipleSubst:
+			applied, next = a.applyMultipleSubst(s, i)
+		case *LigatureSubst:
+			applied, next = a.applyLigatureSubst(s, i)
+		case *SinglePos:
+			applied, next = a.applySinglePos(s, i)
+		case *PairPos:
+			applied, next = a.applyPairPos(s, i)
+		case *MarkBasePos:
+			applied, next = a.applyMarkBasePos(s, i, lookupType == GPOSLookupTypeMarkToMark)
+		case *MarkLigPos:
+			applied, next = a.applyMarkLigPos(s, i)
+		case *ChainContext:
+			applied, next = a.applyChainContext(s, i, depth)
+		}
+		if applied {
+			return true, next
+		}
+	}
+	return false, i + 1
+}
+
+//skip glyph is ignored by lookup flag
+func (a *otApplier) skip(glyph uint) bool {
+	if a.gdef == nil {
+		return false
+	}
+	class := a.gdef.GlyphClassDef.Class(glyph)
+	switch {
+	case class == GlyphClassBase && a.flag&LookupFlagIgnoreBaseGlyphs != 0:
+		return true
+	case class == GlyphClassLigature && a.flag&LookupFlagIgnoreLigatures != 0:
+		return true
+	case class == GlyphClassMark && a.flag&LookupFlagIgnoreMarks != 0:
+		return true
+	}
+	if class != GlyphClassMark {
+		return false
+	}
+	if a.flag&LookupFlagUseMarkFilteringSet != 0 && int(a.markFilteringSet) < len(a.gdef.MarkGlyphSets) {
+		_, ok := a.gdef.MarkGlyphSets[a.markFilteringSet].Index(glyph)
+		return !ok
+	}
+	if markAttachType := (a.flag & LookupFlagMarkAttachmentType) >> 8; markAttachType != 0 {
+		return a.gdef.MarkAttachClassDef.Class(glyph) != markAttachType
+	}
+	return false
+}
+
+//isMark glyph is mark in GDEF (or in markCoverage if font has no GDEF)
+func (a *otApplier) isMark(glyph uint, markCoverage Coverage) bool {
+	if a.gdef != nil {
+		return a.gdef.GlyphClassDef.Class(glyph) == GlyphClassMark
+	}
+	_, ok := markCoverage.Index(glyph)
+	return ok
+}
+
+//matchSequence find positions of count glyphs (that not skipped) start from i in direction dir (1 or -1)
+func (a *otApplier) matchSequence(i int, dir int, count int, match func(k int, glyph uint) bool) ([]int, bool) {
+	var positions []int
+	for k := 0; k < count; k++ {
+		for i >= 0 && i < len(a.glyphs) && a.skip(a.glyphs[i].Glyph) {
+			i += dir
+		}
+		if i < 0 || i >= len(a.glyphs) || !match(k, a.glyphs[i].Glyph) {
+			return nil, false
+		}
+		positions = append(positions, i)
+		i += dir
+	}
+	return positions, true
+}
+
+func (a *otApplier) applySingleSubst(s *SingleSubst, i int) (bool, int) {
+	glyph, ok := s.Substitutes[a.glyphs[i].Glyph]
+	if !ok {
+		return false, i + 1
+	}
+	a.glyphs[i].Glyph = glyph
+	return true, i + 1
+}
+
+func (a *otApplier) applyMultipleSubst(s *MultipleSubst, i int) (bool, int) {
+	sequence, ok := s.Sequences[a.glyphs[i].Glyph]
+	if !ok {
+		return false, i + 1
+	}
+	replaces := make([]GlyphInfo, len(sequence))
+	for k, glyph := range sequence {
+		replaces[k] = a.glyphs[i]
+		replaces[k].Glyph = glyph
+	}
+	a.replace(i, i+1, replaces)
+	return true, i + len(replaces)
+}
+
+func (a *otApplier) applyLigatureSubst(s *LigatureSubst, i int) (bool, int) {
+	ligatures, ok := s.Ligatures[a.glyphs[i].Glyph]
+	if !ok {
+		return false, i + 1
+	}
+	for _, ligature := range ligatures {
+		components := ligature.Components
+		positions, ok := a.matchSequence(i+1, 1, len(components), func(k int, glyph uint) bool {
+			return glyph == components[k]
+		})
+		if !ok {
+			continue
+		}
+		a.glyphs[i].Glyph = ligature.Glyph
+		for k := len(positions) - 1; k >= 0; k-- {
+			a.replace(positions[k], positions[k]+1, nil)
+		}
+		return true, i + 1
+	}
+	return false, i + 1
+}
+
+func (a *otApplier) applySinglePos(s *SinglePos, i int) (bool, int) {
+	value, ok := s.Values[a.glyphs[i].Glyph]
+	if !ok {
+		return false, i + 1
+	}
+	a.applyValue(i, value)
+	return true, i + 1
+}
+
+func (a *otApplier) applyValue(i int, value ValueRecord) {
+	a.glyphs[i].XOffset += value.XPlacement
+	a.glyphs[i].YOffset += value.YPlacement
+	a.glyphs[i].XAdvance += value.XAdvance
+}
+
+func (a *otApplier) applyPairPos(s *PairPos, i int) (bool, int) {
+
+	positions, ok := a.matchSequence(i+1, 1, 1, func(k int, glyph uint) bool { return true })
+	if !ok {
+		return false, i + 1
+	}
+	j := positions[0]
+
+	value, ok := s.Value(a.glyphs[i].Glyph, a.glyphs[j].Glyph)
+	if !ok {
+		return false, i + 1
+	}
+	a.applyValue(i, value.First)
+	a.applyValue(j, value.Second)
+	if value.Second == (ValueRecord{}) {
+		return true, j //second glyph can be first glyph of next pair
+	}
+	return true, j + 1
+}
+
+func (a *otApplier) applyMarkBasePos(s *MarkBasePos, i int, isMarkToMark bool) (bool, int) {
+
+	markIdx, ok := s.MarkCoverage.Index(a.glyphs[i].Glyph)
+	if !ok || markIdx >= len(s.Marks) {
+		return false, i + 1
+	}
+
+	//find base (previous glyph that is not mark) or mark2 (previous glyph that not skipped)
+	j := i - 1
+	for j >= 0 {
+		glyph := a.glyphs[j].Glyph
+		if isMarkToMark && !a.skip(glyph) {
+			break
+		} else if !isMarkToMark && !a.isMark(glyph, s.MarkCoverage) {
+			break
+		}
+		j--
+	}
+	if j < 0 {
+		return false, i + 1
+	}
+
+	baseIdx, ok := s.BaseCoverage.Index(a.glyphs[j].Glyph)
+	if !ok || baseIdx >= len(s.Bases) {
+		return false, i + 1
+	}
+
+	mark := s.Marks[markIdx]
+	if int(mark.Class) >= len(s.Bases[baseIdx]) || s.Bases[baseIdx][mark.Class] == nil {
+		return false, i + 1
+	}
+
+	a.attach(i, j, *s.Bases[baseIdx][mark.Class], mark.Anchor)
+	return true, i + 1
+}
+
+func (a *otApplier) applyMarkLigPos(s *MarkLigPos, i int) (bool, int) {
+
+	markIdx, ok := s.MarkCoverage.Index(a.glyphs[i].Glyph)
+	if !ok || markIdx >= len(s.Marks) {
+		return false, i + 1
+	}
+
+	j := i - 1
+	for j >= 0 && a.isMark(a.glyphs[j].Glyph, s.MarkCoverage) {
+		j--
+	}
+	if j < 0 {
+		return false, i + 1
+	}
+
+	ligIdx, ok := s.LigatureCoverage.Index(a.glyphs[j].Glyph)
+	if !ok || ligIdx >= len(s.Ligatures) || len(s.Ligatures[ligIdx]) == 0 {
+		return false, i + 1
+	}
+
+	//attach to last component
+	components := s.Ligatures[ligIdx]
+	anchors := components[len(components)-1]
+	mark := s.Marks[markIdx]
+	if int(mark.Class) >= len(anchors) || anchors[mark.Class] == nil {
+		return false, i + 1
+	}
+
+	a.attach(i, j, *anchors[mark.Class], mark.Anchor)
+	return true, i + 1
+}
+
+//attach set offset of mark at i so markAnchor is on baseAnchor of glyph at j
+func (a *otApplier) attach(i int, j int, baseAnchor Anchor, markAnchor Anchor) {
+	xOffset := a.glyphs[j].XOffset + baseAnchor.X - markAnchor.X
+	for k := j; k < i; k++ {
+		xOffset -= a.glyphs[k].XAdvance
+	}
+	a.glyphs[i].XOffset = xOffset
+	a.glyphs[i].YOffset = a.glyphs[j].YOffset + baseAnchor.Y - markAnchor.Y
+}
+
+func (a *otApplier) applyChainContext(s *ChainContext, i int, depth int) (bool, int) {
+	positions, records, ok := a.matchChainContext(s, i)
+	if !ok {
+		return false, i + 1
+	}
+
+	end := positions[len(positions)-1] + 1
+	for _, record := range records {
+		if int(record.SequenceIndex) >= len(positions) {
+			continue
+		}
+		size := len(a.glyphs)
+		a.applyLookupAt(record.LookupIndex, positions[record.SequenceIndex], depth+1)
+		delta := len(a.glyphs) - size
+		if delta == 0 {
+			continue
+		}
+		//glyphs was inserted or removed, move positions that follow
+		for k := int(record.SequenceIndex) + 1; k < len(positions); k++ {
+			positions[k] += delta
+		}
+		end += delta
+	}
+
+	if end <= i {
+		end = i + 1
+	}
+	return true, end
+}
+
+//matchChainContext match rule of s at i, return positions of input glyphs and lookup records of rule
+func (a *otApplier) matchChainContext(s *ChainContext, i int) ([]int, []LookupRecord, bool) {
+
+	glyph := a.glyphs[i].Glyph
+	switch s.Format {
+	case 1, 2:
+		if _, ok := s.Coverage.Index(glyph); !ok {
+			return nil, nil, false
+		}
+		key := glyph
+		if s.Format == 2 {
+			key = s.InputClassDef.Class(glyph)
+		}
+		for _, rule := range s.RuleSets[key] {
+			positions, ok := a.matchSequence(i+1, 1, len(rule.Input), matchRule(s.Format, s.InputClassDef, rule.Input))
+			if !ok {
+				continue
+			}
+			positions = append([]int{i}, positions...)
+			_, ok = a.matchSequence(i-1, -1, len(rule.Backtrack), matchRule(s.Format, s.BacktrackClassDef, rule.Backtrack))
+			if !ok {
+				continue
+			}
+			_, ok = a.matchSequence(positions[len(positions)-1]+1, 1, len(rule.Lookahead), matchRule(s.Format, s.LookaheadClassDef, rule.Lookahead))
+			if !ok {
+				continue
+			}
+			return positions, rule.LookupRecords, true
+		}
+	case 3:
+		matchCoverage := func(coverages []Coverage) func(k int, glyph uint) bool {
+			return func(k int, glyph uint) bool {
+				_, ok := coverages[k].Index(glyph)
+				return ok
+			}
+		}
+		if len(s.InputCoverages) == 0 {
+			return nil, nil, false
+		}
+		if _, ok := s.InputCoverages[0].Index(glyph); !ok {
+			return nil, nil, false
+		}
+		positions, ok := a.matchSequence(i+1, 1, len(s.InputCoverages)-1, matchCoverage(s.InputCoverages[1:]))
+		if !ok {
+			return nil, nil, false
+		}
+		positions = append([]int{i}, positions...)
+		_, ok = a.matchSequence(i-1, -1, len(s.BacktrackCoverages), matchCoverage(s.BacktrackCoverages))
+		if !ok {
+			return nil, nil, false
+		}
+		_, ok = a.matchSequence(positions[len(positions)-1]+1, 1, len(s.LookaheadCoverages), matchCoverage(s.LookaheadCoverages))
+		if !ok {
+			return nil, nil, false
+		}
+		return positions, s.LookupRecords, true
+	}
+	return nil, nil, false
+}
+
+//matchRule match glyph with value in rule, value is glyph (format 1) or class (format 2)
+func matchRule(format uint, classDef ClassDef, values []uint) func(k int, glyph uint) bool {
+	return func(k int, glyph uint) bool {
+		if format == 2 {
+			return classDef.Class(glyph) == values[k]
+		}
+		return glyph == values[k]
+	}
+}
+
+//replace replace glyphs[start:end] with glyphs
+func (a *otApplier) replace(start int, end int, glyphs []GlyphInfo) {
+	result := make([]GlyphInfo, 0, len(a.glyphs)-(end-start)+len(glyphs))
+	result = append(result, a.glyphs[:start]...)
+	result = append(result, glyphs...)
+	result = append(result, a.glyphs[end:]...)
+	a.glyphs = result
+}
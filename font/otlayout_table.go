@@ -0,0 +1,169 @@
+package font
+
+import "sort"
+
+//lookup flag https://www.microsoft.com/typography/otspec/chapter2.htm
+const (
+	LookupFlagRightToLeft         = 0x0001
+	LookupFlagIgnoreBaseGlyphs    = 0x0002
+	LookupFlagIgnoreLigatures     = 0x0004
+	LookupFlagIgnoreMarks         = 0x0008
+	LookupFlagUseMarkFilteringSet = 0x0010
+	LookupFlagMarkAttachmentType  = 0xFF00
+)
+
+//Coverage coverage table, map[glyph index]coverage index
+type Coverage map[uint]int
+
+//Index coverage index of glyph
+func (c Coverage) Index(glyph uint) (int, bool) {
+	idx, ok := c[glyph]
+	return idx, ok
+}
+
+//ClassDef class definition table, map[glyph index]class (glyph that not in map is class 0)
+type ClassDef map[uint]uint
+
+//Class class of glyph
+func (c ClassDef) Class(glyph uint) uint {
+	return c[glyph]
+}
+
+//LangSys language system table
+type LangSys struct {
+	RequiredFeatureIndex int //-1 if no required feature
+	FeatureIndexes       []uint
+}
+
+//Script script table
+type Script struct {
+	DefaultLangSys *LangSys
+	LangSyses      map[string]*LangSys
+}
+
+//Feature feature table
+type Feature struct {
+	Tag           string
+	LookupIndexes []uint
+}
+
+//LookupRecord apply lookup at SequenceIndex of input sequence (in contextual lookup)
+type LookupRecord struct {
+	SequenceIndex uint
+	LookupIndex   uint
+}
+
+//ChainRule rule of contextual lookup, value in Backtrack, Input and Lookahead are glyph index (format 1) or class (format 2)
+type ChainRule struct {
+	Backtrack     []uint //in reverse order (nearest first)
+	Input         []uint //without first glyph
+	Lookahead     []uint
+	LookupRecords []LookupRecord
+}
+
+//ChainContext contextual or chained contextual subtable (GSUB type 5, 6 and GPOS type 7, 8)
+type ChainContext struct {
+	Format   uint
+	Coverage Coverage //format 1, 2
+	//format 1: map[first glyph]rules, format 2: map[class of first glyph]rules
+	RuleSets map[uint][]ChainRule
+	//format 2
+	BacktrackClassDef ClassDef
+	InputClassDef     ClassDef
+	LookaheadClassDef ClassDef
+	//format 3
+	BacktrackCoverages []Coverage //in reverse order (nearest first)
+	InputCoverages     []Coverage
+	LookaheadCoverages []Coverage
+	LookupRecords      []LookupRecord
+}
+
+//LayoutTable script list and feature list of GSUB or GPOS https://www.microsoft.com/typography/otspec/chapter2.htm
+type LayoutTable struct {
+	Scripts  map[string]*Script
+	Features []Feature
+}
+
+//LookupIndexes sorted lookup indexes of features (by tag) in script and language (and of required feature),
+//fallback to script DFLT and default language system.
+func (l *LayoutTable) LookupIndexes(script string, lang string, features []string) []uint {
+
+	langSys := l.langSys(script, lang)
+	if langSys == nil {
+		return nil
+	}
+
+	wanted := make(map[string]bool)
+	for _, feature := range features {
+		wanted[feature] = true
+	}
+
+	featureIndexes := langSys.FeatureIndexes
+	if langSys.RequiredFeatureIndex >= 0 {
+		featureIndexes = append([]uint{uint(langSys.RequiredFeatureIndex)}, featureIndexes...)
+	}
+
+	found := make(map[uint]bool)
+	var lookupIndexes []uint
+	for i, featureIndex := range featureIndexes {
+		if int(featureIndex) >= len(l.Features) {
+			continue
+		}
+		feature := l.Features[featureIndex]
+		isRequired := i == 0 && langSys.RequiredFeatureIndex >= 0
+		if !isRequired && !wanted[feature.Tag] {
+			continue
+		}
+		for _, lookupIndex := range feature.LookupIndexes {
+			if !found[lookupIndex] {
+				found[lookupIndex] = true
+				lookupIndexes = append(lookupIndexes, lookupIndex)
+			}
+		}
+	}
+	sort.Slice(lookupIndexes, func(i, j int) bool { return lookupIndexes[i] < lookupIndexes[j] })
+	return lookupIndexes
+}
+
+//HasFeature font has feature (by tag) in script and language
+func (l *LayoutTable) HasFeature(script string, lang string, feature string) bool {
+	langSys := l.langSys(script, lang)
+	if langSys == nil {
+		return false
+	}
+	for _, featureIndex := range langSys.FeatureIndexes {
+		if int(featureIndex) < len(l.Features) && l.Features[featureIndex].Tag == feature {
+			return true
+		}
+	}
+	return false
+}
+
+func (l *LayoutTable) langSys(script string, lang string) *LangSys {
+	s, ok := l.Scripts[script]
+	if !ok {
+		s, ok = l.Scripts["DFLT"]
+		if !ok {
+			return nil
+		}
+	}
+	if langSys, ok := s.LangSyses[lang]; ok {
+		return langSys
+	}
+	return s.DefaultLangSys
+}
+
+//glyph class in GDEF
+const (
+	GlyphClassBase      = 1
+	GlyphClassLigature  = 2
+	GlyphClassMark      = 3
+	GlyphClassComponent = 4
+)
+
+//GDEFTable glyph definition table https://www.microsoft.com/typography/otspec/gdef.htm
+type GDEFTable struct {
+	GlyphClassDef      ClassDef
+	MarkAttachClassDef ClassDef
+	MarkGlyphSets      []Coverage
+}
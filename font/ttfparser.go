@@ -27,6 +27,16 @@ var ErrIncorrectMagicNumber = errors.New("Incorrect magic number")
 //ErrPostscriptNameNotFound PostScript name not found
 var ErrPostscriptNameNotFound = errors.New("PostScript name not found")
 
+//UnsupportedFormatError format of OpenType layout subtable (or its coverage or class definition) that is not supported
+type UnsupportedFormatError struct {
+	Name   string //name of subtable, ex. "coverage", "pair pos"
+	Format uint
+}
+
+func (e *UnsupportedFormatError) Error() string {
+	return fmt.Sprintf("not support %s format %d", e.Name, e.Format)
+}
+
 //TTFParser true type font parser
 type TTFParser struct {
 	tables map[string]TableDirectoryEntry
@@ -49,13 +59,15 @@ type TTFParser struct {
 	postScriptName string
 
 	//os2
-	os2Version    uint
-	Embeddable    bool
-	Bold          bool
-	typoAscender  int
-	typoDescender int
-	capHeight     int
-	sxHeight      int
+	os2Version        uint
+	Embeddable        bool
+	Bold              bool
+	typoAscender      int
+	typoDescender     int
+	capHeight         int
+	sxHeight          int
+	strikeoutSize     int
+	strikeoutPosition int
 
 	//post
 	italicAngle        int
@@ -86,6 +98,20 @@ type TTFParser struct {
 	//kerning
 	useKerning bool //user config for use or not use kerning
 	kern       *KernTable
+
+	//opentype layout
+	useOpenTypeLayout bool //user config for use or not use GDEF, GSUB and GPOS
+	gdef              *GDEFTable
+	gsub              *GSUBTable
+	gpos              *GPOSTable
+	layoutErrs        []error //errors of GDEF, GSUB and GPOS that are dropped
+
+	//vertical metrics
+	vertAscender        int
+	vertDescender       int
+	numOfLongVerMetrics uint
+	advanceHeights      []uint //nil if font has no vhea or vmtx table
+	topSideBearings     []int
 }
 
 //Symbolic symbolic
@@ -99,6 +125,26 @@ func (t *TTFParser) Kern() *KernTable {
 	return t.kern
 }
 
+//GDEF get GDEFTable (nil if font has no GDEF table or it can not be parsed, see LayoutErrors)
+func (t *TTFParser) GDEF() *GDEFTable {
+	return t.gdef
+}
+
+//GSUB get GSUBTable (nil if font has no GSUB table or it can not be parsed, see LayoutErrors)
+func (t *TTFParser) GSUB() *GSUBTable {
+	return t.gsub
+}
+
+//LayoutErrors errors of GDEF, GSUB and GPOS tables that can not be parsed (these tables are dropped)
+func (t *TTFParser) LayoutErrors() []error {
+	return t.layoutErrs
+}
+
+//GPOS get GPOSTable (nil if font has no GPOS table or it can not be parsed, see LayoutErrors)
+func (t *TTFParser) GPOS() *GPOSTable {
+	return t.gpos
+}
+
 //UnderlinePosition postion of underline
 func (t *TTFParser) UnderlinePosition() int {
 	return t.underlinePosition
@@ -114,6 +160,16 @@ func (t *TTFParser) UnderlineThickness() int {
 	return t.underlineThickness
 }
 
+//StrikeoutSize thickness of strikeout (from OS/2)
+func (t *TTFParser) StrikeoutSize() int {
+	return t.strikeoutSize
+}
+
+//StrikeoutPosition position of top of strikeout above baseline (from OS/2)
+func (t *TTFParser) StrikeoutPosition() int {
+	return t.strikeoutPosition
+}
+
 //XHeight xheight
 func (t *TTFParser) XHeight() int {
 	if t.os2Version >= 2 && t.sxHeight != 0 {
@@ -214,6 +270,11 @@ func (t *TTFParser) SetUseKerning(use bool) {
 	t.useKerning = use
 }
 
+//SetUseOpenTypeLayout set useOpenTypeLayout (parse GDEF, GSUB and GPOS) must set before Parse
+func (t *TTFParser) SetUseOpenTypeLayout(use bool) {
+	t.useOpenTypeLayout = use
+}
+
 //Parse parse
 func (t *TTFParser) Parse(filepath string) error {
 	data, err := ioutil.ReadFile(filepath)
@@ -341,6 +402,37 @@ func (t *TTFParser) parseByBytes(fontdata []byte) error {
 		}
 	}
 
+	//vertical metrics are optional, font that has broken vhea or vmtx use default vertical metrics
+	err = t.ParseVhea(fd)
+	if err == nil {
+		err = t.ParseVmtx(fd)
+	}
+	if err != nil {
+		t.numOfLongVerMetrics = 0
+		t.advanceHeights = nil
+		t.topSideBearings = nil
+	}
+
+	t.layoutErrs = nil
+	if t.useOpenTypeLayout {
+		//layout tables are optional, table that can not be parsed is dropped and font is shaped without it
+		err = t.ParseGDEF(fd)
+		if err != nil {
+			t.gdef = nil
+			t.layoutErrs = append(t.layoutErrs, fmt.Errorf("GDEF: %s", err))
+		}
+		err = t.ParseGSUB(fd)
+		if err != nil {
+			t.gsub = nil
+			t.layoutErrs = append(t.layoutErrs, fmt.Errorf("GSUB: %s", err))
+		}
+		err = t.ParseGPOS(fd)
+		if err != nil {
+			t.gpos = nil
+			t.layoutErrs = append(t.layoutErrs, fmt.Errorf("GPOS: %s", err))
+		}
+	}
+
 	//fmt.Printf("%#v\n", me.widths)
 	t.cahceFontData = fontdata //t.readFontData(fontpath)
 
@@ -462,7 +554,19 @@ func (t *TTFParser) ParseOS2(fd *bytes.Reader) error {
 	}
 	t.Embeddable = (fsType != 2) && ((fsType & 0x200) == 0)
 
-	err = t.Skip(fd, (11*2)+10+(4*4)+4)
+	err = t.Skip(fd, 8*2) // ySubscript*, ySuperscript*
+	if err != nil {
+		return err
+	}
+	t.strikeoutSize, err = t.ReadShort(fd)
+	if err != nil {
+		return err
+	}
+	t.strikeoutPosition, err = t.ReadShort(fd)
+	if err != nil {
+		return err
+	}
+	err = t.Skip(fd, 2+10+(4*4)+4) // sFamilyClass, panose, ulUnicodeRange, achVendID
 	if err != nil {
 		return err
 	}
@@ -0,0 +1,97 @@
+package font
+
+import "bytes"
+
+//ParseGDEF parse GDEF table https://www.microsoft.com/typography/otspec/gdef.htm
+func (t *TTFParser) ParseGDEF(fd *bytes.Reader) error {
+
+	t.gdef = nil //clear
+	err := t.Seek(fd, "GDEF")
+	if err == ErrTableNotFound {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	tableOffset := t.tables["GDEF"].Offset
+	t.gdef = new(GDEFTable) //init
+
+	err = t.Skip(fd, 2) //majorVersion
+	if err != nil {
+		return err
+	}
+
+	minorVersion, err := t.ReadUShort(fd)
+	if err != nil {
+		return err
+	}
+
+	glyphClassDefOffset, err := t.ReadUShort(fd)
+	if err != nil {
+		return err
+	}
+
+	err = t.Skip(fd, 2+2) //attachListOffset, ligCaretListOffset
+	if err != nil {
+		return err
+	}
+
+	markAttachClassDefOffset, err := t.ReadUShort(fd)
+	if err != nil {
+		return err
+	}
+
+	markGlyphSetsDefOffset := uint(0)
+	if minorVersion >= 2 {
+		markGlyphSetsDefOffset, err = t.ReadUShort(fd)
+		if err != nil {
+			return err
+		}
+	}
+
+	t.gdef.GlyphClassDef = make(ClassDef)
+	if glyphClassDefOffset != 0 {
+		t.gdef.GlyphClassDef, err = t.parseClassDef(fd, tableOffset+glyphClassDefOffset)
+		if err != nil {
+			return err
+		}
+	}
+
+	t.gdef.MarkAttachClassDef = make(ClassDef)
+	if markAttachClassDefOffset != 0 {
+		t.gdef.MarkAttachClassDef, err = t.parseClassDef(fd, tableOffset+markAttachClassDefOffset)
+		if err != nil {
+			return err
+		}
+	}
+
+	if markGlyphSetsDefOffset != 0 {
+		markGlyphSetsOffset := tableOffset + markGlyphSetsDefOffset
+		_, err = fd.Seek(int64(markGlyphSetsOffset), 0)
+		if err != nil {
+			return err
+		}
+		err = t.Skip(fd, 2) //format
+		if err != nil {
+			return err
+		}
+		markGlyphSetCount, err := t.ReadUShort(fd)
+		if err != nil {
+			return err
+		}
+		var coverageOffsets []uint
+		for i := uint(0); i < markGlyphSetCount; i++ {
+			coverageOffset, err := t.ReadULong(fd)
+			if err != nil {
+				return err
+			}
+			coverageOffsets = append(coverageOffsets, coverageOffset)
+		}
+		t.gdef.MarkGlyphSets, err = t.parseCoverages(fd, markGlyphSetsOffset, coverageOffsets)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,454 @@
+package font
+
+import "bytes"
+
+//ParseGPOS parse GPOS table https://www.microsoft.com/typography/otspec/gpos.htm
+func (t *TTFParser) ParseGPOS(fd *bytes.Reader) error {
+
+	t.gpos = nil //clear
+	_, ok := t.tables["GPOS"]
+	if !ok {
+		return nil
+	}
+
+	gpos := new(GPOSTable)
+	lookupListOffset, err := t.parseLayoutTable(fd, t.tables["GPOS"].Offset, &gpos.LayoutTable)
+	if err != nil {
+		return err
+	}
+
+	lookupHeaders, err := t.parseLookupList(fd, lookupListOffset, GPOSLookupTypeExtension)
+	if err != nil {
+		return err
+	}
+
+	for _, lookupHeader := range lookupHeaders {
+		lookup := GPOSLookup{
+			Type:             lookupHeader.lookupType,
+			Flag:             lookupHeader.flag,
+			MarkFilteringSet: lookupHeader.markFilteringSet,
+		}
+		for _, subtableOffset := range lookupHeader.subtableOffsets {
+			subtable, err := t.parseGPOSSubtable(fd, lookup.Type, subtableOffset)
+			if _, ok := err.(*UnsupportedFormatError); ok {
+				subtable = nil //skip subtable that not support
+			} else if err != nil {
+				return err
+			}
+			lookup.Subtables = append(lookup.Subtables, subtable)
+		}
+		gpos.Lookups = append(gpos.Lookups, lookup)
+	}
+
+	t.gpos = gpos
+	return nil
+}
+
+func (t *TTFParser) parseGPOSSubtable(fd *bytes.Reader, lookupType uint, offset uint) (interface{}, error) {
+	switch lookupType {
+	case GPOSLookupTypeSingle:
+		return t.parseSinglePos(fd, offset)
+	case GPOSLookupTypePair:
+		return t.parsePairPos(fd, offset)
+	case GPOSLookupTypeMarkToBase, GPOSLookupTypeMarkToMark:
+		return t.parseMarkBasePos(fd, offset)
+	case GPOSLookupTypeMarkToLig:
+		return t.parseMarkLigPos(fd, offset)
+	case GPOSLookupTypeContext:
+		return t.parseContext(fd, offset)
+	case GPOSLookupTypeChainContext:
+		return t.parseChainContext(fd, offset)
+	}
+	return nil, nil //not support yet
+}
+
+func (t *TTFParser) parseSinglePos(fd *bytes.Reader, offset uint) (*SinglePos, error) {
+
+	_, err := fd.Seek(int64(offset), 0)
+	if err != nil {
+		return nil, err
+	}
+
+	format, err := t.ReadUShort(fd)
+	if err != nil {
+		return nil, err
+	}
+
+	coverageOffset, err := t.ReadUShort(fd)
+	if err != nil {
+		return nil, err
+	}
+
+	valueFormat, err := t.ReadUShort(fd)
+	if err != nil {
+		return nil, err
+	}
+
+	var values []ValueRecord
+	if format == 1 {
+		value, err := t.readValueRecord(fd, valueFormat)
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, value)
+	} else if format == 2 {
+		valueCount, err := t.ReadUShort(fd)
+		if err != nil {
+			return nil, err
+		}
+		for i := uint(0); i < valueCount; i++ {
+			value, err := t.readValueRecord(fd, valueFormat)
+			if err != nil {
+				return nil, err
+			}
+			values = append(values, value)
+		}
+	} else {
+		return nil, &UnsupportedFormatError{Name: "single pos", Format: format}
+	}
+
+	coverage, err := t.parseCoverage(fd, offset+coverageOffset)
+	if err != nil {
+		return nil, err
+	}
+
+	var pos SinglePos
+	pos.Values = make(map[uint]ValueRecord)
+	for glyph, idx := range coverage {
+		if format == 1 {
+			pos.Values[glyph] = values[0]
+		} else if idx < len(values) {
+			pos.Values[glyph] = values[idx]
+		}
+	}
+
+	return &pos, nil
+}
+
+func (t *TTFParser) parsePairPos(fd *bytes.Reader, offset uint) (*PairPos, error) {
+
+	_, err := fd.Seek(int64(offset), 0)
+	if err != nil {
+		return nil, err
+	}
+
+	//format, coverageOffset, valueFormat1, valueFormat2
+	header, err := t.readUShorts(fd, 4)
+	if err != nil {
+		return nil, err
+	}
+	format, valueFormat1, valueFormat2 := header[0], header[2], header[3]
+
+	var pos PairPos
+	pos.Format = format
+	if format == 1 {
+		pairSetCount, err := t.ReadUShort(fd)
+		if err != nil {
+			return nil, err
+		}
+		pairSetOffsets, err := t.readUShorts(fd, pairSetCount)
+		if err != nil {
+			return nil, err
+		}
+
+		pos.Coverage, err = t.parseCoverage(fd, offset+header[1])
+		if err != nil {
+			return nil, err
+		}
+
+		//pair sets are in order of coverage index
+		firsts := make([]uint, pairSetCount)
+		for glyph, idx := range pos.Coverage {
+			if idx < len(firsts) {
+				firsts[idx] = glyph
+			}
+		}
+
+		pos.Pairs = make(map[uint]map[uint]PairValue)
+		for i, pairSetOffset := range pairSetOffsets {
+			_, err = fd.Seek(int64(offset+pairSetOffset), 0)
+			if err != nil {
+				return nil, err
+			}
+			pairValueCount, err := t.ReadUShort(fd)
+			if err != nil {
+				return nil, err
+			}
+			pairs := make(map[uint]PairValue)
+			for k := uint(0); k < pairValueCount; k++ {
+				secondGlyph, err := t.ReadUShort(fd)
+				if err != nil {
+					return nil, err
+				}
+				value, err := t.readPairValue(fd, valueFormat1, valueFormat2)
+				if err != nil {
+					return nil, err
+				}
+				pairs[secondGlyph] = value
+			}
+			pos.Pairs[firsts[i]] = pairs
+		}
+
+	} else if format == 2 {
+		//classDef1Offset, classDef2Offset, class1Count, class2Count
+		classHeader, err := t.readUShorts(fd, 4)
+		if err != nil {
+			return nil, err
+		}
+		class1Count, class2Count := classHeader[2], classHeader[3]
+
+		pos.ClassValues = make([][]PairValue, class1Count)
+		for class1 := uint(0); class1 < class1Count; class1++ {
+			pos.ClassValues[class1] = make([]PairValue, class2Count)
+			for class2 := uint(0); class2 < class2Count; class2++ {
+				pos.ClassValues[class1][class2], err = t.readPairValue(fd, valueFormat1, valueFormat2)
+				if err != nil {
+					return nil, err
+				}
+			}
+		}
+
+		pos.Coverage, err = t.parseCoverage(fd, offset+header[1])
+		if err != nil {
+			return nil, err
+		}
+		pos.ClassDef1, err = t.parseClassDef(fd, offset+classHeader[0])
+		if err != nil {
+			return nil, err
+		}
+		pos.ClassDef2, err = t.parseClassDef(fd, offset+classHeader[1])
+		if err != nil {
+			return nil, err
+		}
+
+	} else {
+		return nil, &UnsupportedFormatError{Name: "pair pos", Format: format}
+	}
+
+	return &pos, nil
+}
+
+func (t *TTFParser) readPairValue(fd *bytes.Reader, valueFormat1 uint, valueFormat2 uint) (PairValue, error) {
+	var value PairValue
+	var err error
+	value.First, err = t.readValueRecord(fd, valueFormat1)
+	if err != nil {
+		return value, err
+	}
+	value.Second, err = t.readValueRecord(fd, valueFormat2)
+	if err != nil {
+		return value, err
+	}
+	return value, nil
+}
+
+func (t *TTFParser) parseMarkBasePos(fd *bytes.Reader, offset uint) (*MarkBasePos, error) {
+
+	_, err := fd.Seek(int64(offset), 0)
+	if err != nil {
+		return nil, err
+	}
+
+	//format, markCoverageOffset, baseCoverageOffset, markClassCount, markArrayOffset, baseArrayOffset
+	header, err := t.readUShorts(fd, 6)
+	if err != nil {
+		return nil, err
+	}
+	markClassCount := header[3]
+
+	var pos MarkBasePos
+	pos.MarkCoverage, err = t.parseCoverage(fd, offset+header[1])
+	if err != nil {
+		return nil, err
+	}
+
+	pos.BaseCoverage, err = t.parseCoverage(fd, offset+header[2])
+	if err != nil {
+		return nil, err
+	}
+
+	pos.Marks, err = t.parseMarkArray(fd, offset+header[4])
+	if err != nil {
+		return nil, err
+	}
+
+	pos.Bases, err = t.parseAnchorMatrix(fd, offset+header[5], markClassCount)
+	if err != nil {
+		return nil, err
+	}
+
+	return &pos, nil
+}
+
+func (t *TTFParser) parseMarkLigPos(fd *bytes.Reader, offset uint) (*MarkLigPos, error) {
+
+	_, err := fd.Seek(int64(offset), 0)
+	if err != nil {
+		return nil, err
+	}
+
+	//format, markCoverageOffset, ligatureCoverageOffset, markClassCount, markArrayOffset, ligatureArrayOffset
+	header, err := t.readUShorts(fd, 6)
+	if err != nil {
+		return nil, err
+	}
+	markClassCount := header[3]
+
+	var pos MarkLigPos
+	pos.MarkCoverage, err = t.parseCoverage(fd, offset+header[1])
+	if err != nil {
+		return nil, err
+	}
+
+	pos.LigatureCoverage, err = t.parseCoverage(fd, offset+header[2])
+	if err != nil {
+		return nil, err
+	}
+
+	pos.Marks, err = t.parseMarkArray(fd, offset+header[4])
+	if err != nil {
+		return nil, err
+	}
+
+	ligatureArrayOffset := offset + header[5]
+	_, err = fd.Seek(int64(ligatureArrayOffset), 0)
+	if err != nil {
+		return nil, err
+	}
+
+	ligatureCount, err := t.ReadUShort(fd)
+	if err != nil {
+		return nil, err
+	}
+
+	ligatureAttachOffsets, err := t.readUShorts(fd, ligatureCount)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, ligatureAttachOffset := range ligatureAttachOffsets {
+		components, err := t.parseAnchorMatrix(fd, ligatureArrayOffset+ligatureAttachOffset, markClassCount)
+		if err != nil {
+			return nil, err
+		}
+		pos.Ligatures = append(pos.Ligatures, components)
+	}
+
+	return &pos, nil
+}
+
+//parseMarkArray parse mark array table
+func (t *TTFParser) parseMarkArray(fd *bytes.Reader, offset uint) ([]MarkRecord, error) {
+
+	_, err := fd.Seek(int64(offset), 0)
+	if err != nil {
+		return nil, err
+	}
+
+	markCount, err := t.ReadUShort(fd)
+	if err != nil {
+		return nil, err
+	}
+
+	markClasses := make([]uint, markCount)
+	markAnchorOffsets := make([]uint, markCount)
+	for i := uint(0); i < markCount; i++ {
+		markClasses[i], err = t.ReadUShort(fd)
+		if err != nil {
+			return nil, err
+		}
+		markAnchorOffsets[i], err = t.ReadUShort(fd)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	marks := make([]MarkRecord, markCount)
+	for i := uint(0); i < markCount; i++ {
+		marks[i].Class = markClasses[i]
+		anchor, err := t.parseAnchor(fd, offset+markAnchorOffsets[i])
+		if err != nil {
+			return nil, err
+		}
+		marks[i].Anchor = *anchor
+	}
+
+	return marks, nil
+}
+
+//parseAnchorMatrix parse base array, mark2 array or ligature attach table (count of records then anchor offsets of each mark class)
+func (t *TTFParser) parseAnchorMatrix(fd *bytes.Reader, offset uint, markClassCount uint) ([][]*Anchor, error) {
+
+	_, err := fd.Seek(int64(offset), 0)
+	if err != nil {
+		return nil, err
+	}
+
+	count, err := t.ReadUShort(fd)
+	if err != nil {
+		return nil, err
+	}
+
+	anchorOffsets, err := t.readUShorts(fd, count*markClassCount)
+	if err != nil {
+		return nil, err
+	}
+
+	matrix := make([][]*Anchor, count)
+	for i := uint(0); i < count; i++ {
+		matrix[i] = make([]*Anchor, markClassCount)
+		for class := uint(0); class < markClassCount; class++ {
+			anchorOffset := anchorOffsets[i*markClassCount+class]
+			if anchorOffset == 0 {
+				continue
+			}
+			matrix[i][class], err = t.parseAnchor(fd, offset+anchorOffset)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return matrix, nil
+}
+
+//parseAnchor parse anchor table (only x and y coordinate)
+func (t *TTFParser) parseAnchor(fd *bytes.Reader, offset uint) (*Anchor, error) {
+
+	_, err := fd.Seek(int64(offset+2), 0) //skip format
+	if err != nil {
+		return nil, err
+	}
+
+	var anchor Anchor
+	anchor.X, err = t.ReadShort(fd)
+	if err != nil {
+		return nil, err
+	}
+
+	anchor.Y, err = t.ReadShort(fd)
+	if err != nil {
+		return nil, err
+	}
+
+	return &anchor, nil
+}
+
+//readValueRecord read value record by valueFormat (device tables are skipped)
+func (t *TTFParser) readValueRecord(fd *bytes.Reader, valueFormat uint) (ValueRecord, error) {
+	var value ValueRecord
+	fields := []*int{&value.XPlacement, &value.YPlacement, &value.XAdvance, &value.YAdvance}
+	for bit := uint(0); bit < 8; bit++ {
+		if valueFormat&(1<<bit) == 0 {
+			continue
+		}
+		v, err := t.ReadShort(fd)
+		if err != nil {
+			return value, err
+		}
+		if bit < 4 {
+			*fields[bit] = v
+		}
+	}
+	return value, nil
+}
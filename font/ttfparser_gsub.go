@@ -0,0 +1,255 @@
+package font
+
+import "bytes"
+
+//ParseGSUB parse GSUB table https://www.microsoft.com/typography/otspec/gsub.htm
+func (t *TTFParser) ParseGSUB(fd *bytes.Reader) error {
+
+	t.gsub = nil //clear
+	_, ok := t.tables["GSUB"]
+	if !ok {
+		return nil
+	}
+
+	gsub := new(GSUBTable)
+	lookupListOffset, err := t.parseLayoutTable(fd, t.tables["GSUB"].Offset, &gsub.LayoutTable)
+	if err != nil {
+		return err
+	}
+
+	lookupHeaders, err := t.parseLookupList(fd, lookupListOffset, GSUBLookupTypeExtension)
+	if err != nil {
+		return err
+	}
+
+	for _, lookupHeader := range lookupHeaders {
+		lookup := GSUBLookup{
+			Type:             lookupHeader.lookupType,
+			Flag:             lookupHeader.flag,
+			MarkFilteringSet: lookupHeader.markFilteringSet,
+		}
+		for _, subtableOffset := range lookupHeader.subtableOffsets {
+			subtable, err := t.parseGSUBSubtable(fd, lookup.Type, subtableOffset)
+			if _, ok := err.(*UnsupportedFormatError); ok {
+				subtable = nil //skip subtable that not support
+			} else if err != nil {
+				return err
+			}
+			lookup.Subtables = append(lookup.Subtables, subtable)
+		}
+		gsub.Lookups = append(gsub.Lookups, lookup)
+	}
+
+	t.gsub = gsub
+	return nil
+}
+
+func (t *TTFParser) parseGSUBSubtable(fd *bytes.Reader, lookupType uint, offset uint) (interface{}, error) {
+	switch lookupType {
+	case GSUBLookupTypeSingle:
+		return t.parseSingleSubst(fd, offset)
+	case GSUBLookupTypeMultiple:
+		return t.parseMultipleSubst(fd, offset)
+	case GSUBLookupTypeLigature:
+		return t.parseLigatureSubst(fd, offset)
+	case GSUBLookupTypeContext:
+		return t.parseContext(fd, offset)
+	case GSUBLookupTypeChainContext:
+		return t.parseChainContext(fd, offset)
+	}
+	return nil, nil //not support yet
+}
+
+func (t *TTFParser) parseSingleSubst(fd *bytes.Reader, offset uint) (*SingleSubst, error) {
+
+	_, err := fd.Seek(int64(offset), 0)
+	if err != nil {
+		return nil, err
+	}
+
+	format, err := t.ReadUShort(fd)
+	if err != nil {
+		return nil, err
+	}
+
+	coverageOffset, err := t.ReadUShort(fd)
+	if err != nil {
+		return nil, err
+	}
+
+	var deltaGlyphID int
+	var substitutes []uint
+	if format == 1 {
+		deltaGlyphID, err = t.ReadShort(fd)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		glyphCount, err := t.ReadUShort(fd)
+		if err != nil {
+			return nil, err
+		}
+		substitutes, err = t.readUShorts(fd, glyphCount)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	coverage, err := t.parseCoverage(fd, offset+coverageOffset)
+	if err != nil {
+		return nil, err
+	}
+
+	var subst SingleSubst
+	subst.Substitutes = make(map[uint]uint)
+	for glyph, idx := range coverage {
+		if format == 1 {
+			subst.Substitutes[glyph] = uint(int(glyph)+deltaGlyphID) & 0xFFFF
+		} else if idx < len(substitutes) {
+			subst.Substitutes[glyph] = substitutes[idx]
+		}
+	}
+
+	return &subst, nil
+}
+
+func (t *TTFParser) parseMultipleSubst(fd *bytes.Reader, offset uint) (*MultipleSubst, error) {
+
+	_, err := fd.Seek(int64(offset), 0)
+	if err != nil {
+		return nil, err
+	}
+
+	err = t.Skip(fd, 2) //format
+	if err != nil {
+		return nil, err
+	}
+
+	coverageOffset, err := t.ReadUShort(fd)
+	if err != nil {
+		return nil, err
+	}
+
+	sequenceCount, err := t.ReadUShort(fd)
+	if err != nil {
+		return nil, err
+	}
+
+	sequenceOffsets, err := t.readUShorts(fd, sequenceCount)
+	if err != nil {
+		return nil, err
+	}
+
+	coverage, err := t.parseCoverage(fd, offset+coverageOffset)
+	if err != nil {
+		return nil, err
+	}
+
+	sequences := make([][]uint, sequenceCount)
+	for i, sequenceOffset := range sequenceOffsets {
+		_, err := fd.Seek(int64(offset+sequenceOffset), 0)
+		if err != nil {
+			return nil, err
+		}
+		glyphCount, err := t.ReadUShort(fd)
+		if err != nil {
+			return nil, err
+		}
+		sequences[i], err = t.readUShorts(fd, glyphCount)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var subst MultipleSubst
+	subst.Sequences = make(map[uint][]uint)
+	for glyph, idx := range coverage {
+		if idx < len(sequences) {
+			subst.Sequences[glyph] = sequences[idx]
+		}
+	}
+
+	return &subst, nil
+}
+
+func (t *TTFParser) parseLigatureSubst(fd *bytes.Reader, offset uint) (*LigatureSubst, error) {
+
+	_, err := fd.Seek(int64(offset), 0)
+	if err != nil {
+		return nil, err
+	}
+
+	err = t.Skip(fd, 2) //format
+	if err != nil {
+		return nil, err
+	}
+
+	coverageOffset, err := t.ReadUShort(fd)
+	if err != nil {
+		return nil, err
+	}
+
+	ligatureSetCount, err := t.ReadUShort(fd)
+	if err != nil {
+		return nil, err
+	}
+
+	ligatureSetOffsets, err := t.readUShorts(fd, ligatureSetCount)
+	if err != nil {
+		return nil, err
+	}
+
+	coverage, err := t.parseCoverage(fd, offset+coverageOffset)
+	if err != nil {
+		return nil, err
+	}
+
+	ligatureSets := make([][]Ligature, ligatureSetCount)
+	for i, ligatureSetOffset := range ligatureSetOffsets {
+		ligatureSetOffset += offset
+		_, err := fd.Seek(int64(ligatureSetOffset), 0)
+		if err != nil {
+			return nil, err
+		}
+		ligatureCount, err := t.ReadUShort(fd)
+		if err != nil {
+			return nil, err
+		}
+		ligatureOffsets, err := t.readUShorts(fd, ligatureCount)
+		if err != nil {
+			return nil, err
+		}
+		for _, ligatureOffset := range ligatureOffsets {
+			_, err := fd.Seek(int64(ligatureSetOffset+ligatureOffset), 0)
+			if err != nil {
+				return nil, err
+			}
+			var ligature Ligature
+			ligature.Glyph, err = t.ReadUShort(fd)
+			if err != nil {
+				return nil, err
+			}
+			componentCount, err := t.ReadUShort(fd)
+			if err != nil {
+				return nil, err
+			}
+			if componentCount > 0 {
+				ligature.Components, err = t.readUShorts(fd, componentCount-1)
+				if err != nil {
+					return nil, err
+				}
+			}
+			ligatureSets[i] = append(ligatureSets[i], ligature)
+		}
+	}
+
+	var subst LigatureSubst
+	subst.Ligatures = make(map[uint][]Ligature)
+	for glyph, idx := range coverage {
+		if idx < len(ligatureSets) {
+			subst.Ligatures[glyph] = ligatureSets[idx]
+		}
+	}
+
+	return &subst, nil
+}
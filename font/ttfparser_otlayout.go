@@ -0,0 +1,781 @@
+package font
+
+import "bytes"
+
+//parseLayoutTable parse script list and feature list of GSUB or GPOS table at tableOffset,
+//return offset of lookup list https://www.microsoft.com/typography/otspec/chapter2.htm
+func (t *TTFParser) parseLayoutTable(fd *bytes.Reader, tableOffset uint, l *LayoutTable) (uint, error) {
+
+	_, err := fd.Seek(int64(tableOffset), 0)
+	if err != nil {
+		return 0, err
+	}
+
+	err = t.Skip(fd, 2+2) //majorVersion, minorVersion
+	if err != nil {
+		return 0, err
+	}
+
+	scriptListOffset, err := t.ReadUShort(fd)
+	if err != nil {
+		return 0, err
+	}
+
+	featureListOffset, err := t.ReadUShort(fd)
+	if err != nil {
+		return 0, err
+	}
+
+	lookupListOffset, err := t.ReadUShort(fd)
+	if err != nil {
+		return 0, err
+	}
+
+	l.Scripts, err = t.parseScriptList(fd, tableOffset+scriptListOffset)
+	if err != nil {
+		return 0, err
+	}
+
+	l.Features, err = t.parseFeatureList(fd, tableOffset+featureListOffset)
+	if err != nil {
+		return 0, err
+	}
+
+	return tableOffset + lookupListOffset, nil
+}
+
+func (t *TTFParser) parseScriptList(fd *bytes.Reader, offset uint) (map[string]*Script, error) {
+
+	_, err := fd.Seek(int64(offset), 0)
+	if err != nil {
+		return nil, err
+	}
+
+	scriptCount, err := t.ReadUShort(fd)
+	if err != nil {
+		return nil, err
+	}
+
+	tags := make([]string, scriptCount)
+	scriptOffsets := make([]uint, scriptCount)
+	for i := uint(0); i < scriptCount; i++ {
+		tag, err := t.Read(fd, 4)
+		if err != nil {
+			return nil, err
+		}
+		tags[i] = t.BytesToString(tag)
+		scriptOffsets[i], err = t.ReadUShort(fd)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	scripts := make(map[string]*Script)
+	for i := uint(0); i < scriptCount; i++ {
+		script, err := t.parseScript(fd, offset+scriptOffsets[i])
+		if err != nil {
+			return nil, err
+		}
+		scripts[tags[i]] = script
+	}
+
+	return scripts, nil
+}
+
+func (t *TTFParser) parseScript(fd *bytes.Reader, offset uint) (*Script, error) {
+
+	_, err := fd.Seek(int64(offset), 0)
+	if err != nil {
+		return nil, err
+	}
+
+	defaultLangSysOffset, err := t.ReadUShort(fd)
+	if err != nil {
+		return nil, err
+	}
+
+	langSysCount, err := t.ReadUShort(fd)
+	if err != nil {
+		return nil, err
+	}
+
+	tags := make([]string, langSysCount)
+	langSysOffsets := make([]uint, langSysCount)
+	for i := uint(0); i < langSysCount; i++ {
+		tag, err := t.Read(fd, 4)
+		if err != nil {
+			return nil, err
+		}
+		tags[i] = t.BytesToString(tag)
+		langSysOffsets[i], err = t.ReadUShort(fd)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var script Script
+	script.LangSyses = make(map[string]*LangSys)
+	if defaultLangSysOffset != 0 {
+		script.DefaultLangSys, err = t.parseLangSys(fd, offset+defaultLangSysOffset)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	for i := uint(0); i < langSysCount; i++ {
+		script.LangSyses[tags[i]], err = t.parseLangSys(fd, offset+langSysOffsets[i])
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return &script, nil
+}
+
+func (t *TTFParser) parseLangSys(fd *bytes.Reader, offset uint) (*LangSys, error) {
+
+	_, err := fd.Seek(int64(offset), 0)
+	if err != nil {
+		return nil, err
+	}
+
+	err = t.Skip(fd, 2) //lookupOrder
+	if err != nil {
+		return nil, err
+	}
+
+	requiredFeatureIndex, err := t.ReadUShort(fd)
+	if err != nil {
+		return nil, err
+	}
+
+	featureIndexCount, err := t.ReadUShort(fd)
+	if err != nil {
+		return nil, err
+	}
+
+	var langSys LangSys
+	langSys.RequiredFeatureIndex = -1
+	if requiredFeatureIndex != 0xFFFF {
+		langSys.RequiredFeatureIndex = int(requiredFeatureIndex)
+	}
+
+	langSys.FeatureIndexes, err = t.readUShorts(fd, featureIndexCount)
+	if err != nil {
+		return nil, err
+	}
+
+	return &langSys, nil
+}
+
+func (t *TTFParser) parseFeatureList(fd *bytes.Reader, offset uint) ([]Feature, error) {
+
+	_, err := fd.Seek(int64(offset), 0)
+	if err != nil {
+		return nil, err
+	}
+
+	featureCount, err := t.ReadUShort(fd)
+	if err != nil {
+		return nil, err
+	}
+
+	features := make([]Feature, featureCount)
+	featureOffsets := make([]uint, featureCount)
+	for i := uint(0); i < featureCount; i++ {
+		tag, err := t.Read(fd, 4)
+		if err != nil {
+			return nil, err
+		}
+		features[i].Tag = t.BytesToString(tag)
+		featureOffsets[i], err = t.ReadUShort(fd)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	for i := uint(0); i < featureCount; i++ {
+		_, err := fd.Seek(int64(offset+featureOffsets[i]), 0)
+		if err != nil {
+			return nil, err
+		}
+
+		err = t.Skip(fd, 2) //featureParams
+		if err != nil {
+			return nil, err
+		}
+
+		lookupIndexCount, err := t.ReadUShort(fd)
+		if err != nil {
+			return nil, err
+		}
+
+		features[i].LookupIndexes, err = t.readUShorts(fd, lookupIndexCount)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return features, nil
+}
+
+//lookupHeader header of lookup table
+type lookupHeader struct {
+	lookupType       uint
+	flag             uint
+	markFilteringSet uint
+	subtableOffsets  []uint //absolute offset
+}
+
+//parseLookupList parse header of all lookup in lookup list, extension subtables (extensionType) are resolved
+func (t *TTFParser) parseLookupList(fd *bytes.Reader, offset uint, extensionType uint) ([]lookupHeader, error) {
+
+	_, err := fd.Seek(int64(offset), 0)
+	if err != nil {
+		return nil, err
+	}
+
+	lookupCount, err := t.ReadUShort(fd)
+	if err != nil {
+		return nil, err
+	}
+
+	lookupOffsets, err := t.readUShorts(fd, lookupCount)
+	if err != nil {
+		return nil, err
+	}
+
+	lookups := make([]lookupHeader, lookupCount)
+	for i, lookupOffset := range lookupOffsets {
+		lookupOffset += offset
+		_, err := fd.Seek(int64(lookupOffset), 0)
+		if err != nil {
+			return nil, err
+		}
+
+		lookups[i].lookupType, err = t.ReadUShort(fd)
+		if err != nil {
+			return nil, err
+		}
+
+		lookups[i].flag, err = t.ReadUShort(fd)
+		if err != nil {
+			return nil, err
+		}
+
+		subTableCount, err := t.ReadUShort(fd)
+		if err != nil {
+			return nil, err
+		}
+
+		subtableOffsets, err := t.readUShorts(fd, subTableCount)
+		if err != nil {
+			return nil, err
+		}
+
+		if lookups[i].flag&LookupFlagUseMarkFilteringSet != 0 {
+			lookups[i].markFilteringSet, err = t.ReadUShort(fd)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		for _, subtableOffset := range subtableOffsets {
+			lookups[i].subtableOffsets = append(lookups[i].subtableOffsets, lookupOffset+subtableOffset)
+		}
+
+		if lookups[i].lookupType == extensionType {
+			err = t.resolveExtension(fd, &lookups[i])
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return lookups, nil
+}
+
+//resolveExtension replace type and subtable offsets of extension lookup with the real one
+func (t *TTFParser) resolveExtension(fd *bytes.Reader, lookup *lookupHeader) error {
+	for i, subtableOffset := range lookup.subtableOffsets {
+		_, err := fd.Seek(int64(subtableOffset), 0)
+		if err != nil {
+			return err
+		}
+
+		err = t.Skip(fd, 2) //format
+		if err != nil {
+			return err
+		}
+
+		extensionLookupType, err := t.ReadUShort(fd)
+		if err != nil {
+			return err
+		}
+
+		extensionOffset, err := t.ReadULong(fd)
+		if err != nil {
+			return err
+		}
+
+		lookup.lookupType = extensionLookupType
+		lookup.subtableOffsets[i] = subtableOffset + extensionOffset
+	}
+	return nil
+}
+
+//parseCoverage parse coverage table https://www.microsoft.com/typography/otspec/chapter2.htm
+func (t *TTFParser) parseCoverage(fd *bytes.Reader, offset uint) (Coverage, error) {
+
+	_, err := fd.Seek(int64(offset), 0)
+	if err != nil {
+		return nil, err
+	}
+
+	format, err := t.ReadUShort(fd)
+	if err != nil {
+		return nil, err
+	}
+
+	count, err := t.ReadUShort(fd)
+	if err != nil {
+		return nil, err
+	}
+
+	coverage := make(Coverage)
+	if format == 1 {
+		glyphs, err := t.readUShorts(fd, count)
+		if err != nil {
+			return nil, err
+		}
+		for i, glyph := range glyphs {
+			coverage[glyph] = i
+		}
+	} else if format == 2 {
+		for i := uint(0); i < count; i++ {
+			ranges, err := t.readUShorts(fd, 3) //startGlyphID, endGlyphID, startCoverageIndex
+			if err != nil {
+				return nil, err
+			}
+			for glyph := ranges[0]; glyph <= ranges[1]; glyph++ {
+				coverage[glyph] = int(ranges[2] + glyph - ranges[0])
+			}
+		}
+	} else {
+		return nil, &UnsupportedFormatError{Name: "coverage", Format: format}
+	}
+
+	return coverage, nil
+}
+
+//parseClassDef parse class definition table https://www.microsoft.com/typography/otspec/chapter2.htm
+func (t *TTFParser) parseClassDef(fd *bytes.Reader, offset uint) (ClassDef, error) {
+
+	_, err := fd.Seek(int64(offset), 0)
+	if err != nil {
+		return nil, err
+	}
+
+	format, err := t.ReadUShort(fd)
+	if err != nil {
+		return nil, err
+	}
+
+	classDef := make(ClassDef)
+	if format == 1 {
+		startGlyphID, err := t.ReadUShort(fd)
+		if err != nil {
+			return nil, err
+		}
+		glyphCount, err := t.ReadUShort(fd)
+		if err != nil {
+			return nil, err
+		}
+		classes, err := t.readUShorts(fd, glyphCount)
+		if err != nil {
+			return nil, err
+		}
+		for i, class := range classes {
+			if class != 0 {
+				classDef[startGlyphID+uint(i)] = class
+			}
+		}
+	} else if format == 2 {
+		classRangeCount, err := t.ReadUShort(fd)
+		if err != nil {
+			return nil, err
+		}
+		for i := uint(0); i < classRangeCount; i++ {
+			ranges, err := t.readUShorts(fd, 3) //startGlyphID, endGlyphID, class
+			if err != nil {
+				return nil, err
+			}
+			for glyph := ranges[0]; glyph <= ranges[1]; glyph++ {
+				classDef[glyph] = ranges[2]
+			}
+		}
+	} else {
+		return nil, &UnsupportedFormatError{Name: "class definition", Format: format}
+	}
+
+	return classDef, nil
+}
+
+//parseCoverages parse coverage tables by offsets (relative to offset)
+func (t *TTFParser) parseCoverages(fd *bytes.Reader, offset uint, coverageOffsets []uint) ([]Coverage, error) {
+	var coverages []Coverage
+	for _, coverageOffset := range coverageOffsets {
+		coverage, err := t.parseCoverage(fd, offset+coverageOffset)
+		if err != nil {
+			return nil, err
+		}
+		coverages = append(coverages, coverage)
+	}
+	return coverages, nil
+}
+
+//parseContext parse contextual subtable (GSUB type 5 or GPOS type 7) as ChainContext
+func (t *TTFParser) parseContext(fd *bytes.Reader, offset uint) (*ChainContext, error) {
+
+	_, err := fd.Seek(int64(offset), 0)
+	if err != nil {
+		return nil, err
+	}
+
+	format, err := t.ReadUShort(fd)
+	if err != nil {
+		return nil, err
+	}
+
+	var ctx ChainContext
+	ctx.Format = format
+	if format == 1 || format == 2 {
+		coverageOffset, err := t.ReadUShort(fd)
+		if err != nil {
+			return nil, err
+		}
+		classDefOffset := uint(0)
+		if format == 2 {
+			classDefOffset, err = t.ReadUShort(fd)
+			if err != nil {
+				return nil, err
+			}
+		}
+		ruleSetCount, err := t.ReadUShort(fd)
+		if err != nil {
+			return nil, err
+		}
+		ruleSetOffsets, err := t.readUShorts(fd, ruleSetCount)
+		if err != nil {
+			return nil, err
+		}
+
+		ctx.Coverage, err = t.parseCoverage(fd, offset+coverageOffset)
+		if err != nil {
+			return nil, err
+		}
+		if format == 2 {
+			ctx.InputClassDef, err = t.parseClassDef(fd, offset+classDefOffset)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		//format 1 rule sets are in order of coverage index, format 2 are in order of class
+		keys := make([]uint, ruleSetCount)
+		if format == 1 {
+			for glyph, idx := range ctx.Coverage {
+				if idx < len(keys) {
+					keys[idx] = glyph
+				}
+			}
+		} else {
+			for i := range keys {
+				keys[i] = uint(i)
+			}
+		}
+
+		ctx.RuleSets = make(map[uint][]ChainRule)
+		for i, ruleSetOffset := range ruleSetOffsets {
+			if ruleSetOffset == 0 {
+				continue
+			}
+			rules, err := t.parseRuleSet(fd, offset+ruleSetOffset, false)
+			if err != nil {
+				return nil, err
+			}
+			ctx.RuleSets[keys[i]] = rules
+		}
+
+	} else if format == 3 {
+		glyphCount, err := t.ReadUShort(fd)
+		if err != nil {
+			return nil, err
+		}
+		lookupCount, err := t.ReadUShort(fd)
+		if err != nil {
+			return nil, err
+		}
+		coverageOffsets, err := t.readUShorts(fd, glyphCount)
+		if err != nil {
+			return nil, err
+		}
+		ctx.LookupRecords, err = t.readLookupRecords(fd, lookupCount)
+		if err != nil {
+			return nil, err
+		}
+		ctx.InputCoverages, err = t.parseCoverages(fd, offset, coverageOffsets)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		return nil, &UnsupportedFormatError{Name: "context", Format: format}
+	}
+
+	return &ctx, nil
+}
+
+//parseChainContext parse chained contextual subtable (GSUB type 6 or GPOS type 8)
+func (t *TTFParser) parseChainContext(fd *bytes.Reader, offset uint) (*ChainContext, error) {
+
+	_, err := fd.Seek(int64(offset), 0)
+	if err != nil {
+		return nil, err
+	}
+
+	format, err := t.ReadUShort(fd)
+	if err != nil {
+		return nil, err
+	}
+
+	var ctx ChainContext
+	ctx.Format = format
+	if format == 1 || format == 2 {
+		coverageOffset, err := t.ReadUShort(fd)
+		if err != nil {
+			return nil, err
+		}
+		var classDefOffsets []uint
+		if format == 2 {
+			classDefOffsets, err = t.readUShorts(fd, 3) //backtrack, input, lookahead
+			if err != nil {
+				return nil, err
+			}
+		}
+		ruleSetCount, err := t.ReadUShort(fd)
+		if err != nil {
+			return nil, err
+		}
+		ruleSetOffsets, err := t.readUShorts(fd, ruleSetCount)
+		if err != nil {
+			return nil, err
+		}
+
+		ctx.Coverage, err = t.parseCoverage(fd, offset+coverageOffset)
+		if err != nil {
+			return nil, err
+		}
+		if format == 2 {
+			classDefs := make([]ClassDef, 3)
+			for i, classDefOffset := range classDefOffsets {
+				if classDefOffset == 0 {
+					classDefs[i] = make(ClassDef)
+					continue
+				}
+				classDefs[i], err = t.parseClassDef(fd, offset+classDefOffset)
+				if err != nil {
+					return nil, err
+				}
+			}
+			ctx.BacktrackClassDef = classDefs[0]
+			ctx.InputClassDef = classDefs[1]
+			ctx.LookaheadClassDef = classDefs[2]
+		}
+
+		keys := make([]uint, ruleSetCount)
+		if format == 1 {
+			for glyph, idx := range ctx.Coverage {
+				if idx < len(keys) {
+					keys[idx] = glyph
+				}
+			}
+		} else {
+			for i := range keys {
+				keys[i] = uint(i)
+			}
+		}
+
+		ctx.RuleSets = make(map[uint][]ChainRule)
+		for i, ruleSetOffset := range ruleSetOffsets {
+			if ruleSetOffset == 0 {
+				continue
+			}
+			rules, err := t.parseRuleSet(fd, offset+ruleSetOffset, true)
+			if err != nil {
+				return nil, err
+			}
+			ctx.RuleSets[keys[i]] = rules
+		}
+
+	} else if format == 3 {
+		backtrackGlyphCount, err := t.ReadUShort(fd)
+		if err != nil {
+			return nil, err
+		}
+		backtrackCoverageOffsets, err := t.readUShorts(fd, backtrackGlyphCount)
+		if err != nil {
+			return nil, err
+		}
+		inputGlyphCount, err := t.ReadUShort(fd)
+		if err != nil {
+			return nil, err
+		}
+		inputCoverageOffsets, err := t.readUShorts(fd, inputGlyphCount)
+		if err != nil {
+			return nil, err
+		}
+		lookaheadGlyphCount, err := t.ReadUShort(fd)
+		if err != nil {
+			return nil, err
+		}
+		lookaheadCoverageOffsets, err := t.readUShorts(fd, lookaheadGlyphCount)
+		if err != nil {
+			return nil, err
+		}
+		lookupCount, err := t.ReadUShort(fd)
+		if err != nil {
+			return nil, err
+		}
+		ctx.LookupRecords, err = t.readLookupRecords(fd, lookupCount)
+		if err != nil {
+			return nil, err
+		}
+
+		ctx.BacktrackCoverages, err = t.parseCoverages(fd, offset, backtrackCoverageOffsets)
+		if err != nil {
+			return nil, err
+		}
+		ctx.InputCoverages, err = t.parseCoverages(fd, offset, inputCoverageOffsets)
+		if err != nil {
+			return nil, err
+		}
+		ctx.LookaheadCoverages, err = t.parseCoverages(fd, offset, lookaheadCoverageOffsets)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		return nil, &UnsupportedFormatError{Name: "chain context", Format: format}
+	}
+
+	return &ctx, nil
+}
+
+//parseRuleSet parse rule set (or class set) of contextual (isChain = false) or chained contextual subtable
+func (t *TTFParser) parseRuleSet(fd *bytes.Reader, offset uint, isChain bool) ([]ChainRule, error) {
+
+	_, err := fd.Seek(int64(offset), 0)
+	if err != nil {
+		return nil, err
+	}
+
+	ruleCount, err := t.ReadUShort(fd)
+	if err != nil {
+		return nil, err
+	}
+
+	ruleOffsets, err := t.readUShorts(fd, ruleCount)
+	if err != nil {
+		return nil, err
+	}
+
+	var rules []ChainRule
+	for _, ruleOffset := range ruleOffsets {
+		_, err := fd.Seek(int64(offset+ruleOffset), 0)
+		if err != nil {
+			return nil, err
+		}
+
+		var rule ChainRule
+		if isChain {
+			backtrackGlyphCount, err := t.ReadUShort(fd)
+			if err != nil {
+				return nil, err
+			}
+			rule.Backtrack, err = t.readUShorts(fd, backtrackGlyphCount)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		inputGlyphCount, err := t.ReadUShort(fd)
+		if err != nil {
+			return nil, err
+		}
+
+		lookupCount := uint(0)
+		if !isChain {
+			lookupCount, err = t.ReadUShort(fd)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		if inputGlyphCount > 0 {
+			rule.Input, err = t.readUShorts(fd, inputGlyphCount-1)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		if isChain {
+			lookaheadGlyphCount, err := t.ReadUShort(fd)
+			if err != nil {
+				return nil, err
+			}
+			rule.Lookahead, err = t.readUShorts(fd, lookaheadGlyphCount)
+			if err != nil {
+				return nil, err
+			}
+			lookupCount, err = t.ReadUShort(fd)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		rule.LookupRecords, err = t.readLookupRecords(fd, lookupCount)
+		if err != nil {
+			return nil, err
+		}
+		rules = append(rules, rule)
+	}
+
+	return rules, nil
+}
+
+func (t *TTFParser) readLookupRecords(fd *bytes.Reader, count uint) ([]LookupRecord, error) {
+	var records []LookupRecord
+	for i := uint(0); i < count; i++ {
+		values, err := t.readUShorts(fd, 2) //sequenceIndex, lookupListIndex
+		if err != nil {
+			return nil, err
+		}
+		records = append(records, LookupRecord{
+			SequenceIndex: values[0],
+			LookupIndex:   values[1],
+		})
+	}
+	return records, nil
+}
+
+//readUShorts read count ushort
+func (t *TTFParser) readUShorts(fd *bytes.Reader, count uint) ([]uint, error) {
+	values := make([]uint, count)
+	for i := uint(0); i < count; i++ {
+		v, err := t.ReadUShort(fd)
+		if err != nil {
+			return nil, err
+		}
+		values[i] = v
+	}
+	return values, nil
+}
@@ -0,0 +1,123 @@
+package font
+
+import (
+	"bytes"
+	"encoding/binary"
+)
+
+//ParseVhea parse vhea table https://www.microsoft.com/typography/otspec/vhea.htm
+func (t *TTFParser) ParseVhea(fd *bytes.Reader) error {
+
+	t.numOfLongVerMetrics = 0 //clear
+	err := t.Seek(fd, "vhea")
+	if err == ErrTableNotFound {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	err = t.Skip(fd, 4) //skip version
+	if err != nil {
+		return err
+	}
+
+	t.vertAscender, err = t.ReadShort(fd)
+	if err != nil {
+		return err
+	}
+
+	t.vertDescender, err = t.ReadShort(fd)
+	if err != nil {
+		return err
+	}
+
+	err = t.Skip(fd, 13*2)
+	if err != nil {
+		return err
+	}
+
+	t.numOfLongVerMetrics, err = t.ReadUShort(fd)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+//ParseVmtx parse vmtx table https://www.microsoft.com/typography/otspec/vmtx.htm (call after ParseVhea and ParseMaxp)
+func (t *TTFParser) ParseVmtx(fd *bytes.Reader) error {
+
+	t.advanceHeights = nil //clear
+	t.topSideBearings = nil
+	if t.numOfLongVerMetrics == 0 {
+		return nil
+	}
+	err := t.Seek(fd, "vmtx")
+	if err == ErrTableNotFound {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	advanceHeights := make([]uint, t.numGlyphs)
+	topSideBearings := make([]int, t.numGlyphs)
+	advanceHeight := uint(0)
+	for i := uint(0); i < t.numGlyphs; i++ {
+		if i < t.numOfLongVerMetrics {
+			advanceHeight, err = t.ReadUShort(fd)
+			if err != nil {
+				return err
+			}
+		}
+		//glyphs after numOfLongVerMetrics use advance height of last glyph in longVerMetric
+		advanceHeights[i] = advanceHeight
+		topSideBearings[i], err = t.ReadShort(fd)
+		if err != nil {
+			return err
+		}
+	}
+
+	t.advanceHeights = advanceHeights
+	t.topSideBearings = topSideBearings
+	return nil
+}
+
+//HasVerticalMetrics font has vhea and vmtx table
+func (t *TTFParser) HasVerticalMetrics() bool {
+	return t.advanceHeights != nil
+}
+
+//AdvanceHeight advance height of glyph, use ascender - descender if font has no vertical metrics
+func (t *TTFParser) AdvanceHeight(glyph uint) uint {
+	if !t.HasVerticalMetrics() || glyph >= uint(len(t.advanceHeights)) {
+		return uint(t.Ascender() - t.Descender())
+	}
+	return t.advanceHeights[glyph]
+}
+
+//VerticalOriginY y of vertical origin of glyph (top side bearing + yMax of glyph),
+//use ascender if font has no vertical metrics
+func (t *TTFParser) VerticalOriginY(glyph uint) int {
+	if !t.HasVerticalMetrics() || glyph >= uint(len(t.topSideBearings)) {
+		return t.Ascender()
+	}
+	yMax, ok := t.glyphYMax(glyph)
+	if !ok {
+		//empty glyph (ex. space)
+		return t.vertAscender
+	}
+	return t.topSideBearings[glyph] + yMax
+}
+
+//glyphYMax yMax in header of glyph in glyf table, false if glyph has no outline
+func (t *TTFParser) glyphYMax(glyph uint) (int, bool) {
+	table, ok := t.tables["glyf"]
+	if !ok || glyph+1 >= uint(len(t.LocaTable)) || t.LocaTable[glyph] == t.LocaTable[glyph+1] {
+		return 0, false
+	}
+	offset := table.Offset + t.LocaTable[glyph] + 8 //numberOfContours, xMin, yMin, xMax
+	if offset+2 > uint(len(t.cahceFontData)) {
+		return 0, false
+	}
+	return int(int16(binary.BigEndian.Uint16(t.cahceFontData[offset:]))), true
+}
@@ -0,0 +1,77 @@
+package nxpdf
+
+import "github.com/pkg/errors"
+
+func insertRichText(p *PdfData, spans []TextSpan, pageIndex int /* zero to n..*/, rect *Position, option *TextOption) (*TextBoxResult, error) {
+
+	if len(spans) == 0 {
+		return nil, ErrNoTextSpan
+	}
+
+	_, err := p.page(pageIndex)
+	if err != nil {
+		return nil, errors.Wrapf(err, "p.page(%d) fail", pageIndex)
+	}
+
+	ccRichText := contenteCacheRichText{}
+	if rect != nil {
+		ccRichText.rect, err = p.toUserSpace(pageIndex, *rect)
+		if err != nil {
+			return nil, errors.Wrap(err, "")
+		}
+	}
+	if option != nil {
+		ccRichText.option = *option
+	}
+	err = checkTextOption(&ccRichText.option)
+	if err != nil {
+		return nil, errors.Wrap(err, "")
+	}
+
+	for _, span := range spans {
+		ccText, err := newContentCacheText(p, span.FontRef, span.Text)
+		if err != nil {
+			return nil, errors.Wrap(err, "")
+		}
+		if ccText.isVertical() {
+			return nil, ErrWritingModeMismatch
+		}
+
+		ccText.rect = ccRichText.rect
+		ccText.option = ccRichText.option
+		if span.Size > 0 {
+			ccText.option.Size = span.Size
+		}
+		if span.FillColor != nil {
+			ccText.option.FillColor = span.FillColor
+		}
+		err = checkTextOption(&ccText.option)
+		if err != nil {
+			return nil, errors.Wrap(err, "")
+		}
+		ccRichText.spans = append(ccRichText.spans, ccText)
+	}
+
+	var overflow string
+	if ccRichText.option.AutoShrink {
+		overflow, err = ccRichText.shrink()
+		if err != nil {
+			return nil, errors.Wrap(err, "ccRichText.shrink() fail")
+		}
+	} else {
+		overflow, err = ccRichText.layout()
+		if err != nil {
+			return nil, errors.Wrap(err, "ccRichText.layout() fail")
+		}
+	}
+
+	ccRichText.addGlyphs()
+
+	p.addContentCacher(pageIndex, &ccRichText)
+
+	return &TextBoxResult{
+		Lines:    len(ccRichText.lines),
+		Overflow: overflow,
+		Size:     ccRichText.base().fontSize(),
+	}, nil
+}
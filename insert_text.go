@@ -2,35 +2,172 @@ package nxpdf
 
 import "github.com/pkg/errors"
 
-func insertText(p *PdfData, fontRef FontRef, text string, pageIndex int /* zero to n..*/, rect *Position, option *TextOption) error {
+func insertText(p *PdfData, fontRef FontRef, text string, pageIndex int /* zero to n..*/, rect *Position, option *TextOption) (*TextBoxResult, error) {
 
-	ssf, found := p.subsetFonts[fontRef]
-	if !found {
-		return ErrFontRefNotFound
+	_, err := p.page(pageIndex)
+	if err != nil {
+		return nil, errors.Wrapf(err, "p.page(%d) fail", pageIndex)
 	}
 
-	err := ssf.addChars(text)
+	ccText, err := newContentCacheText(p, fontRef, text)
 	if err != nil {
-		return errors.Wrapf(err, "subsetFont.addChars('%s') fail", text)
+		return nil, errors.Wrap(err, "")
 	}
 
-	if p.mapPageAndContentCachers == nil {
-		p.mapPageAndContentCachers = make(map[int](*[]contentCacher))
+	if rect != nil {
+		ccText.rect, err = p.toUserSpace(pageIndex, *rect)
+		if err != nil {
+			return nil, errors.Wrap(err, "")
+		}
+	}
+	if option != nil {
+		ccText.option = *option
+	}
+	err = checkTextOption(&ccText.option)
+	if err != nil {
+		return nil, errors.Wrap(err, "")
 	}
 
-	ccText := contenteCacheText{
-		ssf:     ssf,
-		textRaw: text,
+	var overflow string
+	if ccText.option.AutoShrink {
+		overflow, err = ccText.shrink()
+		if err != nil {
+			return nil, errors.Wrap(err, "ccText.shrink() fail")
+		}
+	} else {
+		overflow, err = ccText.layout()
+		if err != nil {
+			return nil, errors.Wrap(err, "ccText.layout() fail")
+		}
+	}
+
+	ccText.addGlyphs()
+
+	p.addContentCacher(pageIndex, ccText)
+
+	return &TextBoxResult{
+		Lines:    len(ccText.lines),
+		Overflow: overflow,
+		Size:     ccText.fontSize(),
+	}, nil
+}
+
+func (p *PdfData) addContentCacher(pageIndex int, cacher contentCacher) {
+
+	if p.mapPageAndContentCachers == nil {
+		p.mapPageAndContentCachers = make(map[int](*[]contentCacher))
 	}
 
 	if contentCachers, ok := p.mapPageAndContentCachers[pageIndex]; ok {
-		*contentCachers = append(*contentCachers, &ccText)
+		*contentCachers = append(*contentCachers, cacher)
 	} else {
 		contentCachers := []contentCacher{
-			&ccText,
+			cacher,
 		}
 		p.mapPageAndContentCachers[pageIndex] = &contentCachers
 	}
+}
+
+//newContentCacheText create contenteCacheText of text in font of fontRef (and fallback fonts of it)
+func newContentCacheText(p *PdfData, fontRef FontRef, text string) (*contenteCacheText, error) {
+
+	ssf, found := p.subsetFonts[fontRef]
+	if !found {
+		return nil, ErrFontRefNotFound
+	}
+
+	ccText := contenteCacheText{
+		fontRef:  fontRef,
+		ssf:      ssf,
+		textRaw:  text,
+		thaiDict: p.thaiDict,
+	}
+	if ccText.thaiDict == nil {
+		ccText.thaiDict = defaultThaiDict()
+	}
+
+	for _, fallback := range p.fontFallbacks[fontRef] {
+		fallbackSsf, found := p.subsetFonts[fallback]
+		if !found {
+			return nil, ErrFontRefNotFound
+		}
+		if fallbackSsf.vertical != ssf.vertical {
+			return nil, ErrWritingModeMismatch
+		}
+		ccText.fallbacks = append(ccText.fallbacks, textFont{fontRef: fallback, ssf: fallbackSsf})
+	}
 
+	return &ccText, nil
+}
+
+func setFontFallbacks(p *PdfData, fontRef FontRef, fallbacks []FontRef) error {
+
+	for _, f := range append([]FontRef{fontRef}, fallbacks...) {
+		if _, found := p.subsetFonts[f]; !found {
+			return ErrFontRefNotFound
+		}
+	}
+
+	if p.fontFallbacks == nil {
+		p.fontFallbacks = make(map[FontRef][]FontRef)
+	}
+	p.fontFallbacks[fontRef] = append([]FontRef(nil), fallbacks...)
+	return nil
+}
+
+func setFontVertical(p *PdfData, fontRef FontRef, vertical bool) error {
+	ssf, found := p.subsetFonts[fontRef]
+	if !found {
+		return ErrFontRefNotFound
+	}
+	ssf.vertical = vertical
+	return nil
+}
+
+func setKernOverride(p *PdfData, fontRef FontRef, fn FuncKernOverride) error {
+	ssf, found := p.subsetFonts[fontRef]
+	if !found {
+		return ErrFontRefNotFound
+	}
+	ssf.funcKernOverride = fn
+	return nil
+}
+
+func kernOverrideMap(pairs map[string]int) FuncKernOverride {
+	overrides := make(map[[2]rune]int)
+	for pair, val := range pairs {
+		runes := []rune(pair)
+		if len(runes) == 2 {
+			overrides[[2]rune{runes[0], runes[1]}] = val
+		}
+	}
+	return func(leftRune rune, rightRune rune, leftPair uint, rightPair uint, pairVal int) int {
+		if val, ok := overrides[[2]rune{leftRune, rightRune}]; ok {
+			return val
+		}
+		return pairVal
+	}
+}
+
+//checkTextOption check color, render mode and matrix of option
+func checkTextOption(option *TextOption) error {
+	if option.RenderMode < TextRenderFill || option.RenderMode > TextRenderClip {
+		return ErrInvalidRenderMode
+	}
+	if m := option.Matrix; m != nil && m.A*m.D-m.B*m.C == 0 {
+		return ErrInvalidMatrix
+	}
+	if option.Layer != LayerOverlay && option.Layer != LayerUnderlay {
+		return ErrInvalidLayer
+	}
+	for _, color := range []*Color{option.FillColor, option.StrokeColor} {
+		if color == nil {
+			continue
+		}
+		_, err := colorOperator(color, false)
+		if err != nil {
+			return errors.Wrap(err, "")
+		}
+	}
 	return nil
 }
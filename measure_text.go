@@ -0,0 +1,37 @@
+package nxpdf
+
+import (
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+func measureText(p *PdfData, fontRef FontRef, text string, size float64) (*TextMetrics, error) {
+
+	ccText, err := newContentCacheText(p, fontRef, text)
+	if err != nil {
+		return nil, errors.Wrap(err, "")
+	}
+	ccText.option.Size = size
+
+	//advance of glyphs is advance height for vertical font (see shapeRun)
+	width := 0.0
+	for _, line := range strings.Split(text, "\n") {
+		line = strings.TrimSuffix(line, "\r")
+		lineWidth, err := ccText.textWidth(line)
+		if err != nil {
+			return nil, errors.Wrapf(err, "ccText.textWidth(%s) fail", line)
+		}
+		if lineWidth > width {
+			width = lineWidth
+		}
+	}
+
+	ascent, descent := ccText.ascentAndDescent()
+	return &TextMetrics{
+		Width:      width * ccText.fontSize() / 1000.0,
+		Ascent:     ascent,
+		Descent:    descent,
+		LineHeight: ccText.lineHeight(),
+	}, nil
+}
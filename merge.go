@@ -34,6 +34,13 @@ func merge(a, b *PdfData) error {
 	}
 	//fmt.Printf("%d %d\n", maxRealIDOfA, maxFakeIDOfA)
 
+	//root of page tree of b is found by its trailer (before id of trailer is shifted)
+	rootIDOfB, err := b.pageTreeRootID()
+	if err != nil {
+		return errors.Wrap(err, "")
+	}
+	rootIDOfB = shiftObjectID(rootIDOfB, maxRealIDOfA+1, maxFakeIDOfA+1)
+
 	//remove Catalog,Trailer b
 	tempB, err := shiftID(b, maxRealIDOfA+1, maxFakeIDOfA+1)
 	if err != nil {
@@ -52,73 +59,126 @@ func merge(a, b *PdfData) error {
 	}*/
 
 	//merge Pages a and b together (into a)
-	err = mergePages(a, tempB, maxRealIDOfA)
+	err = mergePages(a, tempB, rootIDOfB)
 	if err != nil {
 		return errors.Wrap(err, "")
 	}
+	a.pageCache = nil //page tree of a is changed
 
 	return nil
 }
 
-func mergePages(a, b *PdfData, maxRealIDOfA uint32) error {
+//mergePages add page tree of b (rootIDOfB) as a kid of root of page tree of a,
+//so pages of b still inherit attributes from their parents in b
+func mergePages(a, b *PdfData, rootIDOfB objectID) error {
 
-	results, err := newQuery(a).findDict("Type", "/Pages")
+	rootIDOfA, err := a.pageTreeRootID()
 	if err != nil {
 		return errors.Wrap(err, "")
 	}
-
-	if len(results) <= 0 {
-		return ErrCannotFindPdfObjectPages
-	}
-	pagesOfA := results[0]
-
-	results, err = newQuery(b).findDict("Type", "/Pages")
+	pagesOfA, err := a.pages()
 	if err != nil {
 		return errors.Wrap(err, "")
 	}
-
-	if len(results) <= 0 {
-		return ErrCannotFindPdfObjectPages
+	kidsNodeOfA, err := newQuery(a).findPdfNodeByKeyName(rootIDOfA, "Kids")
+	if err != nil {
+		return errors.Wrap(err, "")
 	}
-	pagesOfB := results[0]
-
-	var kidsIDOfA objectID
-	for _, nodeOfA := range *a.objects[pagesOfA.objID] {
-		if nodeOfA.key.use == NodeKeyUseName && nodeOfA.key.name == "Kids" {
-			kidsIDOfA = nodeOfA.content.refTo
-			break
-		}
+	kidsIDOfA := kidsNodeOfA.content.refTo
+	if _, ok := a.objects[kidsIDOfA]; !ok {
+		return ErrObjectIDNotFound
 	}
 
-	var kidsIDOfB objectID
-	for _, nodeOfB := range *b.objects[pagesOfB.objID] {
-		if nodeOfB.key.use == NodeKeyUseName && nodeOfB.key.name == "Kids" {
-			kidsIDOfB = nodeOfB.content.refTo
-			break
-		}
+	var pagesOfB []pdfPage
+	err = b.walkPageTree(rootIDOfB, nil, make(map[objectID]bool), &pagesOfB)
+	if err != nil {
+		return errors.Wrap(err, "")
 	}
 
 	//merge
 	for objID, obj := range b.objects {
-		if objID != kidsIDOfB {
-			a.objects[objID] = obj
-		}
+		a.objects[objID] = obj
 	}
 
-	for _, node := range *b.objects[kidsIDOfB] {
-		a.objects[kidsIDOfA].append(node)
-	}
+	stopInheritance(a, rootIDOfA, rootIDOfB, pagesOfB)
 
-	count := a.objects[kidsIDOfA].len()
-	for i, node := range *a.objects[pagesOfA.objID] {
-		if node.key.use == NodeKeyUseName && node.key.name == "Count" {
-			(*a.objects[pagesOfA.objID])[i].content.str = fmt.Sprintf("%d", count)
-		}
-	}
+	a.objects[kidsIDOfA].append(pdfNode{
+		key: nodeKey{
+			use:   NodeKeyUseIndex,
+			index: a.objects[kidsIDOfA].len(),
+		},
+		content: nodeContent{
+			use:   NodeContentUseRefTo,
+			refTo: rootIDOfB,
+		},
+	})
+	a.setNode(rootIDOfB, pdfNode{
+		key: nodeKey{
+			use:  NodeKeyUseName,
+			name: "Parent",
+		},
+		content: nodeContent{
+			use:   NodeContentUseRefTo,
+			refTo: rootIDOfA,
+		},
+	})
+	a.setNode(rootIDOfA, pdfNode{
+		key: nodeKey{
+			use:  NodeKeyUseName,
+			name: "Count",
+		},
+		content: nodeContent{
+			use: NodeContentUseString,
+			str: fmt.Sprintf("%d", len(pagesOfA)+len(pagesOfB)),
+		},
+	})
 
 	return nil
 }
 
+//stopInheritance set default value of inheritable attributes that root of a has but root of b has not to root (or pages) of b,
+//so pages of b are not changed by attributes of root of a (pagesOfB is pages of b before it is added to a)
+func stopInheritance(a *PdfData, rootIDOfA objectID, rootIDOfB objectID, pagesOfB []pdfPage) {
+	for _, key := range inheritableKeys {
+		if _, err := newQuery(a).findPdfNodeByKeyName(rootIDOfA, key); err == ErrKeyNameNotFound {
+			continue
+		}
+		if _, err := newQuery(a).findPdfNodeByKeyName(rootIDOfB, key); err != ErrKeyNameNotFound {
+			continue
+		}
+
+		switch key {
+		case "Rotate":
+			a.setNode(rootIDOfB, pdfNode{
+				key:     nodeKey{use: NodeKeyUseName, name: key},
+				content: nodeContent{use: NodeContentUseString, str: "0"},
+			})
+		case "Resources":
+			maxFakeID, _ := a.findMaxFakeID()
+			resourcesID := initObjectIDFake(maxFakeID+1, rootIDOfB.id)
+			a.objects[resourcesID] = &pdfNodes{}
+			a.setNode(rootIDOfB, pdfNode{
+				key:     nodeKey{use: NodeKeyUseName, name: key},
+				content: nodeContent{use: NodeContentUseRefTo, refTo: resourcesID},
+			})
+		case "CropBox":
+			//CropBox of page is MediaBox by default
+			for _, page := range pagesOfB {
+				if _, ok := page.attrs["CropBox"]; ok {
+					continue
+				}
+				mediaBox, ok := page.attrs["MediaBox"]
+				if !ok {
+					continue
+				}
+				mediaBox.key.name = "CropBox"
+				a.setNode(page.id, mediaBox)
+			}
+		}
+		//MediaBox is required, so every page of b has it
+	}
+}
+
 func removeTrailer(src *PdfData) error {
 	trailerObjID := initObjectIDReal(0) //Trailer away 0
 	delete(src.objects, trailerObjID)
@@ -158,24 +218,15 @@ func clonePdfData(src *PdfData) *PdfData {
 func shiftID(src *PdfData, realIDOffset uint32, fakeIDOffset uint32) (*PdfData, error) {
 	dest := newPdfData()
 	for srcID := range src.objects {
-		var destID objectID
-		destID.isReal = srcID.isReal
-		if destID.isReal {
-			destID.id = srcID.id + realIDOffset
-		} else {
-			destID.id = srcID.id + fakeIDOffset
-		}
+		destID := shiftObjectID(srcID, realIDOffset, fakeIDOffset)
+		dest.objects[destID] = &pdfNodes{} //object without node (ex. empty dictionary) is kept
 		srcNodes := src.objects[srcID]
 		size := srcNodes.len()
 		for i := 0; i < size; i++ {
 			srcNode := (*srcNodes)[i]
 			destNode := srcNode.clone()
 			if destNode.content.use == NodeContentUseRefTo {
-				if destNode.content.refTo.isReal {
-					destNode.content.refTo.id = destNode.content.refTo.id + realIDOffset
-				} else {
-					destNode.content.refTo.id = destNode.content.refTo.id + fakeIDOffset
-				}
+				destNode.content.refTo = shiftObjectID(destNode.content.refTo, realIDOffset, fakeIDOffset)
 			}
 			dest.push(destID, destNode)
 		}
@@ -183,6 +234,15 @@ func shiftID(src *PdfData, realIDOffset uint32, fakeIDOffset uint32) (*PdfData,
 	return dest, nil
 }
 
+func shiftObjectID(id objectID, realIDOffset uint32, fakeIDOffset uint32) objectID {
+	if id.isReal {
+		id.id += realIDOffset
+	} else {
+		id.id += fakeIDOffset
+	}
+	return id
+}
+
 func maxID(a *PdfData) (uint32, uint32, error) {
 	maxRealID := uint32(0)
 	maxFakeID := uint32(0)
@@ -194,5 +254,5 @@ func maxID(a *PdfData) (uint32, uint32, error) {
 			maxFakeID = objID.id
 		}
 	}
-	return maxRealID, maxRealID, nil
+	return maxRealID, maxFakeID, nil
 }
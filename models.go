@@ -12,16 +12,155 @@ const AlignBottom = 1 //000001
 const AlignCenter = 16 //010000
 //AlignMiddle middle
 const AlignMiddle = 32 //100000
+//AlignJustify justify wrapped lines to full width (last line of paragraph is not justified)
+const AlignJustify = 64 //1000000
 
-//Position rect
+//Position rect in points from bottom-left corner of page (CropBox or MediaBox), or in unit and origin that set by SetUnit and SetOrigin,
+//Position on page that has /Rotate is in space of page as displayed (text is upright when page is displayed)
 type Position struct {
 	X, Y float64
 	W, H float64
 }
 
+//UnitPT point (1/72 inch), default unit of Position
+const UnitPT = 0
+
+//UnitMM millimetre
+const UnitMM = 1
+
+//UnitCM centimetre
+const UnitCM = 2
+
+//UnitInch inch
+const UnitInch = 3
+
+//OriginBottomLeft Position.X, Position.Y is from bottom-left corner of page (CropBox or MediaBox), Position.Y is upward,
+//default origin of Position
+const OriginBottomLeft = 0
+
+//OriginTopLeft Position.X, Position.Y is from top-left corner of page (CropBox or MediaBox), Position.Y is downward to top of rect
+const OriginTopLeft = 1
+
+//TextOption option of text
 type TextOption struct {
-	Size  float64
-	Align int
+	Size  float64 //font size, zero mean use default size (14)
+	Align int     //AlignLeft, AlignRight, AlignCenter, AlignJustify | AlignTop, AlignBottom, AlignMiddle (zero mean AlignLeft|AlignTop, AlignRight|AlignTop for right-to-left paragraph or vertical font)
+
+	Ligature bool //use standard ligatures of font (ex. fi, fl, ffi)
+
+	//text box mode
+	Wrap       bool    //wrap text on word boundaries to fit Position.W, lines that do not fit Position.H are not drawn
+	LineHeight float64 //distance between baselines, zero mean use ascender - descender of font
+
+	//auto shrink mode
+	AutoShrink bool    //reduce font size from Size until text fit in Position.W and Position.H
+	MinSize    float64 //smallest font size for AutoShrink, zero mean use default min size (4)
+
+	//color and text state
+	FillColor         *Color  //nil mean not set (black)
+	StrokeColor       *Color  //nil mean not set (black)
+	RenderMode        int     //TextRenderFill (default), TextRenderStroke, TextRenderFillStroke, TextRenderInvisible or TextRenderClip
+	CharSpacing       float64 //extra space after each character (in text space unit)
+	WordSpacing       float64 //extra space after each space character (in text space unit)
+	HorizontalScaling float64 //in percent, zero mean 100
+	Rise              float64 //move baseline up (in text space unit)
+
+	//decoration (thickness and position are from font, not drawn in vertical writing)
+	Underline bool //draw rule under each line
+	Strikeout bool //draw rule through each line
+
+	//transform (text is placed and aligned in Position, then Position is transformed)
+	Rotate float64 //angle in degrees (counterclockwise) that rotate Position around Anchor
+	Anchor int     //point of Position that is center of rotation, AlignLeft, AlignRight, AlignCenter | AlignTop, AlignBottom, AlignMiddle (zero mean AlignLeft|AlignBottom)
+	Matrix *Matrix //transform after rotation, nil mean not set
+
+	//layer
+	Layer int //LayerOverlay (default, on top of page content) or LayerUnderlay (under page content)
+}
+
+//Matrix 2D affine matrix [A B C D E F] of pdf (x' = A*x + C*y + E, y' = B*x + D*y + F)
+type Matrix struct {
+	A, B, C, D, E, F float64
+}
+
+//text render mode
+const (
+	TextRenderFill           = 0
+	TextRenderStroke         = 1
+	TextRenderFillStroke     = 2
+	TextRenderInvisible      = 3
+	TextRenderFillClip       = 4
+	TextRenderStrokeClip     = 5
+	TextRenderFillStrokeClip = 6
+	TextRenderClip           = 7
+)
+
+//layer of inserted content
+const (
+	LayerOverlay  = 0
+	LayerUnderlay = 1
+)
+
+//color space of Color
+const (
+	ColorSpaceGray = 1
+	ColorSpaceRGB  = 2
+	ColorSpaceCMYK = 3
+)
+
+//Color color in gray (1 value), RGB (3 values) or CMYK (4 values), each value is 0 to 1
+type Color struct {
+	Space  int
+	Values []float64
+}
+
+//ColorGray create gray color
+func ColorGray(gray float64) *Color {
+	return &Color{Space: ColorSpaceGray, Values: []float64{gray}}
+}
+
+//ColorRGB create RGB color
+func ColorRGB(r, g, b float64) *Color {
+	return &Color{Space: ColorSpaceRGB, Values: []float64{r, g, b}}
+}
+
+//ColorCMYK create CMYK color
+func ColorCMYK(c, m, y, k float64) *Color {
+	return &Color{Space: ColorSpaceCMYK, Values: []float64{c, m, y, k}}
+}
+
+//TextSpan part of rich text that has own font, size and color
+type TextSpan struct {
+	FontRef   FontRef
+	Text      string
+	Size      float64 //zero mean use TextOption.Size
+	FillColor *Color  //nil mean use TextOption.FillColor
+}
+
+//FuncKernOverride return kerning of pair of left and right rune (in font unit), leftPair and rightPair are glyph indexes,
+//pairVal is kerning from font (x advance of both glyphs in pair, zero if font has no kerning of pair), return zero for suppress kerning.
+//Value that is not pairVal replace all values of pair from font (GPOS placements too)
+type FuncKernOverride func(leftRune rune, rightRune rune, leftPair uint, rightPair uint, pairVal int) int
+
+//TextBoxResult result of InsertTextBox
+type TextBoxResult struct {
+	Lines    int     //number of lines that drawn
+	Overflow string  //text that does not fit in Position (empty if all text fit)
+	Size     float64 //font size that used (size after shrink in AutoShrink mode)
+}
+
+//TextMetrics result of MeasureText (in point)
+type TextMetrics struct {
+	Width      float64 //width of the widest line (height of the longest column from advance heights of vmtx for vertical font)
+	Ascent     float64
+	Descent    float64 //less than zero
+	LineHeight float64 //distance between baselines (ascent - descent), distance between columns for vertical font
+}
+
+//CoverageResult result of CheckCoverage
+type CoverageResult struct {
+	Missing []rune //runes that are not in cmap of font
+	Notdef  []rune //runes that are in cmap of font but map to glyph 0 (notdef)
 }
 
 type FontRef string
@@ -34,9 +34,82 @@ func AddFontFilePath(p *PdfData, fontpath string) (FontRef, error) {
 
 //InsertText insert text to pdf
 func InsertText(p *PdfData, fontRef FontRef, text string, pageIndex int, rect *Position, option *TextOption) error {
+	_, err := insertText(p, fontRef, text, pageIndex, rect, option)
+	return err
+}
+
+//InsertTextBox insert text to pdf like InsertText and return result of layout,
+//set option.Wrap for wrap text in rect and get text that overflow rect.H back
+func InsertTextBox(p *PdfData, fontRef FontRef, text string, pageIndex int, rect *Position, option *TextOption) (*TextBoxResult, error) {
 	return insertText(p, fontRef, text, pageIndex, rect, option)
 }
 
+//InsertRichText insert spans (each span has own font, size and color) as one text, spans are on shared baselines
+//and are wrapped together when option.Wrap is set, option.AutoShrink reduce sizes of all spans in proportion
+//(vertical fonts are not supported)
+func InsertRichText(p *PdfData, spans []TextSpan, pageIndex int, rect *Position, option *TextOption) (*TextBoxResult, error) {
+	return insertRichText(p, spans, pageIndex, rect, option)
+}
+
+//SetUnit set unit of Position (UnitPT, UnitMM, UnitCM or UnitInch) for next insertions, default is UnitPT
+func SetUnit(p *PdfData, unit int) error {
+	return setUnit(p, unit)
+}
+
+//SetOrigin set origin of Position (OriginBottomLeft or OriginTopLeft) for next insertions, default is OriginBottomLeft,
+//both origins are corners of CropBox (or MediaBox) of each page, Y of OriginTopLeft is flipped by height of that page
+func SetOrigin(p *PdfData, origin int) error {
+	return setOrigin(p, origin)
+}
+
+//SetFontFallbacks set fonts (in order) that use for characters that font of fontRef does not have
+func SetFontFallbacks(p *PdfData, fontRef FontRef, fallbacks []FontRef) error {
+	return setFontFallbacks(p, fontRef, fallbacks)
+}
+
+//SetFontVertical set font of fontRef to vertical writing (Identity-V), text is written in columns from right to left
+//and glyphs are from top to bottom (fallback fonts of font must be vertical too)
+func SetFontVertical(p *PdfData, fontRef FontRef, vertical bool) error {
+	return setFontVertical(p, fontRef, vertical)
+}
+
+//SetKernOverride set fn for adjust or suppress kerning of font of fontRef (nil mean use kerning from font)
+func SetKernOverride(p *PdfData, fontRef FontRef, fn FuncKernOverride) error {
+	return setKernOverride(p, fontRef, fn)
+}
+
+//KernOverrideMap create FuncKernOverride from map of pair (string of left and right rune, ex. "AV") and kerning in font unit,
+//pairs that are not in map use kerning from font
+func KernOverrideMap(pairs map[string]int) FuncKernOverride {
+	return kernOverrideMap(pairs)
+}
+
+//MeasureText measure text (that may have many lines) in font size, size zero mean use default size (14),
+//text of vertical font (see SetFontVertical) is measured along column
+func MeasureText(p *PdfData, fontRef FontRef, text string, size float64) (*TextMetrics, error) {
+	return measureText(p, fontRef, text, size)
+}
+
+//CheckCoverage find runes in text that font does not have glyph (each rune is listed once)
+func CheckCoverage(p *PdfData, fontRef FontRef, text string) (*CoverageResult, error) {
+	return checkCoverage(p, fontRef, text)
+}
+
+//SetThaiWords set word list that use for find line break of thai text (instead of default word list)
+func SetThaiWords(p *PdfData, words []string) {
+	p.thaiDict = newThaiDict(words)
+}
+
+//SetThaiWordsPath set word list that use for find line break of thai text by path of word list file (one word per line)
+func SetThaiWordsPath(p *PdfData, path string) error {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return errors.Wrapf(err, "ioutil.ReadFile(%s) fail", path)
+	}
+	p.thaiDict = newThaiDictByBytes(b)
+	return nil
+}
+
 //MergePdf merge b into a
 func MergePdf(a, b *PdfData) error {
 	return merge(a, b)
@@ -1,64 +1,1925 @@
 package nxpdf
 
 import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"fmt"
 	"io/ioutil"
+	"math"
 	"os"
+	"sort"
+	"strings"
 	"testing"
+
+	"github.com/oneplus1000/nxpdf/font"
+	"github.com/pkg/errors"
 )
 
-func _TestRead(t *testing.T) {
+func _TestRead(t *testing.T) {
+
+	isExists, err := exists("testing/out/")
+	if err != nil {
+		t.Errorf("can not create testing/out/ for test")
+		return
+	}
+	if !isExists {
+		err := os.MkdirAll("testing/out/", 0777)
+		if err != nil {
+			t.Errorf("can not create testing/out/ for test")
+			return
+		}
+	}
+
+	testRead(t, "testing/pdf/pdf_from_gopdf.pdf", "testing/out/pdf_from_gopdf_out.pdf")
+	testRead(t, "testing/out/pdf_from_gopdf_out.pdf", "")
+
+	testRead(t, "testing/pdf/twopage.pdf", "testing/out/twopage_out.pdf")
+	testRead(t, "testing/out/twopage_out.pdf", "")
+
+	testRead(t, "testing/pdf/jpg.pdf", "testing/out/jpg_out.pdf")
+	testRead(t, "testing/out/jpg_out.pdf", "")
+
+	testRead(t, "testing/pdf/pdf_from_chrome_50_win10.pdf", "testing/out/pdf_from_chrome_50_win10_out.pdf")
+	testRead(t, "testing/out/pdf_from_chrome_50_win10_out.pdf", "")
+
+	testRead(t, "testing/pdf/pdf_from_docx.pdf", "testing/out/pdf_from_docx_out.pdf")
+	testRead(t, "testing/out/pdf_from_docx_out.pdf", "")
+
+	//testRead(t, "testing/pdf/pdf_from_iia.pdf", "testing/out/pdf_from_iia_out.pdf")
+	//testRead(t, "testing/out/pdf_from_iia_out.pdf", "")
+}
+
+func _TestMerge(t *testing.T) {
+	testMerge(t, "testing/pdf/twopage.pdf", "testing/pdf/pdf_from_gopdf.pdf", "testing/out/twopage_and_pdf_from_gopdf_out.pdf")
+	testMerge(t, "testing/pdf/jpg.pdf", "testing/pdf/pdf_from_docx.pdf", "testing/out/jpg_and_pdf_from_docx_out.pdf")
+}
+
+func TestInsertText(t *testing.T) {
+	err := testInsertText("testing/pdf/pdf_from_gopdf.pdf", "testing/out/pdf_from_gopdf_out_inserttext.pdf")
+	if err != nil {
+		t.Errorf("%+v", err)
+		return
+	}
+	testRead(t, "testing/out/pdf_from_gopdf_out_inserttext.pdf", "")
+
+	err = testInsertText("testing/pdf/twopage.pdf", "testing/out/twopage_out_inserttext.pdf")
+	if err != nil {
+		t.Errorf("%+v", err)
+		return
+	}
+	testRead(t, "testing/out/twopage_out_inserttext.pdf", "")
+}
+
+func TestTextAlign(t *testing.T) {
+	pdfdata, err := read("testing/pdf/pdf_from_gopdf.pdf")
+	if err != nil {
+		t.Errorf("%+v", err)
+		return
+	}
+	fontRef, err := AddFontFilePath(pdfdata, "testing/ttf/times.ttf")
+	if err != nil {
+		t.Errorf("%+v", err)
+		return
+	}
+
+	rect := Position{X: 100, Y: 100, W: 200, H: 100}
+	aligns := []int{AlignRight, AlignCenter, AlignLeft | AlignBottom, AlignLeft | AlignMiddle}
+	for _, align := range aligns {
+		err = InsertText(pdfdata, fontRef, "A", 0, &rect, &TextOption{Size: 10, Align: align})
+		if err != nil {
+			t.Errorf("%+v", err)
+			return
+		}
+	}
+	data, err := BuildPdf(pdfdata)
+	if err != nil {
+		t.Errorf("%+v", err)
+		return
+	}
+
+	ssf := pdfdata.subsetFonts[fontRef]
+	glyphIndex, err := ssf.getGlyphIndex('A')
+	if err != nil {
+		t.Errorf("%+v", err)
+		return
+	}
+	width := float64(ssf.glyphIndexToPdfWidth(glyphIndex)) * 10 / 1000
+	ascent := float64(ssf.ttfp.Ascender()) * 10 / float64(ssf.ttfp.UnitsPerEm())
+	descent := float64(ssf.ttfp.Descender()) * 10 / float64(ssf.ttfp.UnitsPerEm())
+
+	//start point of text in content of page
+	expecteds := [][2]float64{
+		{rect.X + rect.W - width, rect.Y + rect.H - ascent},
+		{rect.X + (rect.W-width)/2, rect.Y + rect.H - ascent},
+		{rect.X, rect.Y - descent},
+		{rect.X, rect.Y + rect.H/2 - (ascent+descent)/2},
+	}
+	for i, expected := range expecteds {
+		td := fmt.Sprintf("%0.2f %0.2f TD\n", expected[0], expected[1])
+		if !bytes.Contains(data, []byte(td)) {
+			t.Errorf("align %d: %s not found in content", aligns[i], td)
+		}
+	}
+}
+
+func TestFontResourceNames(t *testing.T) {
+	fontfile, err := ioutil.ReadFile("testing/ttf/times.ttf")
+	if err != nil {
+		t.Errorf("%+v", err)
+		return
+	}
+
+	//resourcesOfPage resources of first page of pdf
+	resourcesOfPage := func(p *PdfData) (objectID, error) {
+		results, err := newQuery(p).findDict("Type", "/Page")
+		if err != nil {
+			return objectIDEmpty, err
+		}
+		resNode, err := newQuery(p).findPdfNodeByKeyName(results[0].objID, "Resources")
+		if err != nil {
+			return objectIDEmpty, err
+		}
+		return resNode.content.refTo, nil
+	}
+
+	//build add fonts and insert text in each font to page of pdf (after resources of page is edited)
+	build := func(fontfiles [][]byte, edit func(p *PdfData, resID objectID) error) ([]byte, error) {
+		pdfdata, err := read("testing/pdf/pdf_from_gopdf.pdf")
+		if err != nil {
+			return nil, err
+		}
+		resID, err := resourcesOfPage(pdfdata)
+		if err != nil {
+			return nil, err
+		}
+		err = edit(pdfdata, resID)
+		if err != nil {
+			return nil, err
+		}
+		var fontRefs []FontRef
+		for _, fontfile := range fontfiles {
+			fontRef, err := AddFontFile(pdfdata, fontfile)
+			if err != nil {
+				return nil, err
+			}
+			fontRefs = append(fontRefs, fontRef)
+		}
+		//text is always inserted in same order, only order of adding fonts is changed
+		sort.Slice(fontRefs, func(i, j int) bool { return fontRefs[i] < fontRefs[j] })
+		for _, fontRef := range fontRefs {
+			err = InsertText(pdfdata, fontRef, "AV", 0, &Position{X: 10, Y: 10}, &TextOption{Size: 10})
+			if err != nil {
+				return nil, err
+			}
+		}
+		return BuildPdf(pdfdata)
+	}
+
+	//fontNames read pdf back and return names in /Font of page (sorted) and object that each name refer to
+	fontNames := func(data []byte) ([]string, map[string]objectID, error) {
+		pdfdata, err := ReadPdf(data)
+		if err != nil {
+			return nil, nil, err
+		}
+		resID, err := resourcesOfPage(pdfdata)
+		if err != nil {
+			return nil, nil, err
+		}
+		fontNode, err := newQuery(pdfdata).findPdfNodeByKeyName(resID, "Font")
+		if err != nil {
+			return nil, nil, err
+		}
+		var names []string
+		refs := make(map[string]objectID)
+		for _, node := range *pdfdata.objects[fontNode.content.refTo] {
+			names = append(names, node.key.name)
+			refs[node.key.name] = node.content.refTo
+		}
+		sort.Strings(names)
+		return names, refs, nil
+	}
+
+	//resources that already use F1, F2 and TT0
+	data, err := build([][]byte{fontfile}, func(p *PdfData, resID objectID) error {
+		fontNode, err := newQuery(p).findPdfNodeByKeyName(resID, "Font")
+		if err != nil {
+			return err
+		}
+		f1Node, err := newQuery(p).findPdfNodeByKeyName(fontNode.content.refTo, "F1")
+		if err != nil {
+			return err
+		}
+		for _, name := range []string{"TT0", "F2"} {
+			node := *f1Node
+			node.key.name = name
+			p.objects[fontNode.content.refTo].append(node)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Errorf("%+v", err)
+		return
+	}
+	names, _, err := fontNames(data)
+	if err != nil {
+		t.Errorf("%+v", err)
+		return
+	}
+	if fmt.Sprint(names) != "[F1 F2 F3 TT0]" || !bytes.Contains(data, []byte("/F3 10.00 Tf\n")) {
+		t.Errorf("wrong font names %v", names)
+	}
+
+	//resources without /Font
+	data, err = build([][]byte{fontfile}, func(p *PdfData, resID objectID) error {
+		index, err := newQuery(p).findIndexByKeyName(resID, "Font")
+		if err != nil {
+			return err
+		}
+		p.objects[resID].remove(index)
+		return nil
+	})
+	if err != nil {
+		t.Errorf("%+v", err)
+		return
+	}
+	names, _, err = fontNames(data)
+	if err != nil {
+		t.Errorf("%+v", err)
+		return
+	}
+	if fmt.Sprint(names) != "[F1]" || !bytes.Contains(data, []byte("/F1 10.00 Tf\n")) {
+		t.Errorf("wrong font names %v", names)
+	}
+
+	//names and objects of fonts do not depend on order that fonts are added
+	otherFontfile := append(append([]byte{}, fontfile...), 0)
+	noEdit := func(p *PdfData, resID objectID) error { return nil }
+	data, err = build([][]byte{fontfile, otherFontfile}, noEdit)
+	if err != nil {
+		t.Errorf("%+v", err)
+		return
+	}
+	otherData, err := build([][]byte{otherFontfile, fontfile}, noEdit)
+	if err != nil {
+		t.Errorf("%+v", err)
+		return
+	}
+	names, refs, err := fontNames(data)
+	if err != nil {
+		t.Errorf("%+v", err)
+		return
+	}
+	_, otherRefs, err := fontNames(otherData)
+	if err != nil {
+		t.Errorf("%+v", err)
+		return
+	}
+	if fmt.Sprint(names) != "[F1 F2 F3]" || fmt.Sprint(refs) != fmt.Sprint(otherRefs) {
+		t.Errorf("fonts are not same when order of fonts is changed %v %v", refs, otherRefs)
+	}
+}
+
+func TestInsertTextBox(t *testing.T) {
+	pdfdata, err := read("testing/pdf/pdf_from_gopdf.pdf")
+	if err != nil {
+		t.Errorf("%+v", err)
+		return
+	}
+
+	fontRef, err := AddFontFilePath(pdfdata, "testing/ttf/times.ttf")
+	if err != nil {
+		t.Errorf("%+v", err)
+		return
+	}
+
+	text := "The quick brown fox jumps over the lazy dog.\nSecond paragraph"
+	result, err := InsertTextBox(pdfdata, fontRef, text, 0, &Position{X: 10, Y: 700, W: 100, H: 30}, &TextOption{Size: 12, Wrap: true})
+	if err != nil {
+		t.Errorf("%+v", err)
+		return
+	}
+	if result.Lines != 2 || result.Overflow != "lazy dog.\nSecond paragraph" {
+		t.Errorf("wrong result %+v", result)
+		return
+	}
+
+	data, err := BuildPdf(pdfdata)
+	if err != nil {
+		t.Errorf("%+v", err)
+		return
+	}
+	ioutil.WriteFile("testing/out/pdf_from_gopdf_out_inserttextbox.pdf", data, 0777)
+}
+
+func TestThaiWordBreak(t *testing.T) {
+	words := defaultThaiDict().split("บ้านเลขที่123หมู่บ้านสวยงาม(กรุงเทพมหานคร)")
+	expect := []string{"บ้านเลขที่123", "หมู่บ้าน", "สวย", "งาม(", "กรุงเทพมหานคร)"}
+	if strings.Join(words, "|") != strings.Join(expect, "|") {
+		t.Errorf("wrong words %v", words)
+	}
+
+	//unknown words are kept together and never break before vowels or tone marks
+	words = newThaiDict([]string{"ภาษา"}).split("ภาษาเพี้ยนๆ")
+	expect = []string{"ภาษา", "เพี้ยนๆ"}
+	if strings.Join(words, "|") != strings.Join(expect, "|") {
+		t.Errorf("wrong words %v", words)
+	}
+}
+
+func TestOpenTypeLayout(t *testing.T) {
+	fontfile, err := ioutil.ReadFile("testing/ttf/times.ttf")
+	if err != nil {
+		t.Errorf("%+v", err)
+		return
+	}
+
+	ssf := newSubsetFont(fontfile)
+	err = ssf.init()
+	if err != nil {
+		t.Errorf("%+v", err)
+		return
+	}
+
+	glyphInfos := func(text string) []font.GlyphInfo {
+		var glyphs []font.GlyphInfo
+		for i, r := range []rune(text) {
+			glyph := ssf.charCodeToGlyphIndex(r)
+			glyphs = append(glyphs, font.GlyphInfo{Glyph: glyph, Cluster: i, XAdvance: int(ssf.ttfp.Widths()[glyph])})
+		}
+		return glyphs
+	}
+
+	//lam (initial form) and alef (final form) become ligature
+	glyphs := ssf.ttfp.ApplyGSUB(glyphInfos("\uFEDF\uFE8E"), "arab", "", []string{"rlig"})
+	if len(glyphs) != 1 || glyphs[0].Cluster != 0 {
+		t.Errorf("wrong ligature %+v", glyphs)
+	}
+
+	//qamats is attached to bet
+	glyphs = ssf.ttfp.ApplyGPOS(glyphInfos("\u05D1\u05B8"), "hebr", "", []string{"mark", "mkmk"})
+	if len(glyphs) != 2 || glyphs[1].XAdvance != 0 || glyphs[1].XOffset == 0 {
+		t.Errorf("wrong mark position %+v", glyphs)
+	}
+}
+
+func TestThaiMarks(t *testing.T) {
+	pdfdata := testPdfDataOfPages([][4]float64{{0, 0, 595, 842}})
+	//see testing/ttf/thai_marks_gen.go for glyphs and anchors of font
+	fontRef, err := AddFontFilePath(pdfdata, "testing/ttf/thai_marks.ttf")
+	if err != nil {
+		t.Errorf("%+v", err)
+		return
+	}
+
+	//sara am is no nu (2), nikhahit (7) before mai tho (4) then sara aa (8),
+	//nikhahit and sara ii (9) are attached to base, mai tho and mai ek (5) are attached to them
+	texts := []string{"น้ำ", "ที่"}
+	expects := []string{
+		"[<0002>50<0007>] TJ\n1.50 Ts\n[-30<0004>] TJ\n0.00 Ts\n[-20<0008>] TJ\n",
+		"[<0003>20<0009>] TJ\n2.00 Ts\n[40<0005>] TJ\n0.00 Ts\n",
+	}
+	for i, text := range texts {
+		err = InsertText(pdfdata, fontRef, text, 0, &Position{X: 10, Y: float64(100 + i*50), W: 100, H: 20}, &TextOption{Size: 10})
+		if err != nil {
+			t.Errorf("%+v", err)
+			return
+		}
+	}
+
+	contents, err := testBuildContents(pdfdata)
+	if err != nil {
+		t.Errorf("%+v", err)
+		return
+	}
+	for i, expect := range expects {
+		if !strings.Contains(contents[0], expect) {
+			t.Errorf("wrong glyphs or offsets of %s %s", texts[i], contents[0])
+		}
+	}
+
+	//long word is broken between clusters, sara am (400) does not start a line
+	result, err := InsertTextBox(pdfdata, fontRef, "น้ำที่", 0, &Position{X: 10, Y: 200, W: 7, H: 100}, &TextOption{Size: 10, Wrap: true})
+	if err != nil {
+		t.Errorf("%+v", err)
+		return
+	}
+	if result.Lines != 2 {
+		t.Errorf("wrong lines of long thai word %d", result.Lines)
+	}
+}
+
+func TestUnsupportedLayoutFormat(t *testing.T) {
+	fontfile, err := ioutil.ReadFile("testing/ttf/times.ttf")
+	if err != nil {
+		t.Errorf("%+v", err)
+		return
+	}
+
+	//coverage of first subtable of first single substitution lookup of GSUB has unsupported format,
+	//GPOS is out of font file
+	gsub := testFontTableOffset(fontfile, "GSUB")
+	if gsub < 0 {
+		t.Errorf("GSUB not found")
+		return
+	}
+	lookupList := gsub + int(binary.BigEndian.Uint16(fontfile[gsub+8:]))
+	lookupIndex := -1
+	for i := 0; i < int(binary.BigEndian.Uint16(fontfile[lookupList:])); i++ {
+		lookup := lookupList + int(binary.BigEndian.Uint16(fontfile[lookupList+2+i*2:]))
+		if binary.BigEndian.Uint16(fontfile[lookup:]) == font.GSUBLookupTypeSingle {
+			subtable := lookup + int(binary.BigEndian.Uint16(fontfile[lookup+6:]))
+			coverage := subtable + int(binary.BigEndian.Uint16(fontfile[subtable+2:]))
+			binary.BigEndian.PutUint16(fontfile[coverage:], 9)
+			lookupIndex = i
+			break
+		}
+	}
+	if lookupIndex < 0 {
+		t.Errorf("single substitution not found")
+		return
+	}
+	for i := 0; i < int(binary.BigEndian.Uint16(fontfile[4:])); i++ {
+		if entry := fontfile[12+i*16:]; string(entry[:4]) == "GPOS" {
+			binary.BigEndian.PutUint32(entry[8:], uint32(len(fontfile)))
+		}
+	}
+
+	pdfdata := newPdfData()
+	fontRef, err := AddFontFile(pdfdata, fontfile)
+	if err != nil {
+		t.Errorf("font with unsupported layout format must be loaded %+v", err)
+		return
+	}
+	ttfp := &pdfdata.subsetFonts[fontRef].ttfp
+	if ttfp.GSUB() == nil || ttfp.GSUB().Lookups[lookupIndex].Subtables[0] != nil {
+		t.Errorf("unsupported subtable must be skipped")
+	}
+	if ttfp.GPOS() != nil || len(ttfp.LayoutErrors()) != 1 {
+		t.Errorf("broken GPOS must be dropped %v", ttfp.LayoutErrors())
+	}
+
+	//text is still shaped by GSUB that is left and kern table
+	metrics, err := MeasureText(pdfdata, fontRef, "AV", 10)
+	if err != nil {
+		t.Errorf("%+v", err)
+		return
+	}
+	if metrics.Width != 13.16 {
+		t.Errorf("wrong width %f", metrics.Width)
+	}
+
+	//first lookup of GPOS is single adjustment that its subtable has unsupported format
+	fontfile, err = ioutil.ReadFile("testing/ttf/thai_marks.ttf")
+	if err != nil {
+		t.Errorf("%+v", err)
+		return
+	}
+	gpos := testFontTableOffset(fontfile, "GPOS")
+	if gpos < 0 {
+		t.Errorf("GPOS not found")
+		return
+	}
+	lookupList = gpos + int(binary.BigEndian.Uint16(fontfile[gpos+8:]))
+	lookup := lookupList + int(binary.BigEndian.Uint16(fontfile[lookupList+2:]))
+	binary.BigEndian.PutUint16(fontfile[lookup:], font.GPOSLookupTypeSingle)
+	subtable := lookup + int(binary.BigEndian.Uint16(fontfile[lookup+6:]))
+	binary.BigEndian.PutUint16(fontfile[subtable:], 3)
+
+	fontRef, err = AddFontFile(pdfdata, fontfile)
+	if err != nil {
+		t.Errorf("font with unsupported layout format must be loaded %+v", err)
+		return
+	}
+	ttfp = &pdfdata.subsetFonts[fontRef].ttfp
+	if ttfp.GPOS() == nil || len(ttfp.LayoutErrors()) != 0 {
+		t.Errorf("GPOS must be loaded %v", ttfp.LayoutErrors())
+		return
+	}
+	if ttfp.GPOS().Lookups[0].Subtables[0] != nil {
+		t.Errorf("unsupported single adjustment must be skipped %+v", ttfp.GPOS().Lookups[0].Subtables[0])
+	}
+}
+
+func TestGPOSKerning(t *testing.T) {
+	fontfile, err := ioutil.ReadFile("testing/ttf/times.ttf")
+	if err != nil {
+		t.Errorf("%+v", err)
+		return
+	}
+
+	//parse without kern table, so kerning come from GPOS
+	ssf := newSubsetFont(fontfile)
+	ssf.ttfp.SetUseOpenTypeLayout(true)
+	err = ssf.ttfp.ParseByBytes(fontfile)
+	if err != nil {
+		t.Errorf("%+v", err)
+		return
+	}
+
+	a := ssf.charCodeToGlyphIndex('A')
+	v := ssf.charCodeToGlyphIndex('V')
+	var ccText contenteCacheText
+	if pairVal := ccText.kerning(ssf, "latn", 'A', 'V', a, v); pairVal.First.XAdvance != -264 {
+		t.Errorf("wrong kerning of AV %d", pairVal.First.XAdvance)
+	}
+
+	//values of both glyph are applied
+	gpos := ssf.ttfp.GPOS()
+	lookupIndexes := gpos.LookupIndexes("latn", "", []string{"kern"})
+	if len(lookupIndexes) == 0 {
+		t.Errorf("kern lookup not found")
+		return
+	}
+	lookup := &gpos.Lookups[lookupIndexes[0]]
+	lookup.Subtables = append([]interface{}{&font.PairPos{
+		Format:   1,
+		Coverage: font.Coverage{a: 0},
+		Pairs: map[uint]map[uint]font.PairValue{a: {v: {
+			First:  font.ValueRecord{XPlacement: 100, XAdvance: -200},
+			Second: font.ValueRecord{XPlacement: 50, XAdvance: 300},
+		}}},
+	}}, lookup.Subtables...)
+	glyphs, err := ccText.shapeRun(ssf, "AV", false, arabicJoiningForms([]rune("AV")))
+	if err != nil {
+		t.Errorf("%+v", err)
+		return
+	}
+	upem := int(ssf.ttfp.UnitsPerEm())
+	widths := ssf.ttfp.Widths()
+	if glyphs[0].xAdvance != convertTTFUnit2PDFUnit(int(widths[a]), upem)+convertTTFUnit2PDFUnit(-200, upem) ||
+		glyphs[0].xOffset != convertTTFUnit2PDFUnit(100, upem) ||
+		glyphs[1].xAdvance != convertTTFUnit2PDFUnit(int(widths[v]), upem)+convertTTFUnit2PDFUnit(300, upem) ||
+		glyphs[1].xOffset != convertTTFUnit2PDFUnit(50, upem) {
+		t.Errorf("wrong values of AV %+v", glyphs)
+	}
+
+	//second glyph that is class 0 is not matched
+	pairPos := font.PairPos{
+		Format:      2,
+		Coverage:    font.Coverage{a: 0},
+		ClassDef1:   font.ClassDef{a: 1},
+		ClassDef2:   font.ClassDef{v: 1},
+		ClassValues: [][]font.PairValue{{{}, {}}, {{}, {First: font.ValueRecord{XAdvance: -10}}}},
+	}
+	if _, ok := pairPos.Value(a, a); ok {
+		t.Errorf("class 0 must not be matched")
+	}
+	if value, ok := pairPos.Value(a, v); !ok || value.First.XAdvance != -10 {
+		t.Errorf("wrong value of class 1 %+v", value)
+	}
+}
+
+func TestToUnicodeLigature(t *testing.T) {
+	fontfile, err := ioutil.ReadFile("testing/ttf/times.ttf")
+	if err != nil {
+		t.Errorf("%+v", err)
+		return
+	}
+
+	ssf := newSubsetFont(fontfile)
+	err = ssf.init()
+	if err != nil {
+		t.Errorf("%+v", err)
+		return
+	}
+
+	ssf.addChars("f")
+
+	//glyph of fi ligature is not in text, so it map to source text "fi"
+	fi := ssf.charCodeToGlyphIndex(0xFB01)
+	ssf.addShapedGlyphs([]shapedGlyph{{glyph: fi, runes: []rune("fi")}})
+
+	p := newPdfData()
+	toUnicodeRefID := initObjectIDReal(1)
+	_, _, err = p.appendToUnicode(ssf, FontRef("times"), toUnicodeRefID, 1, 0)
+	if err != nil {
+		t.Errorf("%+v", err)
+		return
+	}
+
+	cmap := ""
+	for _, node := range *p.objects[toUnicodeRefID] {
+		if node.key.use == NodeKeyUseStream {
+			cmap = string(node.content.stream)
+		}
+	}
+	expect := fmt.Sprintf("1 beginbfchar\n<%04X><00660069>\nendbfchar\n", fi)
+	if !strings.Contains(cmap, expect) || !strings.Contains(cmap, "beginbfrange") {
+		t.Errorf("wrong ToUnicode %s", cmap)
+	}
+
+	//no-break space and soft hyphen share glyph with space and hyphen,
+	//thai characters are not in font (notdef)
+	ssf.addChars("\u00A0\u00AD\u0E01 -\u0E02")
+	_, _, err = p.appendToUnicode(ssf, FontRef("times"), toUnicodeRefID, 1, 0)
+	if err != nil {
+		t.Errorf("%+v", err)
+		return
+	}
+	for _, node := range *p.objects[toUnicodeRefID] {
+		if node.key.use == NodeKeyUseStream {
+			cmap = string(node.content.stream)
+		}
+	}
+	space := ssf.charCodeToGlyphIndex(' ')
+	hyphen := ssf.charCodeToGlyphIndex('-')
+	if !strings.Contains(cmap, fmt.Sprintf("<%04X><%04X><0020>", space, space)) ||
+		!strings.Contains(cmap, fmt.Sprintf("<%04X><%04X><002D>", hyphen, hyphen)) ||
+		strings.Contains(cmap, "<0000><0000>") {
+		t.Errorf("wrong ToUnicode of shared glyphs or notdef %s", cmap)
+	}
+}
+
+func TestMeasureText(t *testing.T) {
+	pdfdata, fontRef, err := testPdfDataWithFont(1)
+	if err != nil {
+		t.Errorf("%+v", err)
+		return
+	}
+
+	//A and V are 722 and kerning of AV is -128 (in 1/1000 of text space unit)
+	metrics, err := MeasureText(pdfdata, fontRef, "AV\nA", 10)
+	if err != nil {
+		t.Errorf("%+v", err)
+		return
+	}
+	if metrics.Width != 13.16 || metrics.Ascent <= 0 || metrics.Descent >= 0 || metrics.LineHeight != metrics.Ascent-metrics.Descent {
+		t.Errorf("wrong metrics %+v", metrics)
+	}
+
+	if len(pdfdata.subsetFonts[fontRef].glyphIndexs) != 0 {
+		t.Errorf("MeasureText must not add glyphs to subset font")
+	}
+}
+
+func TestInsertTextAutoShrink(t *testing.T) {
+	pdfdata, fontRef, err := testPdfDataWithFont(1)
+	if err != nil {
+		t.Errorf("%+v", err)
+		return
+	}
+
+	//width of text is 75.35 at size 7 and 80.73 at size 7.5
+	result, err := InsertTextBox(pdfdata, fontRef, "Somchai Jaidee Longname", 0, &Position{X: 10, Y: 10, W: 80, H: 20}, &TextOption{Size: 20, AutoShrink: true})
+	if err != nil {
+		t.Errorf("%+v", err)
+		return
+	}
+	if result.Size != 7 || result.Lines != 1 || result.Overflow != "" {
+		t.Errorf("wrong result %+v", result)
+	}
+
+	//not smaller than MinSize
+	result, err = InsertTextBox(pdfdata, fontRef, "Somchai Jaidee Longname", 0, &Position{X: 10, Y: 10, W: 20, H: 5}, &TextOption{Size: 20, AutoShrink: true, Wrap: true, MinSize: 6})
+	if err != nil {
+		t.Errorf("%+v", err)
+		return
+	}
+	if result.Size != 6 || result.Overflow == "" {
+		t.Errorf("wrong result %+v", result)
+	}
+
+	//chosen size is used in content
+	contents, err := testBuildContents(pdfdata)
+	if err != nil {
+		t.Errorf("%+v", err)
+		return
+	}
+	for _, op := range []string{"/F1 7.00 Tf\n", "/F1 6.00 Tf\n"} {
+		if !strings.Contains(contents[0], op) {
+			t.Errorf("%s not found in %s", op, contents[0])
+		}
+	}
+}
+
+func TestFontFallbacks(t *testing.T) {
+	pdfdata, fontRef, err := testPdfDataWithFont(1)
+	if err != nil {
+		t.Errorf("%+v", err)
+		return
+	}
+
+	err = SetFontFallbacks(pdfdata, fontRef, []FontRef{FontRef("notfound")})
+	if err != ErrFontRefNotFound {
+		t.Errorf("fallback that not added must fail")
+		return
+	}
+
+	//changing slice of caller does not change fallbacks
+	thaiFontRef, err := AddFontFilePath(pdfdata, "testing/ttf/thai_marks.ttf")
+	if err != nil {
+		t.Errorf("%+v", err)
+		return
+	}
+	fallbacks := []FontRef{thaiFontRef}
+	err = SetFontFallbacks(pdfdata, fontRef, fallbacks)
+	if err != nil {
+		t.Errorf("%+v", err)
+		return
+	}
+	fallbacks[0] = fontRef
+	if pdfdata.fontFallbacks[fontRef][0] != thaiFontRef {
+		t.Errorf("fallbacks is changed by caller %v", pdfdata.fontFallbacks[fontRef])
+	}
+	err = SetFontFallbacks(pdfdata, fontRef, nil)
+	if err != nil {
+		t.Errorf("%+v", err)
+		return
+	}
+
+	//runes that no font has use first font
+	ccText, err := newContentCacheText(pdfdata, fontRef, "")
+	if err != nil {
+		t.Errorf("%+v", err)
+		return
+	}
+	runs := ccText.splitRuns("AB \u0E01\u0E02 C")
+	if len(runs) != 1 || runs[0].fontRef != fontRef {
+		t.Errorf("wrong runs %+v", runs)
+	}
+
+	//runes that no font has are notdef, both in and out of BMP
+	for _, r := range []rune{0x0E01, 0x1F600} {
+		if glyphIndex := ccText.ssf.charCodeToGlyphIndex(r); glyphIndex != 0 {
+			t.Errorf("%U must be notdef %d", r, glyphIndex)
+		}
+	}
+	a, err := MeasureText(pdfdata, fontRef, "A", 10)
+	if err != nil {
+		t.Errorf("%+v", err)
+		return
+	}
+	metrics, err := MeasureText(pdfdata, fontRef, "A\u0E01\U0001F600", 10)
+	if err != nil {
+		t.Errorf("%+v", err)
+		return
+	}
+	notdef := float64(ccText.ssf.ttfp.Widths()[0]) * 10 / float64(ccText.ssf.ttfp.UnitsPerEm())
+	if math.Abs(metrics.Width-a.Width-2*notdef) > 0.02 {
+		t.Errorf("wrong width %f", metrics.Width)
+	}
+
+	_, err = InsertTextBox(pdfdata, fontRef, "A\u0E01", 0, &Position{X: 10, Y: 10, W: 80, H: 20}, nil)
+	if err != nil {
+		t.Errorf("%+v", err)
+		return
+	}
+	contents, err := testBuildContents(pdfdata)
+	if err != nil {
+		t.Errorf("%+v", err)
+		return
+	}
+	glyphA := ccText.ssf.charCodeToGlyphIndex('A')
+	if glyphs := testGlyphsOfContent(contents[0]); fmt.Sprint(glyphs) != fmt.Sprint([]uint{glyphA, 0}) {
+		t.Errorf("wrong glyphs %v of %s", glyphs, contents[0])
+	}
+}
+
+func TestCheckCoverage(t *testing.T) {
+	pdfdata, fontRef, err := testPdfDataWithFont(1)
+	if err != nil {
+		t.Errorf("%+v", err)
+		return
+	}
+
+	//last segment of cmap format 4 (0xFFFF) map to notdef
+	result, err := CheckCoverage(pdfdata, fontRef, "A\u0E01B\n\U0001F600\u0E01\uFFFF")
+	if err != nil {
+		t.Errorf("%+v", err)
+		return
+	}
+	if string(result.Missing) != "\u0E01\U0001F600" || string(result.Notdef) != "\uFFFF" {
+		t.Errorf("wrong result %+v", result)
+	}
+}
+
+func TestTextColorAndSpacing(t *testing.T) {
+	pdfdata, fontRef, err := testPdfDataWithFont(1)
+	if err != nil {
+		t.Errorf("%+v", err)
+		return
+	}
+
+	_, err = InsertTextBox(pdfdata, fontRef, "A", 0, &Position{X: 10, Y: 10, W: 80, H: 20}, &TextOption{FillColor: &Color{Space: ColorSpaceRGB, Values: []float64{1}}})
+	if errors.Cause(err) != ErrInvalidColor {
+		t.Errorf("wrong error of invalid color %+v", err)
+	}
+	_, err = InsertTextBox(pdfdata, fontRef, "A", 0, &Position{X: 10, Y: 10, W: 80, H: 20}, &TextOption{RenderMode: 8})
+	if errors.Cause(err) != ErrInvalidRenderMode {
+		t.Errorf("wrong error of invalid render mode %+v", err)
+	}
+	_, err = InsertRichText(pdfdata, []TextSpan{{FontRef: fontRef, Text: "B", FillColor: &Color{Space: ColorSpaceRGB, Values: []float64{1}}}}, 0, &Position{X: 10, Y: 10, W: 80, H: 20}, nil)
+	if errors.Cause(err) != ErrInvalidColor {
+		t.Errorf("wrong error of invalid span color %+v", err)
+	}
+	//failed insertion must not add glyphs to subset font
+	if glyphs := pdfdata.subsetFonts[fontRef].glyphs(); len(glyphs) != 0 {
+		t.Errorf("failed insertion add glyphs %v", glyphs)
+	}
+
+	ccText, err := newContentCacheText(pdfdata, fontRef, "A V")
+	if err != nil {
+		t.Errorf("%+v", err)
+		return
+	}
+	ccText.rect = Position{X: 10, Y: 10, W: 80, H: 20}
+	option := TextOption{
+		Size:        10,
+		FillColor:   ColorRGB(1, 0, 0),
+		StrokeColor: ColorGray(0.5),
+		RenderMode:  TextRenderFillStroke,
+		CharSpacing: 1,
+		WordSpacing: 2,
+		Rise:        3,
+	}
+	ccText.option = option
+	_, err = ccText.layout()
+	if err != nil {
+		t.Errorf("%+v", err)
+		return
+	}
+
+	//char spacing is 100 and word spacing is 200 (in 1/1000 of text space unit)
+	width := ccText.runsWidth(ccText.lines[0].runs)
+	ccText.option = TextOption{Size: 10}
+	noSpacingWidth, err := ccText.textWidth("A V")
+	if err != nil {
+		t.Errorf("%+v", err)
+		return
+	}
+	if width != noSpacingWidth+3*100+200 {
+		t.Errorf("wrong width %f (without spacing %f)", width, noSpacingWidth)
+	}
+
+	_, err = InsertTextBox(pdfdata, fontRef, "A V", 0, &Position{X: 10, Y: 10, W: 80, H: 20}, &option)
+	if err != nil {
+		t.Errorf("%+v", err)
+		return
+	}
+	contents, err := testBuildContents(pdfdata)
+	if err != nil {
+		t.Errorf("%+v", err)
+		return
+	}
+	content := contents[0]
+	for _, op := range []string{"q\n1.000 0.000 0.000 rg\n0.500 G\nBT\n", "2 Tr\n", "1.00 Tc\n", "3.00 Ts\n", "ET\nQ\n"} {
+		if !strings.Contains(content, op) {
+			t.Errorf("%s not found in %s", op, content)
+		}
+	}
+}
+
+func TestTextTransform(t *testing.T) {
+	pdfdata, fontRef, err := testPdfDataWithFont(1)
+	if err != nil {
+		t.Errorf("%+v", err)
+		return
+	}
+
+	_, err = InsertTextBox(pdfdata, fontRef, "A", 0, &Position{X: 10, Y: 10, W: 80, H: 20}, &TextOption{Matrix: &Matrix{A: 1, B: 2, C: 2, D: 4}})
+	if errors.Cause(err) != ErrInvalidMatrix {
+		t.Errorf("wrong error of invalid matrix %+v", err)
+	}
+
+	_, err = InsertTextBox(pdfdata, fontRef, "COPY", 0, &Position{X: 10, Y: 10, W: 80, H: 20}, &TextOption{Rotate: 90, Matrix: &Matrix{A: 1, D: 1, E: 5, F: 5}})
+	if err != nil {
+		t.Errorf("%+v", err)
+		return
+	}
+	contents, err := testBuildContents(pdfdata)
+	if err != nil {
+		t.Errorf("%+v", err)
+		return
+	}
+	//rotate around bottom-left of Position (10, 10), after original content
+	if !strings.HasPrefix(contents[0], "q\nQ\nq\nq\n1.00000 0.00000 0.00000 1.00000 5.00 5.00 cm\n0.00000 1.00000 -1.00000 0.00000 20.00 0.00 cm\nBT\n") {
+		t.Errorf("wrong transform %s", contents[0])
+	}
+}
+
+func TestTextDecoration(t *testing.T) {
+	pdfdata, fontRef, err := testPdfDataWithFont(1)
+	if err != nil {
+		t.Errorf("%+v", err)
+		return
+	}
+
+	ttfp := &pdfdata.subsetFonts[fontRef].ttfp
+	if ttfp.StrikeoutSize() <= 0 || ttfp.StrikeoutPosition() <= 0 {
+		t.Errorf("wrong strikeout metrics %d %d", ttfp.StrikeoutSize(), ttfp.StrikeoutPosition())
+	}
+
+	result, err := InsertTextBox(pdfdata, fontRef, "Somchai Jaidee", 0, &Position{X: 10, Y: 10, W: 60, H: 40}, &TextOption{Wrap: true, Underline: true, Strikeout: true})
+	if err != nil {
+		t.Errorf("%+v", err)
+		return
+	}
+	contents, err := testBuildContents(pdfdata)
+	if err != nil {
+		t.Errorf("%+v", err)
+		return
+	}
+	//underline and strikeout of 2 lines
+	if result.Lines != 2 || strings.Count(contents[0], " re f\n") != 4 {
+		t.Errorf("wrong decoration %s", contents[0])
+	}
+}
+
+func TestVerticalText(t *testing.T) {
+	pdfdata, fontRef, err := testPdfDataWithFont(1)
+	if err != nil {
+		t.Errorf("%+v", err)
+		return
+	}
+	err = SetFontVertical(pdfdata, fontRef, true)
+	if err != nil {
+		t.Errorf("%+v", err)
+		return
+	}
+
+	ccText, err := newContentCacheText(pdfdata, fontRef, "AB")
+	if err != nil {
+		t.Errorf("%+v", err)
+		return
+	}
+	ccText.rect = Position{X: 10, Y: 10, W: 40, H: 60}
+	ccText.option = TextOption{Size: 10}
+	_, err = ccText.layout()
+	if err != nil {
+		t.Errorf("%+v", err)
+		return
+	}
+
+	//times.ttf has no vmtx, advance height is ascender - descender
+	ascent, descent := ccText.ascentAndDescent()
+	width := ccText.runsWidth(ccText.lines[0].runs)
+	if math.Abs(width-2*(ascent-descent)*100) > 2 {
+		t.Errorf("wrong width %f", width)
+	}
+
+	//first column is at right of Position
+	_, err = InsertTextBox(pdfdata, fontRef, "AB", 0, &ccText.rect, &ccText.option)
+	if err != nil {
+		t.Errorf("%+v", err)
+		return
+	}
+	contents, err := testBuildContents(pdfdata)
+	if err != nil {
+		t.Errorf("%+v", err)
+		return
+	}
+	td := fmt.Sprintf("%0.2f %0.2f TD\n", round2(50-(ascent-descent)/2), 70.0)
+	if !strings.Contains(contents[0], td) {
+		t.Errorf("%s not found in %s", td, contents[0])
+	}
+
+	//font is added to pdf by BuildPdf
+	var hasIdentityV, hasW2 bool
+	for _, nodes := range pdfdata.objects {
+		for _, node := range *nodes {
+			if node.key.name == "Encoding" && node.content.str == "/Identity-V" {
+				hasIdentityV = true
+			} else if node.key.name == "W2" {
+				hasW2 = true
+			}
+		}
+	}
+	if !hasIdentityV || !hasW2 {
+		t.Errorf("vertical font must have /Identity-V and /W2")
+	}
+
+	//W2 of no nu (2) and sara aa (8) from vmtx of thai_marks.ttf (vertical origin is at 880),
+	//or from ascender (900) and descender (-200) if vmtx is broken
+	fontfile, err := ioutil.ReadFile("testing/ttf/thai_marks.ttf")
+	if err != nil {
+		t.Errorf("%+v", err)
+		return
+	}
+	brokenFontfile := append([]byte(nil), fontfile...)
+	for i := 0; i < int(binary.BigEndian.Uint16(brokenFontfile[4:])); i++ {
+		if entry := brokenFontfile[12+i*16:]; string(entry[:4]) == "vmtx" {
+			binary.BigEndian.PutUint32(entry[8:], uint32(len(brokenFontfile)))
+		}
+	}
+	for i, file := range [][]byte{fontfile, brokenFontfile} {
+		pdfdata = testPdfDataOfPages([][4]float64{{0, 0, 595, 842}})
+		fontRef, err = AddFontFile(pdfdata, file)
+		if err != nil {
+			t.Errorf("font with broken vmtx must be loaded %+v", err)
+			return
+		}
+		err = SetFontVertical(pdfdata, fontRef, true)
+		if err != nil {
+			t.Errorf("%+v", err)
+			return
+		}
+		//width of vertical text is sum of advance heights (not advance widths 600 + 400)
+		metrics, err := MeasureText(pdfdata, fontRef, "นา", 10)
+		if err != nil {
+			t.Errorf("%+v", err)
+			return
+		}
+		if expect := []float64{19, 22}[i]; math.Abs(metrics.Width-expect) > 0.001 {
+			t.Errorf("wrong width of vertical text %f", metrics.Width)
+		}
+		err = InsertText(pdfdata, fontRef, "นา", 0, &Position{X: 10, Y: 10, W: 40, H: 60}, &TextOption{Size: 10})
+		if err != nil {
+			t.Errorf("%+v", err)
+			return
+		}
+		err = pdfdata.build()
+		if err != nil {
+			t.Errorf("%+v", err)
+			return
+		}
+		var w2 string
+		for _, nodes := range pdfdata.objects {
+			for _, node := range *nodes {
+				if node.key.name == "W2" {
+					data, err := pdfdata.bytesOfNodesByID(node.content.refTo)
+					if err != nil {
+						t.Errorf("%+v", err)
+						return
+					}
+					w2 = string(data)
+				}
+			}
+		}
+		expects := [][]string{{"2[-900 300 880]", "8[-1000 200 880]"}, {"2[-1100 300 900]", "8[-1100 200 900]"}}[i]
+		for _, expect := range expects {
+			if !strings.Contains(w2, expect) {
+				t.Errorf("%s not found in W2 %s", expect, w2)
+			}
+		}
+	}
+}
+
+func TestBidiText(t *testing.T) {
+
+	var levels []int
+	for _, run := range splitBidiRuns("abc \u05E9\u05DC\u05D5\u05DD 123 def", false) {
+		levels = append(levels, run.level)
+	}
+	if fmt.Sprint(levels) != "[0 1 2 0]" {
+		t.Errorf("wrong levels %v", levels)
+	}
+
+	pdfdata, fontRef, err := testPdfDataWithFont(1)
+	if err != nil {
+		t.Errorf("%+v", err)
+		return
+	}
+
+	//beh in "\u0628\u064A\u062A" (bayt) use initial form, not isolated form
+	ccText, err := newContentCacheText(pdfdata, fontRef, "abc \u0628\u064A\u062A")
+	if err != nil {
+		t.Errorf("%+v", err)
+		return
+	}
+	ccText.rect = Position{X: 10, Y: 10, W: 200, H: 20}
+	_, err = ccText.layout()
+	if err != nil {
+		t.Errorf("%+v", err)
+		return
+	}
+	isolated := pdfdata.subsetFonts[fontRef].charCodeToGlyphIndex(0x0628)
+	runs := ccText.lines[0].runs
+	if len(runs) != 2 || runs[1].level != 1 {
+		t.Errorf("wrong runs %+v", runs)
+		return
+	}
+	glyphs := runs[1].glyphs
+	last := glyphs[len(glyphs)-1]
+	if string(last.runes) != "\u0628" || last.glyph == isolated {
+		t.Errorf("beh must be last glyph (visual order) in initial form %+v", glyphs)
+	}
+
+	//right-to-left paragraph is aligned right
+	_, err = InsertTextBox(pdfdata, fontRef, "\u0628\u064A\u062A", 0, &ccText.rect, &TextOption{Size: 10})
+	if err != nil {
+		t.Errorf("%+v", err)
+		return
+	}
+	metrics, err := MeasureText(pdfdata, fontRef, "\u0628\u064A\u062A", 10)
+	if err != nil {
+		t.Errorf("%+v", err)
+		return
+	}
+	contents, err := testBuildContents(pdfdata)
+	if err != nil {
+		t.Errorf("%+v", err)
+		return
+	}
+	if x := fmt.Sprintf("Tf\n%0.2f ", round2(210-metrics.Width)); !strings.Contains(contents[0], x) {
+		t.Errorf("%s not found in %s", x, contents[0])
+	}
+
+	//joining forms are found from whole paragraph, so beh is still in initial form when word is broken into lines
+	ccText.rect = Position{X: 10, Y: 10, W: 1, H: 100}
+	ccText.option.Wrap = true
+	_, err = ccText.layout()
+	if err != nil {
+		t.Errorf("%+v", err)
+		return
+	}
+	if len(ccText.lines) < 3 || ccText.lines[0].runs[0].glyphs[0].glyph == isolated {
+		t.Errorf("beh must be in initial form %+v", ccText.lines)
+	}
+
+	//zero width space does not join
+	if forms := arabicJoiningForms([]rune("\u0628\u200B\u0628")); fmt.Sprint(forms) != "[isol  isol]" {
+		t.Errorf("wrong forms %v", forms)
+	}
+
+	if mirrorRune('(') != ')' || mirrorRune(0x300B) != 0x300A || mirrorRune('\u00AB') != '\u00BB' || mirrorRune('a') != 'a' {
+		t.Errorf("wrong mirrored characters")
+	}
+}
+
+func TestKernOverride(t *testing.T) {
+	pdfdata, fontRef, err := testPdfDataWithFont(3)
+	if err != nil {
+		t.Errorf("%+v", err)
+		return
+	}
+
+	//A and V are 722 and kerning of AV is -128 (in 1/1000 of text space unit)
+	widths := []float64{}
+	for i, fn := range []FuncKernOverride{
+		nil,
+		KernOverrideMap(map[string]int{"AV": 0, "VA": -2048}),
+		func(leftRune rune, rightRune rune, leftPair uint, rightPair uint, pairVal int) int {
+			return pairVal * 2
+		},
+	} {
+		err = SetKernOverride(pdfdata, fontRef, fn)
+		if err != nil {
+			t.Errorf("%+v", err)
+			return
+		}
+		metrics, err := MeasureText(pdfdata, fontRef, "AV", 10)
+		if err != nil {
+			t.Errorf("%+v", err)
+			return
+		}
+		widths = append(widths, metrics.Width)
+
+		//text that is inserted after override is set use it
+		_, err = InsertTextBox(pdfdata, fontRef, "AV", i, &Position{X: 10, Y: 10, W: 100, H: 20}, &TextOption{Size: 10, Align: AlignRight})
+		if err != nil {
+			t.Errorf("%+v", err)
+			return
+		}
+	}
+	if fmt.Sprint(widths) != "[13.16 14.44 11.87]" {
+		t.Errorf("wrong widths %v", widths)
+	}
+
+	contents, err := testBuildContents(pdfdata)
+	if err != nil {
+		t.Errorf("%+v", err)
+		return
+	}
+	for i, width := range widths {
+		if x := fmt.Sprintf("Tf\n%0.2f ", round2(110-width)); !strings.Contains(contents[i], x) {
+			t.Errorf("%s not found in %s", x, contents[i])
+		}
+	}
+
+	//font without kern table use pair adjustment of GPOS
+	fontfile, err := ioutil.ReadFile("testing/ttf/times.ttf")
+	if err != nil {
+		t.Errorf("%+v", err)
+		return
+	}
+	for i := 0; i < int(binary.BigEndian.Uint16(fontfile[4:])); i++ {
+		if entry := fontfile[12+i*16:]; string(entry[:4]) == "kern" {
+			copy(entry, "xern")
+		}
+	}
+	fontRef, err = AddFontFile(pdfdata, fontfile)
+	if err != nil {
+		t.Errorf("%+v", err)
+		return
+	}
+	ssf := pdfdata.subsetFonts[fontRef]
+	if ssf.ttfp.Kern() != nil {
+		t.Errorf("kern table must not be found")
+		return
+	}
+
+	//pair of GPOS has placements and advances of both glyphs
+	a := ssf.charCodeToGlyphIndex('A')
+	v := ssf.charCodeToGlyphIndex('V')
+	gpos := ssf.ttfp.GPOS()
+	lookupIndexes := gpos.LookupIndexes("latn", "", []string{"kern"})
+	if len(lookupIndexes) == 0 {
+		t.Errorf("kern lookup not found")
+		return
+	}
+	lookup := &gpos.Lookups[lookupIndexes[0]]
+	lookup.Subtables = append([]interface{}{&font.PairPos{
+		Format:   1,
+		Coverage: font.Coverage{a: 0},
+		Pairs: map[uint]map[uint]font.PairValue{a: {v: {
+			First:  font.ValueRecord{XPlacement: 100, XAdvance: -200},
+			Second: font.ValueRecord{XPlacement: 50, XAdvance: 300},
+		}}},
+	}}, lookup.Subtables...)
+
+	var pairVals []int
+	var results []string
+	var ccText contenteCacheText
+	for _, fn := range []FuncKernOverride{
+		func(leftRune rune, rightRune rune, leftPair uint, rightPair uint, pairVal int) int {
+			pairVals = append(pairVals, pairVal)
+			return pairVal
+		},
+		KernOverrideMap(map[string]int{"AV": 0}),
+	} {
+		err = SetKernOverride(pdfdata, fontRef, fn)
+		if err != nil {
+			t.Errorf("%+v", err)
+			return
+		}
+		glyphs, err := ccText.shapeRun(ssf, "AV", false, arabicJoiningForms([]rune("AV")))
+		if err != nil {
+			t.Errorf("%+v", err)
+			return
+		}
+		results = append(results, fmt.Sprintf("%d %d %d %d", glyphs[0].xAdvance, glyphs[0].xOffset, glyphs[1].xAdvance, glyphs[1].xOffset))
+	}
+	//value from font is kept, suppressed pair has only widths of glyphs (722)
+	if fmt.Sprint(pairVals) != "[100]" {
+		t.Errorf("wrong value of pair %v", pairVals)
+	}
+	if strings.Join(results, ",") != "625 48 868 24,722 0 722 0" {
+		t.Errorf("wrong glyphs of AV %v", results)
+	}
+}
+
+func TestRichText(t *testing.T) {
+	pdfdata, fontRef, err := testPdfDataWithFont(4)
+	if err != nil {
+		t.Errorf("%+v", err)
+		return
+	}
+
+	_, err = InsertRichText(pdfdata, nil, 0, &Position{X: 10, Y: 10, W: 80, H: 20}, nil)
+	if err != ErrNoTextSpan {
+		t.Errorf("rich text without span must fail")
+	}
+
+	//"Name: Somchai Jaidee" fit in 100 and last word is wrapped
+	red := ColorRGB(1, 0, 0)
+	result, err := InsertRichText(pdfdata, []TextSpan{
+		{FontRef: fontRef, Text: "Name: ", Size: 12, FillColor: red},
+		{FontRef: fontRef, Text: "Somchai Jaidee Longname"},
+	}, 0, &Position{X: 10, Y: 10, W: 100, H: 30}, &TextOption{Size: 10, Wrap: true})
+	if err != nil {
+		t.Errorf("%+v", err)
+		return
+	}
+	if result.Lines != 2 || result.Overflow != "" {
+		t.Errorf("wrong result %+v", result)
+	}
+
+	//word across spans ("Hel" + "lo") is not broken, line that does not fit in height is overflow
+	hello, err := MeasureText(pdfdata, fontRef, "Hello", 10)
+	if err != nil {
+		t.Errorf("%+v", err)
+		return
+	}
+	result, err = InsertRichText(pdfdata, []TextSpan{
+		{FontRef: fontRef, Text: "Hel", FillColor: red},
+		{FontRef: fontRef, Text: "lo wonderful"},
+	}, 1, &Position{X: 10, Y: 10, W: hello.Width + 1, H: 15}, &TextOption{Size: 10, Wrap: true})
+	if err != nil {
+		t.Errorf("%+v", err)
+		return
+	}
+	if result.Lines != 1 || result.Overflow != "wonderful" {
+		t.Errorf("wrong result %+v", result)
+	}
+
+	//sizes of all spans are reduced until text fit in rect
+	result, err = InsertRichText(pdfdata, []TextSpan{
+		{FontRef: fontRef, Text: "Name: ", Size: 12, FillColor: red},
+		{FontRef: fontRef, Text: "Somchai Jaidee Longname"},
+	}, 1, &Position{X: 10, Y: 30, W: 100, H: 12}, &TextOption{Size: 10, Wrap: true, AutoShrink: true})
+	if err != nil {
+		t.Errorf("%+v", err)
+		return
+	}
+	if result.Lines != 1 || result.Overflow != "" || result.Size >= 10 || result.Size < defaultMinFontSize {
+		t.Errorf("wrong result of auto shrink %+v", result)
+	}
+
+	//spaces at end of line are trimmed from all pieces, so "Name:" is aligned right
+	result, err = InsertRichText(pdfdata, []TextSpan{
+		{FontRef: fontRef, Text: "Name:", Size: 12},
+		{FontRef: fontRef, Text: "  "},
+		{FontRef: fontRef, Text: " ", Size: 14},
+	}, 2, &Position{X: 10, Y: 10, W: 100, H: 30}, &TextOption{Size: 10, Align: AlignRight})
+	if err != nil {
+		t.Errorf("%+v", err)
+		return
+	}
+	name, err := MeasureText(pdfdata, fontRef, "Name:", 12)
+	if err != nil {
+		t.Errorf("%+v", err)
+		return
+	}
+
+	//right-to-left paragraph, "abc" is on the left of arabic word and beh join with next letter in other span
+	_, err = InsertRichText(pdfdata, []TextSpan{
+		{FontRef: fontRef, Text: "\u0628"},
+		{FontRef: fontRef, Text: "\u064A\u062A ", FillColor: red},
+		{FontRef: fontRef, Text: "abc"},
+	}, 3, &Position{X: 10, Y: 10, W: 100, H: 30}, &TextOption{Size: 10})
+	if err != nil {
+		t.Errorf("%+v", err)
+		return
+	}
+
+	contents, err := testBuildContents(pdfdata)
+	if err != nil {
+		t.Errorf("%+v", err)
+		return
+	}
+
+	for _, op := range []string{" 12.00 Tf\n1.000 0.000 0.000 rg\n", " 10.00 Tf\n0.000 g\n"} {
+		if !strings.Contains(contents[0], op) {
+			t.Errorf("%s not found in %s", op, contents[0])
+		}
+	}
+
+	if !strings.Contains(contents[2], fmt.Sprintf("%0.2f ", round2(110-name.Width))) {
+		t.Errorf("wrong x of right aligned line %s", contents[2])
+	}
+
+	ssf := pdfdata.subsetFonts[fontRef]
+	isolated := ssf.charCodeToGlyphIndex(0x0628)
+	a := ssf.charCodeToGlyphIndex('a')
+	glyphs := testGlyphsOfContent(contents[3])
+	if len(glyphs) != 7 || glyphs[0] != a || glyphs[len(glyphs)-1] == isolated {
+		t.Errorf("wrong glyphs %v of %s", glyphs, contents[3])
+	}
+}
+
+//testGlyphsOfContent glyph indexes in TJ operators of content (in order of content)
+func testGlyphsOfContent(content string) []uint {
+	var glyphs []uint
+	for _, part := range strings.Split(content, "<")[1:] {
+		hex := part[:strings.Index(part, ">")]
+		for i := 0; i+4 <= len(hex); i += 4 {
+			var glyph uint
+			fmt.Sscanf(hex[i:i+4], "%04X", &glyph)
+			glyphs = append(glyphs, glyph)
+		}
+	}
+	return glyphs
+}
+
+func TestJustify(t *testing.T) {
+	pdfdata, fontRef, err := testPdfDataWithFont(2)
+	if err != nil {
+		t.Errorf("%+v", err)
+		return
+	}
+
+	ccText, err := newContentCacheText(pdfdata, fontRef, "aaa bbb ccc ddd eee fff\nggg hhh")
+	if err != nil {
+		t.Errorf("%+v", err)
+		return
+	}
+	ccText.rect = Position{X: 10, Y: 10, W: 60, H: 100}
+	ccText.option = TextOption{Size: 10, Wrap: true, Align: AlignJustify}
+	_, err = ccText.layout()
+	if err != nil {
+		t.Errorf("%+v", err)
+		return
+	}
+	if len(ccText.lines) != 3 {
+		t.Errorf("wrong lines %+v", ccText.lines)
+		return
+	}
+	//last line of each paragraph is not justified
+	for i, line := range ccText.lines {
+		width := ccText.runsWidth(line.runs) * ccText.fontSize() / 1000
+		if isJustified := math.Abs(width-60) < 0.01; isJustified == line.isEnd {
+			t.Errorf("wrong width %f of line %d", width, i)
+		}
+	}
+
+	ccRichText := contenteCacheRichText{rect: Position{X: 10, Y: 10, W: 60, H: 100}, option: TextOption{Size: 10, Wrap: true, Align: AlignJustify}}
+	for _, text := range []string{"aaa bbb ", "ccc ddd eee fff"} {
+		ccText, err := newContentCacheText(pdfdata, fontRef, text)
+		if err != nil {
+			t.Errorf("%+v", err)
+			return
+		}
+		ccText.option = ccRichText.option
+		ccRichText.spans = append(ccRichText.spans, ccText)
+	}
+	_, err = ccRichText.layout()
+	if err != nil {
+		t.Errorf("%+v", err)
+		return
+	}
+	if len(ccRichText.lines) != 2 || math.Abs(ccRichText.lines[0].width-60) > 0.01 || ccRichText.lines[1].width >= 59 {
+		t.Errorf("wrong rich text lines %+v", ccRichText.lines)
+	}
+
+	//space of spans in different size is rounded, the rest is added to last gap (less than half of 1/1000 of size 13)
+	ccRichText = contenteCacheRichText{rect: Position{X: 10, Y: 10, W: 61, H: 100}, option: TextOption{Size: 10, Wrap: true, Align: AlignJustify}}
+	for i, text := range []string{"aa bb cc ", "dd ee ff ", "gg hh ii jj kk"} {
+		ccText, err := newContentCacheText(pdfdata, fontRef, text)
+		if err != nil {
+			t.Errorf("%+v", err)
+			return
+		}
+		ccText.option = ccRichText.option
+		ccText.option.Size = []float64{10, 7, 13}[i]
+		ccRichText.spans = append(ccRichText.spans, ccText)
+	}
+	_, err = ccRichText.layout()
+	if err != nil {
+		t.Errorf("%+v", err)
+		return
+	}
+	if len(ccRichText.lines) != 3 || math.Abs(ccRichText.lines[0].width-61) > 0.0065 || math.Abs(ccRichText.lines[1].width-61) > 0.0065 {
+		t.Errorf("wrong rich text lines of spans in different size %+v", ccRichText.lines)
+	}
+
+	//only first line is different from text that is not justified
+	for i, align := range []int{AlignJustify, AlignLeft} {
+		_, err = InsertTextBox(pdfdata, fontRef, "aaa bbb ccc ddd eee fff\nggg hhh", i, &ccText.rect, &TextOption{Size: 10, Wrap: true, Align: align})
+		if err != nil {
+			t.Errorf("%+v", err)
+			return
+		}
+	}
+	contents, err := testBuildContents(pdfdata)
+	if err != nil {
+		t.Errorf("%+v", err)
+		return
+	}
+	justified, notJustified := strings.Split(contents[0], "TD\n"), strings.Split(contents[1], "TD\n")
+	if len(justified) != 4 || justified[1] == notJustified[1] || strings.Join(justified[2:], "") != strings.Join(notJustified[2:], "") {
+		t.Errorf("wrong justified content %s", contents[0])
+	}
+}
+
+func TestUnitAndOrigin(t *testing.T) {
+	//page 0 is A4, page 1 is letter, page 2 is A4 that does not start at (0, 0)
+	pdfdata := testPdfDataOfPages([][4]float64{{0, 0, 595, 842}, {0, 0, 612, 792}, {10, 20, 605, 862}})
+
+	err := SetUnit(pdfdata, 9)
+	if err != ErrInvalidUnit {
+		t.Errorf("unit 9 must fail")
+	}
+	err = SetUnit(pdfdata, UnitMM)
+	if err != nil {
+		t.Errorf("%+v", err)
+		return
+	}
+
+	//default origin is bottom-left corner of page
+	var results []string
+	for _, pageIndex := range []int{0, 2} {
+		rect, err := pdfdata.toUserSpace(pageIndex, Position{X: 25.4, Y: 25.4, W: 254, H: 12.7})
+		if err != nil {
+			t.Errorf("%+v", err)
+			return
+		}
+		results = append(results, fmt.Sprintf("%0.2f", rect))
+	}
+	if strings.Join(results, ",") != "{72.00 72.00 720.00 36.00},{82.00 92.00 720.00 36.00}" {
+		t.Errorf("wrong rects %v", results)
+	}
 
-	isExists, err := exists("testing/out/")
+	err = SetOrigin(pdfdata, OriginTopLeft)
 	if err != nil {
-		t.Errorf("can not create testing/out/ for test")
+		t.Errorf("%+v", err)
 		return
 	}
-	if !isExists {
-		err := os.MkdirAll("testing/out/", 0777)
+	//y is flipped by height of each page
+	results = nil
+	for pageIndex := 0; pageIndex < 3; pageIndex++ {
+		rect, err := pdfdata.toUserSpace(pageIndex, Position{X: 25.4, Y: 25.4, W: 254, H: 12.7})
 		if err != nil {
-			t.Errorf("can not create testing/out/ for test")
+			t.Errorf("%+v", err)
 			return
 		}
+		results = append(results, fmt.Sprintf("%0.2f", rect))
+	}
+	if strings.Join(results, ",") != "{72.00 734.00 720.00 36.00},{72.00 684.00 720.00 36.00},{82.00 754.00 720.00 36.00}" {
+		t.Errorf("wrong rects %v", results)
 	}
 
-	testRead(t, "testing/pdf/pdf_from_gopdf.pdf", "testing/out/pdf_from_gopdf_out.pdf")
-	testRead(t, "testing/out/pdf_from_gopdf_out.pdf", "")
+	_, err = pdfdata.toUserSpace(3, Position{})
+	if errors.Cause(err) != ErrPageNotFound {
+		t.Errorf("page 3 must not be found %+v", err)
+	}
 
-	testRead(t, "testing/pdf/twopage.pdf", "testing/out/twopage_out.pdf")
-	testRead(t, "testing/out/twopage_out.pdf", "")
+	//baseline of text at bottom of rect is above bottom of rect by descent
+	fontRef, err := AddFontFilePath(pdfdata, "testing/ttf/times.ttf")
+	if err != nil {
+		t.Errorf("%+v", err)
+		return
+	}
+	err = InsertText(pdfdata, fontRef, "Hello", 2, &Position{X: 25.4, Y: 25.4, W: 254, H: 12.7}, &TextOption{Size: 10, Align: AlignLeft | AlignBottom})
+	if err != nil {
+		t.Errorf("%+v", err)
+		return
+	}
+	metrics, err := MeasureText(pdfdata, fontRef, "Hello", 10)
+	if err != nil {
+		t.Errorf("%+v", err)
+		return
+	}
+	contents, err := testBuildContents(pdfdata)
+	if err != nil {
+		t.Errorf("%+v", err)
+		return
+	}
+	if td := fmt.Sprintf("Tf\n82.00 %0.2f TD\n", round2(754-metrics.Descent)); !strings.Contains(contents[2], td) {
+		t.Errorf("%s not found in %s", td, contents[2])
+	}
+}
 
-	testRead(t, "testing/pdf/jpg.pdf", "testing/out/jpg_out.pdf")
-	testRead(t, "testing/out/jpg_out.pdf", "")
+func TestRotatedPage(t *testing.T) {
+	//page 0 is turned 90 degrees, page 1 inherits 270 degrees from page tree
+	pdfdata, fontRef, err := testPdfDataWithFont(2)
+	if err != nil {
+		t.Errorf("%+v", err)
+		return
+	}
+	pdfdata.objects[initObjectIDReal(1)].append(pdfNode{key: nodeKey{use: NodeKeyUseName, name: "Rotate"}, content: nodeContent{use: NodeContentUseString, str: "270"}})
+	pdfdata.objects[initObjectIDReal(2)].append(pdfNode{key: nodeKey{use: NodeKeyUseName, name: "Rotate"}, content: nodeContent{use: NodeContentUseString, str: "90"}})
 
-	testRead(t, "testing/pdf/pdf_from_chrome_50_win10.pdf", "testing/out/pdf_from_chrome_50_win10_out.pdf")
-	testRead(t, "testing/out/pdf_from_chrome_50_win10_out.pdf", "")
+	//page is landscape when displayed
+	err = SetOrigin(pdfdata, OriginTopLeft)
+	if err != nil {
+		t.Errorf("%+v", err)
+		return
+	}
+	for pageIndex := 0; pageIndex < 2; pageIndex++ {
+		rect, err := pdfdata.toUserSpace(pageIndex, Position{X: 10, Y: 10, W: 100, H: 20})
+		if err != nil {
+			t.Errorf("%+v", err)
+			return
+		}
+		if fmt.Sprintf("%0.2f", rect) != "{10.00 565.00 100.00 20.00}" {
+			t.Errorf("wrong rect %0.2f of page %d", rect, pageIndex)
+		}
+		err = InsertText(pdfdata, fontRef, "Hello", pageIndex, &Position{X: 10, Y: 10, W: 100, H: 20}, nil)
+		if err != nil {
+			t.Errorf("%+v", err)
+			return
+		}
+	}
 
-	testRead(t, "testing/pdf/pdf_from_docx.pdf", "testing/out/pdf_from_docx_out.pdf")
-	testRead(t, "testing/out/pdf_from_docx_out.pdf", "")
+	contents, err := testBuildContents(pdfdata)
+	if err != nil {
+		t.Errorf("%+v", err)
+		return
+	}
+	transforms := []string{
+		"q\n0.00000 1.00000 -1.00000 0.00000 595.00 0.00 cm\n",
+		"q\n0.00000 -1.00000 1.00000 0.00000 0.00 842.00 cm\n",
+	}
+	for pageIndex, transform := range transforms {
+		if !strings.HasPrefix(contents[pageIndex], "q\nQ\n"+transform) || !strings.HasSuffix(contents[pageIndex], "ET\nQ\n") {
+			t.Errorf("wrong content of page %d %s", pageIndex, contents[pageIndex])
+		}
+	}
+}
 
-	//testRead(t, "testing/pdf/pdf_from_iia.pdf", "testing/out/pdf_from_iia_out.pdf")
-	//testRead(t, "testing/out/pdf_from_iia_out.pdf", "")
+func TestContentIsolation(t *testing.T) {
+	pdfdata, fontRef, err := testPdfDataWithFont(1)
+	if err != nil {
+		t.Errorf("%+v", err)
+		return
+	}
+	//original content that does not restore CTM and color
+	pdfdata.setStreamObj(initObjectIDReal(3), bytes.NewBufferString("0.5 0 0 0.5 100 100 cm 1 0 0 rg 0 0 10 10 re W n"))
+	err = InsertText(pdfdata, fontRef, "Hello", 0, &Position{X: 10, Y: 10, W: 100, H: 20}, nil)
+	if err != nil {
+		t.Errorf("%+v", err)
+		return
+	}
+
+	contents, err := testBuildContents(pdfdata)
+	if err != nil {
+		t.Errorf("%+v", err)
+		return
+	}
+	content := contents[0]
+	if !strings.HasPrefix(content, "q\n0.5 0 0 0.5 100 100 cm 1 0 0 rg 0 0 10 10 re W n\nQ\nq\nBT\n") || !strings.HasSuffix(content, "ET\nQ\n") {
+		t.Errorf("wrong content %s", content)
+	}
 }
 
-func _TestMerge(t *testing.T) {
-	testMerge(t, "testing/pdf/twopage.pdf", "testing/pdf/pdf_from_gopdf.pdf", "testing/out/twopage_and_pdf_from_gopdf_out.pdf")
-	testMerge(t, "testing/pdf/jpg.pdf", "testing/pdf/pdf_from_docx.pdf", "testing/out/jpg_and_pdf_from_docx_out.pdf")
+func TestLayer(t *testing.T) {
+	pdfdata, fontRef, err := testPdfDataWithFont(1)
+	if err != nil {
+		t.Errorf("%+v", err)
+		return
+	}
+	pdfdata.setStreamObj(initObjectIDReal(3), bytes.NewBufferString("1 g 0 0 595 842 re f"))
+
+	err = InsertText(pdfdata, fontRef, "Stamp", 0, &Position{X: 10, Y: 10, W: 100, H: 20}, &TextOption{Layer: 2})
+	if errors.Cause(err) != ErrInvalidLayer {
+		t.Errorf("layer 2 must fail")
+	}
+	for _, layer := range []int{LayerOverlay, LayerUnderlay} {
+		err = InsertText(pdfdata, fontRef, "Stamp", 0, &Position{X: 10, Y: 10, W: 100, H: 20}, &TextOption{Layer: layer})
+		if err != nil {
+			t.Errorf("%+v", err)
+			return
+		}
+	}
+
+	contents, err := testBuildContents(pdfdata)
+	if err != nil {
+		t.Errorf("%+v", err)
+		return
+	}
+	//underlay, original content, overlay
+	content := contents[0]
+	if !strings.HasPrefix(content, "q\nBT\n") || !strings.Contains(content, "ET\nQ\nq\n1 g 0 0 595 842 re f\nQ\nq\nBT\n") || !strings.HasSuffix(content, "ET\nQ\n") {
+		t.Errorf("wrong content %s", content)
+	}
 }
 
-func TestInsertText(t *testing.T) {
-	err := testInsertText("testing/pdf/pdf_from_gopdf.pdf", "testing/out/pdf_from_gopdf_out_inserttext.pdf")
+func TestContentsArray(t *testing.T) {
+	pdfdata := testPdfDataOfPages([][4]float64{{0, 0, 595, 842}})
+	//contents of page is array of flate stream and stream
+	var zbuff bytes.Buffer
+	zw := zlib.NewWriter(&zbuff)
+	zw.Write([]byte("0 0 m 10 10 l"))
+	zw.Close()
+	pageID, arrayID := initObjectIDReal(2), initObjectIDFake(100, 2)
+	streamIDs := []objectID{initObjectIDReal(100), initObjectIDReal(101)}
+	pdfdata.objects[streamIDs[0]] = &pdfNodes{
+		{key: nodeKey{use: NodeKeyUseName, name: "Filter"}, content: nodeContent{use: NodeContentUseString, str: "/FlateDecode"}},
+		{key: nodeKey{use: NodeKeyUseStream}, content: nodeContent{use: NodeContentUseStream, stream: zbuff.Bytes()}},
+	}
+	pdfdata.objects[streamIDs[1]] = &pdfNodes{
+		{key: nodeKey{use: NodeKeyUseStream}, content: nodeContent{use: NodeContentUseStream, stream: []byte("S")}},
+	}
+	pdfdata.objects[arrayID] = &pdfNodes{
+		{key: nodeKey{use: NodeKeyUseIndex, index: 0}, content: nodeContent{use: NodeContentUseRefTo, refTo: streamIDs[0]}},
+		{key: nodeKey{use: NodeKeyUseIndex, index: 1}, content: nodeContent{use: NodeContentUseRefTo, refTo: streamIDs[1]}},
+	}
+	pdfdata.setContents(pageID, arrayID)
+
+	stm, err := pdfdata.getStreamOfContentOfPage(pageID)
 	if err != nil {
 		t.Errorf("%+v", err)
 		return
 	}
-	testRead(t, "testing/out/pdf_from_gopdf_out_inserttext.pdf", "")
+	if stm.String() != "0 0 m 10 10 l\nS" {
+		t.Errorf("wrong content %s", stm.String())
+	}
 
-	err = testInsertText("testing/pdf/twopage.pdf", "testing/out/twopage_out_inserttext.pdf")
+	fontRef, err := AddFontFilePath(pdfdata, "testing/ttf/times.ttf")
 	if err != nil {
 		t.Errorf("%+v", err)
 		return
 	}
-	testRead(t, "testing/out/twopage_out_inserttext.pdf", "")
+	err = InsertText(pdfdata, fontRef, "Hello", 0, &Position{X: 10, Y: 10, W: 100, H: 20}, nil)
+	if err != nil {
+		t.Errorf("%+v", err)
+		return
+	}
+	err = pdfdata.build()
+	if err != nil {
+		t.Errorf("%+v", err)
+		return
+	}
+
+	//original streams are not changed, new streams are added before and after them
+	ids, err := pdfdata.contentStreamIDs(pageID)
+	if err != nil {
+		t.Errorf("%+v", err)
+		return
+	}
+	if len(ids) != 4 || ids[1] != streamIDs[0] || ids[2] != streamIDs[1] || !bytes.Equal((*pdfdata.objects[streamIDs[0]])[1].content.stream, zbuff.Bytes()) {
+		t.Errorf("wrong content streams %v", ids)
+		return
+	}
+	stm, err = pdfdata.getStreamOfContentOfPage(pageID)
+	if err != nil {
+		t.Errorf("%+v", err)
+		return
+	}
+	if !strings.HasPrefix(stm.String(), "q\n0 0 m 10 10 l\nS\nQ\nq\nBT\n") {
+		t.Errorf("wrong content %s", stm.String())
+	}
+}
+
+func TestEmptyStream(t *testing.T) {
+	//content stream of page is empty
+	pdfdata := testPdfDataOfPages([][4]float64{{0, 0, 595, 842}})
+	data, err := pdfdata.bytesOfNodesByID(initObjectIDReal(3))
+	if err != nil {
+		t.Errorf("%+v", err)
+		return
+	}
+	if !strings.HasSuffix(string(data), "\nstream\n\nendstream") {
+		t.Errorf("wrong stream %s", data)
+	}
+}
+
+func TestPageTree(t *testing.T) {
+	//root has kids [pages [page 0, page 1], page 2], pages has MediaBox, Resources and Rotate for page 0 and page 1
+	pdfdata := testPdfDataOfPages([][4]float64{{0, 0, 595, 842}, {0, 0, 400, 500}, {0, 0, 612, 792}})
+	nameNode := func(name string, str string) pdfNode {
+		return pdfNode{key: nodeKey{use: NodeKeyUseName, name: name}, content: nodeContent{use: NodeContentUseString, str: str}}
+	}
+	refNode := func(name string, index int, refTo objectID) pdfNode {
+		key := nodeKey{use: NodeKeyUseName, name: name}
+		if name == "" {
+			key = nodeKey{use: NodeKeyUseIndex, index: index}
+		}
+		return pdfNode{key: key, content: nodeContent{use: NodeContentUseRefTo, refTo: refTo}}
+	}
+	rootID, pagesID := initObjectIDReal(1), initObjectIDReal(50)
+	kidsID, mediaBoxID, resourcesID := initObjectIDFake(50, 50), initObjectIDFake(51, 50), initObjectIDFake(52, 50)
+	pdfdata.objects[initObjectIDReal(0)] = &pdfNodes{refNode("Root", 0, initObjectIDReal(60))}
+	pdfdata.objects[initObjectIDReal(60)] = &pdfNodes{nameNode("Type", "/Catalog"), refNode("Pages", 0, rootID)}
+	pdfdata.objects[pagesID] = &pdfNodes{
+		nameNode("Type", "/Pages"),
+		refNode("Parent", 0, rootID),
+		refNode("Kids", 0, kidsID),
+		refNode("MediaBox", 0, mediaBoxID),
+		refNode("Resources", 0, resourcesID),
+		nameNode("Rotate", "90"),
+	}
+	pdfdata.objects[kidsID] = &pdfNodes{refNode("", 0, initObjectIDReal(2)), refNode("", 1, initObjectIDReal(4))}
+	pdfdata.objects[mediaBoxID] = &pdfNodes{}
+	for i, value := range []string{"0", "0", "200", "300"} {
+		pdfdata.objects[mediaBoxID].append(pdfNode{key: nodeKey{use: NodeKeyUseIndex, index: i}, content: nodeContent{use: NodeContentUseString, str: value}})
+	}
+	pdfdata.objects[resourcesID] = &pdfNodes{}
+	rootKidsID := initObjectIDFake(1, 1)
+	pdfdata.objects[rootKidsID] = &pdfNodes{refNode("", 0, pagesID), refNode("", 1, initObjectIDReal(6))}
+	page0 := pdfdata.objects[initObjectIDReal(2)]
+	*page0 = pdfNodes{(*page0)[0], refNode("Parent", 0, pagesID), (*page0)[4]} //Type, Parent and Contents
+	(*pdfdata.objects[initObjectIDReal(4)])[1] = refNode("Parent", 0, pagesID)
+
+	pages, err := pdfdata.pages()
+	if err != nil {
+		t.Errorf("%+v", err)
+		return
+	}
+	var results []string
+	for _, page := range pages {
+		box, err := pdfdata.visibleBox(&page)
+		if err != nil {
+			t.Errorf("%+v", err)
+			return
+		}
+		rotate, err := pdfdata.pageRotate(&page)
+		if err != nil {
+			t.Errorf("%+v", err)
+			return
+		}
+		results = append(results, fmt.Sprintf("%s %v %d %s", page.id, *box, rotate, page.attrs["Resources"].content.refTo))
+	}
+	if strings.Join(results, ",") != "2 {0 0 200 300} 90 52f,4 {0 0 400 500} 90 5f,6 {0 0 612 792} 0 7f" {
+		t.Errorf("wrong pages %v", results)
+	}
+	if len(pdfdata.pageCache) != 3 {
+		t.Errorf("pages must be kept in cache")
+	}
+
+	fontRef, err := AddFontFilePath(pdfdata, "testing/ttf/times.ttf")
+	if err != nil {
+		t.Errorf("%+v", err)
+		return
+	}
+	//page index is checked in every origin (and without rect)
+	err = InsertText(pdfdata, fontRef, "Hello", 3, nil, nil)
+	if errors.Cause(err) != ErrPageNotFound {
+		t.Errorf("page 3 must not be found %+v", err)
+	}
+	for _, pageIndex := range []int{0, 2} {
+		err = InsertText(pdfdata, fontRef, "Hello", pageIndex, &Position{X: 10, Y: 10, W: 100, H: 20}, nil)
+		if err != nil {
+			t.Errorf("%+v", err)
+			return
+		}
+	}
+	err = pdfdata.build()
+	if err != nil {
+		t.Errorf("%+v", err)
+		return
+	}
+	//font is added to inherited resources, page 0 is counter-rotated
+	if _, err = newQuery(pdfdata).findPdfNodeByKeyName(resourcesID, "Font"); err != nil {
+		t.Errorf("font not found in inherited resources %+v", err)
+	}
+	stm, err := pdfdata.getStreamOfContentOfPage(initObjectIDReal(2))
+	if err != nil {
+		t.Errorf("%+v", err)
+		return
+	}
+	if !strings.HasPrefix(stm.String(), "q\nQ\nq\n0.00000 1.00000 -1.00000 0.00000 200.00 0.00 cm\n") {
+		t.Errorf("wrong content of page 0 %s", stm.String())
+	}
+}
+
+func TestMergePageTree(t *testing.T) {
+	nameNode := func(name string, str string) pdfNode {
+		return pdfNode{key: nodeKey{use: NodeKeyUseName, name: name}, content: nodeContent{use: NodeContentUseString, str: str}}
+	}
+	refNode := func(name string, index int, refTo objectID) pdfNode {
+		key := nodeKey{use: NodeKeyUseName, name: name}
+		if name == "" {
+			key = nodeKey{use: NodeKeyUseIndex, index: index}
+		}
+		return pdfNode{key: key, content: nodeContent{use: NodeContentUseRefTo, refTo: refTo}}
+	}
+	arrayObj := func(values ...string) *pdfNodes {
+		nodes := &pdfNodes{}
+		for i, value := range values {
+			nodes.append(pdfNode{key: nodeKey{use: NodeKeyUseIndex, index: i}, content: nodeContent{use: NodeContentUseString, str: value}})
+		}
+		return nodes
+	}
+
+	//root of a has Rotate and CropBox (that has fake id larger than max real id)
+	a := testPdfDataOfPages([][4]float64{{0, 0, 595, 842}})
+	cropBoxID := initObjectIDFake(10, 1)
+	a.objects[initObjectIDReal(1)].append(nameNode("Rotate", "90"))
+	a.objects[initObjectIDReal(1)].append(refNode("CropBox", 0, cropBoxID))
+	a.objects[cropBoxID] = arrayObj("0", "0", "100", "100")
+
+	//root of b has kids [pages [page 0, page 1], page 2], pages has MediaBox for page 0 and Rotate
+	b := testPdfDataOfPages([][4]float64{{0, 0, 595, 842}, {0, 0, 400, 500}, {0, 0, 612, 792}})
+	pagesID, kidsID, mediaBoxID := initObjectIDReal(9), initObjectIDFake(8, 9), initObjectIDFake(9, 9)
+	b.objects[pagesID] = &pdfNodes{
+		nameNode("Type", "/Pages"),
+		refNode("Parent", 0, initObjectIDReal(1)),
+		refNode("Kids", 0, kidsID),
+		nameNode("Count", "2"),
+		refNode("MediaBox", 0, mediaBoxID),
+		nameNode("Rotate", "180"),
+	}
+	b.objects[kidsID] = &pdfNodes{refNode("", 0, initObjectIDReal(2)), refNode("", 1, initObjectIDReal(4))}
+	b.objects[mediaBoxID] = arrayObj("0", "0", "200", "300")
+	b.objects[initObjectIDFake(1, 1)] = &pdfNodes{refNode("", 0, pagesID), refNode("", 1, initObjectIDReal(6))}
+	page0 := b.objects[initObjectIDReal(2)]
+	*page0 = pdfNodes{(*page0)[0], refNode("Parent", 0, pagesID), (*page0)[3], (*page0)[4]} //Type, Parent, Resources and Contents
+	(*b.objects[initObjectIDReal(4)])[1] = refNode("Parent", 0, pagesID)
+
+	err := MergePdf(a, b)
+	if err != nil {
+		t.Errorf("%+v", err)
+		return
+	}
+
+	pages, err := a.pages()
+	if err != nil {
+		t.Errorf("%+v", err)
+		return
+	}
+	var results []string
+	for _, page := range pages {
+		box, err := a.visibleBox(&page)
+		if err != nil {
+			t.Errorf("%+v", err)
+			return
+		}
+		rotate, err := a.pageRotate(&page)
+		if err != nil {
+			t.Errorf("%+v", err)
+			return
+		}
+		results = append(results, fmt.Sprintf("%s %v %d", page.id, *box, rotate))
+	}
+	if strings.Join(results, ",") != "2 {0 0 100 100} 90,7 {0 0 200 300} 180,9 {0 0 400 500} 180,11 {0 0 612 792} 0" {
+		t.Errorf("wrong pages %v", results)
+	}
+	countNode, err := newQuery(a).findPdfNodeByKeyName(initObjectIDReal(1), "Count")
+	if err != nil || countNode.content.str != "4" {
+		t.Errorf("wrong Count of root %+v %+v", countNode, err)
+	}
+
+	//merged pdf can be read back
+	contents, err := testBuildContents(a)
+	if err != nil {
+		t.Errorf("%+v", err)
+		return
+	}
+	if len(contents) != 4 {
+		t.Errorf("wrong number of pages %d", len(contents))
+	}
 }
 
 func exists(path string) (bool, error) {
@@ -165,3 +2026,105 @@ func testRead(t *testing.T, path string, outpath string) {
 		ioutil.WriteFile(outpath, data, 0777)
 	}
 }
+
+//testPdfDataOfPages create PdfData that has catalog, trailer and pages (with empty content) of mediaBoxes
+func testPdfDataOfPages(mediaBoxes [][4]float64) *PdfData {
+	p := newPdfData()
+	refNode := func(name string, index int, refTo objectID) pdfNode {
+		key := nodeKey{use: NodeKeyUseName, name: name}
+		if name == "" {
+			key = nodeKey{use: NodeKeyUseIndex, index: index}
+		}
+		return pdfNode{key: key, content: nodeContent{use: NodeContentUseRefTo, refTo: refTo}}
+	}
+	valNode := func(name string, index int, str string) pdfNode {
+		key := nodeKey{use: NodeKeyUseName, name: name}
+		if name == "" {
+			key = nodeKey{use: NodeKeyUseIndex, index: index}
+		}
+		return pdfNode{key: key, content: nodeContent{use: NodeContentUseString, str: str}}
+	}
+
+	pagesID := initObjectIDReal(1)
+	kidsID := initObjectIDFake(1, 1)
+	p.objects[pagesID] = &pdfNodes{valNode("Type", 0, "/Pages"), refNode("Kids", 0, kidsID), valNode("Count", 0, fmt.Sprintf("%d", len(mediaBoxes)))}
+	p.objects[kidsID] = &pdfNodes{}
+	for i, mediaBox := range mediaBoxes {
+		pageID := initObjectIDReal(uint32(2 + i*2))
+		contentsID := initObjectIDReal(uint32(3 + i*2))
+		mediaBoxID := initObjectIDFake(uint32(2+i*2), pageID.id)
+		resourcesID := initObjectIDFake(uint32(3+i*2), pageID.id)
+		p.objects[kidsID].append(refNode("", i, pageID))
+		p.objects[pageID] = &pdfNodes{
+			valNode("Type", 0, "/Page"),
+			refNode("Parent", 0, pagesID),
+			refNode("MediaBox", 0, mediaBoxID),
+			refNode("Resources", 0, resourcesID),
+			refNode("Contents", 0, contentsID),
+		}
+		p.objects[mediaBoxID] = &pdfNodes{}
+		for j, value := range mediaBox {
+			p.objects[mediaBoxID].append(valNode("", j, fmt.Sprintf("%g", value)))
+		}
+		p.objects[resourcesID] = &pdfNodes{}
+		p.objects[contentsID] = &pdfNodes{
+			valNode("Length", 0, "0"),
+			{key: nodeKey{use: NodeKeyUseStream}, content: nodeContent{use: NodeContentUseStream}},
+		}
+	}
+	catalogID := initObjectIDReal(uint32(2 + len(mediaBoxes)*2))
+	p.objects[catalogID] = &pdfNodes{valNode("Type", 0, "/Catalog"), refNode("Pages", 0, pagesID)}
+	p.objects[initObjectIDReal(0)] = &pdfNodes{refNode("Root", 0, catalogID), valNode("Size", 0, "0")}
+	return p
+}
+
+//testPdfDataWithFont create PdfData that has A4 pages of pageCount (see testPdfDataOfPages) and add times.ttf to it
+func testPdfDataWithFont(pageCount int) (*PdfData, FontRef, error) {
+	mediaBoxes := make([][4]float64, pageCount)
+	for i := range mediaBoxes {
+		mediaBoxes[i] = [4]float64{0, 0, 595, 842}
+	}
+	pdfdata := testPdfDataOfPages(mediaBoxes)
+	fontRef, err := AddFontFilePath(pdfdata, "testing/ttf/times.ttf")
+	if err != nil {
+		return nil, "", err
+	}
+	return pdfdata, fontRef, nil
+}
+
+//testBuildContents build pdf by BuildPdf, read it back and return content of each page
+func testBuildContents(pdfdata *PdfData) ([]string, error) {
+	data, err := BuildPdf(pdfdata)
+	if err != nil {
+		return nil, err
+	}
+	result, err := ReadPdf(data)
+	if err != nil {
+		return nil, err
+	}
+	pages, err := result.pages()
+	if err != nil {
+		return nil, err
+	}
+	var contents []string
+	for _, page := range pages {
+		stm, err := result.getStreamOfContentOfPage(page.id)
+		if err != nil {
+			return nil, err
+		}
+		contents = append(contents, stm.String())
+	}
+	return contents, nil
+}
+
+//testFontTableOffset offset of table of tag in font file (-1 if not found)
+func testFontTableOffset(fontfile []byte, tag string) int {
+	numTables := int(binary.BigEndian.Uint16(fontfile[4:]))
+	for i := 0; i < numTables; i++ {
+		entry := fontfile[12+i*16:]
+		if string(entry[:4]) == tag {
+			return int(binary.BigEndian.Uint32(entry[8:]))
+		}
+	}
+	return -1
+}
@@ -0,0 +1,319 @@
+package nxpdf
+
+import (
+	"strconv"
+
+	"github.com/pkg/errors"
+)
+
+//pageBox rect of page in pdf user space
+type pageBox struct {
+	llx, lly float64 //lower-left corner
+	urx, ury float64 //upper-right corner
+}
+
+//inheritableKeys attributes of page that may be in its parents in page tree
+var inheritableKeys = []string{"Resources", "MediaBox", "CropBox", "Rotate"}
+
+//pdfPage leaf of page tree
+type pdfPage struct {
+	id    objectID
+	attrs map[string]pdfNode //inheritable attributes (from page or its nearest parent that has it)
+}
+
+//page find page at pageIndex (in document order)
+func (p *PdfData) page(pageIndex int) (*pdfPage, error) {
+	pages, err := p.pages()
+	if err != nil {
+		return nil, errors.Wrap(err, "")
+	}
+	if pageIndex < 0 || pageIndex >= len(pages) {
+		return nil, ErrPageNotFound
+	}
+	return &pages[pageIndex], nil
+}
+
+//pages find all pages in document order by walking page tree from its root,
+//result is kept in p.pageCache until page tree is changed (see merge)
+func (p *PdfData) pages() ([]pdfPage, error) {
+
+	if p.pageCache != nil {
+		return p.pageCache, nil
+	}
+
+	rootID, err := p.pageTreeRootID()
+	if err != nil {
+		return nil, errors.Wrap(err, "")
+	}
+
+	pages := []pdfPage{}
+	err = p.walkPageTree(rootID, nil, make(map[objectID]bool), &pages)
+	if err != nil {
+		return nil, errors.Wrap(err, "")
+	}
+	p.pageCache = pages
+	return pages, nil
+}
+
+//pageTreeRootID find /Pages of catalog, or /Pages that has no parent if pdf has no trailer
+func (p *PdfData) pageTreeRootID() (objectID, error) {
+
+	rootNode, err := newQuery(p).findPdfNodeByKeyName(initObjectIDReal(0), "Root")
+	if err == nil {
+		pagesNode, err := newQuery(p).findPdfNodeByKeyName(rootNode.content.refTo, "Pages")
+		if err == nil {
+			return pagesNode.content.refTo, nil
+		}
+	}
+
+	pagesResults, err := newQuery(p).findDict("Type", "/Pages")
+	if err != nil {
+		return objectIDEmpty, errors.Wrap(err, "")
+	}
+	for _, result := range pagesResults {
+		_, err := newQuery(p).findPdfNodeByKeyName(result.objID, "Parent")
+		if err == ErrKeyNameNotFound {
+			return result.objID, nil
+		}
+	}
+	return objectIDEmpty, ErrDictNotFound
+}
+
+//walkPageTree append pages under node of id (that is /Pages or /Page) to pages,
+//inherited is inheritable attributes of parents of node
+func (p *PdfData) walkPageTree(id objectID, inherited map[string]pdfNode, visited map[objectID]bool, pages *[]pdfPage) error {
+
+	if visited[id] { //broken page tree that has cycle
+		return nil
+	}
+	visited[id] = true
+
+	if _, ok := p.objects[id]; !ok {
+		return ErrObjectIDNotFound
+	}
+
+	attrs := make(map[string]pdfNode)
+	for key, node := range inherited {
+		attrs[key] = node
+	}
+	for _, key := range inheritableKeys {
+		node, err := newQuery(p).findPdfNodeByKeyName(id, key)
+		if err == nil {
+			attrs[key] = *node
+		}
+	}
+
+	kidsNode, err := newQuery(p).findPdfNodeByKeyName(id, "Kids")
+	if err == ErrKeyNameNotFound { //leaf
+		*pages = append(*pages, pdfPage{id: id, attrs: attrs})
+		return nil
+	} else if err != nil {
+		return errors.Wrap(err, "")
+	}
+
+	kidsNodes, ok := p.objects[kidsNode.content.refTo]
+	if !ok {
+		return ErrObjectIDNotFound
+	}
+	for _, kid := range *kidsNodes {
+		if kid.key.use != NodeKeyUseIndex || kid.content.use != NodeContentUseRefTo {
+			continue
+		}
+		err := p.walkPageTree(kid.content.refTo, attrs, visited, pages)
+		if err != nil {
+			return errors.Wrap(err, "")
+		}
+	}
+	return nil
+}
+
+//visibleBox CropBox (or MediaBox if page has no CropBox) of page
+func (p *PdfData) visibleBox(page *pdfPage) (*pageBox, error) {
+
+	node, ok := page.attrs["CropBox"]
+	if !ok {
+		node, ok = page.attrs["MediaBox"]
+	}
+	if !ok {
+		return nil, errors.Wrapf(ErrKeyNameNotFound, "MediaBox of page %s not found", page.id)
+	}
+
+	values, err := p.numbersOfArray(node.content.refTo)
+	if err != nil {
+		return nil, errors.Wrap(err, "")
+	}
+	if len(values) != 4 {
+		return nil, ErrInvalidPageBox
+	}
+
+	//corners of box may be in any order
+	box := pageBox{llx: values[0], lly: values[1], urx: values[2], ury: values[3]}
+	if box.llx > box.urx {
+		box.llx, box.urx = box.urx, box.llx
+	}
+	if box.lly > box.ury {
+		box.lly, box.ury = box.ury, box.lly
+	}
+	return &box, nil
+}
+
+//numbersOfArray values of array object that items are numbers
+func (p *PdfData) numbersOfArray(id objectID) ([]float64, error) {
+
+	nodes, ok := p.objects[id]
+	if !ok {
+		return nil, ErrObjectIDNotFound
+	}
+
+	var values []float64
+	for _, node := range *nodes {
+		if node.key.use != NodeKeyUseIndex {
+			continue
+		}
+		value, err := p.numberOfNode(node)
+		if err != nil {
+			return nil, errors.Wrap(ErrInvalidPageBox, err.Error())
+		}
+		values = append(values, value)
+	}
+	return values, nil
+}
+
+//numberOfNode value of node that is number or reference to number
+func (p *PdfData) numberOfNode(node pdfNode) (float64, error) {
+	str := node.content.str
+	if node.content.use == NodeContentUseRefTo { //indirect number
+		refNodes, ok := p.objects[node.content.refTo]
+		if !ok || refNodes.len() != 1 {
+			return 0, ErrObjectIDNotFound
+		}
+		str = (*refNodes)[0].content.str
+	}
+	value, err := strconv.ParseFloat(str, 64)
+	if err != nil {
+		return 0, errors.Wrapf(err, "strconv.ParseFloat(%s) fail", str)
+	}
+	return value, nil
+}
+
+//pageRotate /Rotate of page (0, 90, 180 or 270), page is turned clockwise by this angle when displayed
+func (p *PdfData) pageRotate(page *pdfPage) (int, error) {
+	node, ok := page.attrs["Rotate"]
+	if !ok {
+		return 0, nil
+	}
+	value, err := p.numberOfNode(node)
+	if err != nil {
+		return 0, errors.Wrapf(err, "/Rotate of page %s is not number", page.id)
+	}
+	rotate := int(value) % 360
+	if rotate < 0 {
+		rotate += 360
+	}
+	return rotate / 90 * 90, nil
+}
+
+//displayedBox visible box of page as displayed (width and height are swapped if page is turned 90 or 270 degrees),
+//lower-left corner is same as visible box
+func (p *PdfData) displayedBox(page *pdfPage) (*pageBox, error) {
+	box, err := p.visibleBox(page)
+	if err != nil {
+		return nil, errors.Wrap(err, "")
+	}
+	rotate, err := p.pageRotate(page)
+	if err != nil {
+		return nil, errors.Wrap(err, "")
+	}
+	if rotate == 90 || rotate == 270 {
+		return &pageBox{
+			llx: box.llx,
+			lly: box.lly,
+			urx: box.llx + (box.ury - box.lly),
+			ury: box.lly + (box.urx - box.llx),
+		}, nil
+	}
+	return box, nil
+}
+
+//displayMatrix matrix that map coordinates of page as displayed (see displayedBox) to pdf user space,
+//nil if page is not rotated
+func (p *PdfData) displayMatrix(page *pdfPage) (*Matrix, error) {
+
+	rotate, err := p.pageRotate(page)
+	if err != nil {
+		return nil, errors.Wrap(err, "")
+	}
+	if rotate == 0 {
+		return nil, nil
+	}
+
+	box, err := p.visibleBox(page)
+	if err != nil {
+		return nil, errors.Wrap(err, "")
+	}
+	switch rotate {
+	case 90: //right of displayed page is top of box
+		return &Matrix{A: 0, B: 1, C: -1, D: 0, E: box.urx + box.lly, F: box.lly - box.llx}, nil
+	case 180:
+		return &Matrix{A: -1, B: 0, C: 0, D: -1, E: box.urx + box.llx, F: box.ury + box.lly}, nil
+	default: //270, left of displayed page is top of box
+		return &Matrix{A: 0, B: -1, C: 1, D: 0, E: box.llx - box.lly, F: box.ury + box.llx}, nil
+	}
+}
+
+//unitScale number of points in 1 unit
+func unitScale(unit int) float64 {
+	switch unit {
+	case UnitMM:
+		return 72.0 / 25.4
+	case UnitCM:
+		return 72.0 / 2.54
+	case UnitInch:
+		return 72.0
+	}
+	return 1
+}
+
+//toUserSpace convert rect (in unit and origin of p) to pdf user space of page at pageIndex
+//(space of page as displayed if page is rotated, see displayMatrix),
+//origin is corner of visible box of page, so it is not (0, 0) of user space if box does not start at (0, 0)
+func (p *PdfData) toUserSpace(pageIndex int, rect Position) (Position, error) {
+
+	page, err := p.page(pageIndex)
+	if err != nil {
+		return Position{}, errors.Wrapf(err, "p.page(%d) fail", pageIndex)
+	}
+	box, err := p.displayedBox(page)
+	if err != nil {
+		return Position{}, errors.Wrap(err, "")
+	}
+
+	scale := unitScale(p.unit)
+	result := Position{
+		X: box.llx + rect.X*scale,
+		Y: box.lly + rect.Y*scale,
+		W: rect.W * scale,
+		H: rect.H * scale,
+	}
+	if p.origin == OriginTopLeft {
+		//y is flipped by height of each page
+		result.Y = box.ury - rect.Y*scale - result.H
+	}
+	return result, nil
+}
+
+func setUnit(p *PdfData, unit int) error {
+	if unit < UnitPT || unit > UnitInch {
+		return ErrInvalidUnit
+	}
+	p.unit = unit
+	return nil
+}
+
+func setOrigin(p *PdfData, origin int) error {
+	if origin != OriginBottomLeft && origin != OriginTopLeft {
+		return ErrInvalidOrigin
+	}
+	p.origin = origin
+	return nil
+}
@@ -5,10 +5,8 @@ import (
 	"compress/zlib"
 	"fmt"
 	"io"
-	"regexp"
 	"sort"
 	"strconv"
-	"strings"
 
 	"github.com/pkg/errors"
 )
@@ -18,6 +16,11 @@ type PdfData struct {
 	subsetFonts              map[FontRef](*subsetFont)
 	mapPageAndContentCachers map[int](*[]contentCacher)
 	objects                  map[objectID]*pdfNodes
+	thaiDict                 *thaiDict //nil mean use default word list
+	fontFallbacks            map[FontRef][]FontRef
+	unit                     int       //unit of Position (UnitPT, UnitMM, UnitCM, UnitInch)
+	origin                   int       //origin of Position (OriginBottomLeft, OriginTopLeft)
+	pageCache                []pdfPage //result of pages(), nil if page tree is not walked (or it is changed)
 }
 
 func newPdfData() *PdfData {
@@ -40,50 +43,40 @@ func (p *PdfData) push(myID objectID, node pdfNode) {
 func (p *PdfData) build() error {
 
 	//find all ref
-	pagesResults, err := newQuery(p).findDict("Type", "/Pages")
+	pages, err := p.pages()
 	if err != nil {
 		return errors.Wrap(err, "")
 	}
 
-	if len(pagesResults) <= 0 {
-		return ErrDictNotFound
-	}
-
-	kidsNode, err := newQuery(p).findPdfNodeByKeyName(pagesResults[0].objID, "Kids")
-	if err != nil {
-		return errors.Wrap(err, "")
-	}
-
-	kidObjectIDs := make(map[int]objectID)
-	kidsNodes := p.objects[kidsNode.content.refTo]
-	for i, kid := range *kidsNodes {
-		kidObjectIDs[i] = kid.content.refTo
-	}
-
 	resObjectIDs := make(map[int]objectID)
-	contentObjectIDs := make(map[int]objectID)
-	for i, kidObjectID := range kidObjectIDs {
-
-		resNode, err := newQuery(p).findPdfNodeByKeyName(kidObjectID, "Resources")
-		if err != nil {
-			return errors.Wrap(err, "")
+	for i, page := range pages {
+		resNode, ok := page.attrs["Resources"]
+		if !ok {
+			return errors.Wrapf(ErrKeyNameNotFound, "Resources of page %d not found", i)
 		}
 		resObjectIDs[i] = resNode.content.refTo
-
-		contentNode, err := newQuery(p).findPdfNodeByKeyName(kidObjectID, "Contents")
-		if err != nil {
-			return errors.Wrap(err, "")
-		}
-		contentObjectIDs[i] = contentNode.content.refTo
 	}
 	//end find all ref
 
-	err = p.buildSubsetFont(resObjectIDs)
+	fontResNamesOfRes, err := p.buildSubsetFont(resObjectIDs)
 	if err != nil {
 		return errors.Wrap(err, "")
 	}
 
-	err = p.buildContent(contentObjectIDs)
+	pageInfos := make(map[int]*pageInfo)
+	for i, resObjectID := range resObjectIDs {
+		pageInfos[i] = &pageInfo{
+			fontResNames: fontResNamesOfRes[resObjectID],
+		}
+		if _, ok := p.mapPageAndContentCachers[i]; ok {
+			pageInfos[i].matrix, err = p.displayMatrix(&pages[i])
+			if err != nil {
+				return errors.Wrap(err, "")
+			}
+		}
+	}
+
+	err = p.buildContent(pages, pageInfos)
 	if err != nil {
 		return errors.Wrap(err, "")
 	}
@@ -91,20 +84,28 @@ func (p *PdfData) build() error {
 	return nil
 }
 
-func (p *PdfData) buildSubsetFont(resObjectIDs map[int]objectID) error {
+//buildSubsetFont append subset fonts to pdf and add them to all resources,
+//return font resource names of each resources (map[resources id]map[FontRef]font resource name)
+func (p *PdfData) buildSubsetFont(resObjectIDs map[int]objectID) (map[objectID](map[FontRef]string), error) {
 
 	var err error
 	maxFakeID, _ := p.findMaxFakeID()
 	maxRealID, _ := p.findMaxRealID()
 
-	var newFontObjectIDs []objectID
-	for fontRef, ss := range p.subsetFonts {
+	var fontRefs []FontRef
+	for fontRef := range p.subsetFonts {
+		fontRefs = append(fontRefs, fontRef)
+	}
+	sort.Slice(fontRefs, func(i, j int) bool { return fontRefs[i] < fontRefs[j] })
+
+	newFontObjectIDs := make(map[FontRef]objectID)
+	for _, fontRef := range fontRefs {
 		var newFontObjectID objectID
-		newFontObjectID, maxRealID, maxFakeID, err = p.appendSubsetFont(ss, fontRef, maxRealID, maxFakeID)
+		newFontObjectID, maxRealID, maxFakeID, err = p.appendSubsetFont(p.subsetFonts[fontRef], fontRef, maxRealID, maxFakeID)
 		if err != nil {
-			return errors.Wrap(err, "")
+			return nil, errors.Wrap(err, "")
 		}
-		newFontObjectIDs = append(newFontObjectIDs, newFontObjectID)
+		newFontObjectIDs[fontRef] = newFontObjectID
 	}
 
 	//append subset font to all res
@@ -115,106 +116,170 @@ func (p *PdfData) buildSubsetFont(resObjectIDs map[int]objectID) error {
 		}
 	}
 
+	fontResNamesOfRes := make(map[objectID](map[FontRef]string))
 	for resID := range resIDs {
 		fontNode, err := newQuery(p).findPdfNodeByKeyName(resID, "Font")
-		if err != nil {
-			return errors.Wrap(err, "")
+		if err == ErrKeyNameNotFound { //resources without font, create new one
+			maxFakeID++
+			fontNode = &pdfNode{
+				key: nodeKey{
+					name: "Font",
+					use:  NodeKeyUseName,
+				},
+				content: nodeContent{
+					use:   NodeContentUseRefTo,
+					refTo: initObjectIDFake(maxFakeID, 0),
+				},
+			}
+			p.objects[resID].append(*fontNode)
+			p.objects[fontNode.content.refTo] = &pdfNodes{}
+		} else if err != nil {
+			return nil, errors.Wrap(err, "")
 		}
+
 		fontNodes := p.objects[fontNode.content.refTo]
-		fName := "F"
-		fIndexMax := 0
+		usedNames := make(map[string]bool)
 		for _, node := range *fontNodes {
-			fIndex := 0
-			fName, fIndex, err = p.fontnameExtract(node.key.name)
-			if err != nil {
-				return errors.Wrap(err, "")
-			}
-			if fIndex > fIndexMax {
-				fIndexMax = fIndex
-			}
+			usedNames[node.key.name] = true
 		}
 
-		for i, newFontObjectID := range newFontObjectIDs {
+		fontResNames := make(map[FontRef]string)
+		for _, fontRef := range fontRefs {
+			fontResNames[fontRef] = p.newFontName(usedNames)
 			fontNode := pdfNode{
 				key: nodeKey{
-					name: fmt.Sprintf("%s%d", fName, fIndexMax+1+i),
+					name: fontResNames[fontRef],
 					use:  NodeKeyUseName,
 				},
 				content: nodeContent{
 					use:   NodeContentUseRefTo,
-					refTo: newFontObjectID,
+					refTo: newFontObjectIDs[fontRef],
 				},
 			}
 			fontNodes.append(fontNode)
 		}
-
+		fontResNamesOfRes[resID] = fontResNames
 	}
 
-	return nil
+	return fontResNamesOfRes, nil
 }
 
-func (p *PdfData) fontnameExtract(fontname string) (string, int, error) {
-
-	rex := regexp.MustCompile("[0-9]+")
-	if !rex.MatchString(fontname) {
-		return "", 0, fmt.Errorf("can not parse %s", fontname)
-	}
-
-	fname := rex.ReplaceAllString(fontname, "")
-
-	findex, err := strconv.Atoi(strings.Replace(fontname, fname, "", -1))
-	if err != nil {
-		return "", 0, errors.Wrap(err, "")
+//newFontName find font resource name (F1, F2, ...) that not in usedNames
+func (p *PdfData) newFontName(usedNames map[string]bool) string {
+	i := 1
+	for {
+		fontname := fmt.Sprintf("F%d", i)
+		if !usedNames[fontname] {
+			usedNames[fontname] = true
+			return fontname
+		}
+		i++
 	}
-
-	return fname, findex, nil
 }
 
-func (p *PdfData) buildContent(contentObjectIDs map[int]objectID) error {
+//buildContent add content of page to /Contents of page (original content streams are not changed),
+//content of LayerUnderlay is before original content and content of LayerOverlay is after original content
+func (p *PdfData) buildContent(pages []pdfPage, pageInfos map[int]*pageInfo) error {
 
-	mapPageAndBuff := make(map[int]*bytes.Buffer) //map ระหว่าง pageindex กับ buffer( ของ contnent)
+	mapPageAndBuff := make(map[int]*[2]bytes.Buffer) //map ระหว่าง pageindex กับ buffer( ของ contnent) of LayerOverlay and LayerUnderlay
 	for pageIndex, caches := range p.mapPageAndContentCachers {
 		if _, ok := mapPageAndBuff[pageIndex]; !ok {
-			mapPageAndBuff[pageIndex] = &bytes.Buffer{}
+			mapPageAndBuff[pageIndex] = &[2]bytes.Buffer{}
 		}
-		for _, cache := range *caches {
-			_, err := cache.build(mapPageAndBuff[pageIndex])
+		for layer := range mapPageAndBuff[pageIndex] {
+			err := buildLayer(&mapPageAndBuff[pageIndex][layer], *caches, layer, pageInfos[pageIndex])
 			if err != nil {
 				return errors.Wrap(err, "")
 			}
 		}
 	}
 
-	for pageIndex, buff := range mapPageAndBuff {
+	var pageIndexes []int
+	for pageIndex := range mapPageAndBuff {
+		pageIndexes = append(pageIndexes, pageIndex)
+	}
+	sort.Ints(pageIndexes)
 
-		stm, err := p.getStreamOfContentOfPage(contentObjectIDs, pageIndex)
-		if err != nil {
-			return errors.Wrapf(err, "p.getStreamOfContentOfPage(contentObjectIDs, %d) fail", pageIndex)
+	maxFakeID, _ := p.findMaxFakeID()
+	maxRealID, _ := p.findMaxRealID()
+	for _, pageIndex := range pageIndexes {
+
+		buffs := mapPageAndBuff[pageIndex]
+		if pageIndex < 0 || pageIndex >= len(pages) {
+			return errors.Wrapf(ErrPageNotFound, "page %d", pageIndex)
 		}
-		stm.Write(buff.Bytes())
-		err = p.replaceStramObj(contentObjectIDs[pageIndex], stm)
+		pageID := pages[pageIndex].id
+		streamIDs, err := p.contentStreamIDs(pageID)
 		if err != nil {
-			return errors.Wrap(err, "p.reWriteStramObj(contentObjectIDs[pageIndex], stm) fail")
+			return errors.Wrapf(err, "p.contentStreamIDs(%s) fail", pageID)
 		}
+
+		//original content is isolated, so its CTM, clipping path and colors are not used by added content
+		var before, after bytes.Buffer
+		buffs[LayerUnderlay].WriteTo(&before)
+		before.WriteString("q\n")
+		after.WriteString("Q\n")
+		buffs[LayerOverlay].WriteTo(&after)
+
+		maxRealID++
+		beforeID := initObjectIDReal(maxRealID)
+		p.setStreamObj(beforeID, &before)
+		maxRealID++
+		afterID := initObjectIDReal(maxRealID)
+		p.setStreamObj(afterID, &after)
+
+		maxFakeID++
+		arrayID := initObjectIDFake(maxFakeID, pageID.id)
+		p.objects[arrayID] = &pdfNodes{}
+		for i, streamID := range append(append([]objectID{beforeID}, streamIDs...), afterID) {
+			p.objects[arrayID].append(pdfNode{
+				key: nodeKey{
+					use:   NodeKeyUseIndex,
+					index: i,
+				},
+				content: nodeContent{
+					use:   NodeContentUseRefTo,
+					refTo: streamID,
+				},
+			})
+		}
+		p.setContents(pageID, arrayID)
 	}
 
 	return nil
 }
 
-func (p *PdfData) replaceStramObj(id objectID, data *bytes.Buffer) error {
+//buildLayer write content of caches that are in layer (nothing if no cache is in layer)
+func buildLayer(buff *bytes.Buffer, caches []contentCacher, layer int, info *pageInfo) error {
 
-	nodes := p.objects[id]
-	isStream := false
-	for _, node := range *nodes {
-		if node.content.use == NodeContentUseStream {
-			isStream = true
-			break
+	var layerCaches []contentCacher
+	for _, cache := range caches {
+		if cache.layer() == layer {
+			layerCaches = append(layerCaches, cache)
 		}
 	}
+	if len(layerCaches) == 0 {
+		return nil
+	}
 
-	if !isStream {
-		return ErrStreamNotFound
+	//added content start from default graphics state
+	buff.WriteString("q\n")
+	//counter-rotate rotated page, so content is upright when page is displayed
+	if info != nil && info.matrix != nil {
+		writeMatrix(buff, *info.matrix)
+	}
+	for _, cache := range layerCaches {
+		_, err := cache.build(buff, info)
+		if err != nil {
+			return errors.Wrap(err, "")
+		}
 	}
+	buff.WriteString("Q\n")
+	return nil
+}
+
+//setStreamObj set object of id to stream of data (without filter)
+func (p *PdfData) setStreamObj(id objectID, data *bytes.Buffer) {
 
 	newNodes := pdfNodes{}
 	newNodeLen := pdfNode{
@@ -241,16 +306,93 @@ func (p *PdfData) replaceStramObj(id objectID, data *bytes.Buffer) error {
 	newNodes.append(newNodeStm)
 
 	p.objects[id] = &newNodes
+}
 
-	return nil
+//setContents set /Contents of page to refer to contentsID
+func (p *PdfData) setContents(pageID objectID, contentsID objectID) {
+	contentsNode := pdfNode{
+		key: nodeKey{
+			use:  NodeKeyUseName,
+			name: "Contents",
+		},
+		content: nodeContent{
+			use:   NodeContentUseRefTo,
+			refTo: contentsID,
+		},
+	}
+	p.setNode(pageID, contentsNode)
 }
 
-func (p *PdfData) getStreamOfContentOfPage(contentObjectIDs map[int]objectID, pageIndex int) (*bytes.Buffer, error) {
-	var nodes *pdfNodes
+//setNode replace node that has same key name in object of id, or append node if object has no such key
+func (p *PdfData) setNode(id objectID, node pdfNode) {
+	index, err := newQuery(p).findIndexByKeyName(id, node.key.name)
+	if err != nil { //not found
+		p.objects[id].append(node)
+		return
+	}
+	(*p.objects[id])[index] = node
+}
+
+//contentStreamIDs object ids of content streams of page, /Contents of page is a stream or an array of streams
+//(nil if page has no /Contents)
+func (p *PdfData) contentStreamIDs(pageID objectID) ([]objectID, error) {
+
+	contentsNode, err := newQuery(p).findPdfNodeByKeyName(pageID, "Contents")
+	if err == ErrKeyNameNotFound {
+		return nil, nil
+	} else if err != nil {
+		return nil, errors.Wrap(err, "")
+	}
+
+	nodes, ok := p.objects[contentsNode.content.refTo]
+	if !ok {
+		return nil, ErrObjectIDNotFound
+	}
+	if _, isStream := p.isStream(nodes); isStream {
+		return []objectID{contentsNode.content.refTo}, nil
+	}
+
+	var streamIDs []objectID
+	for _, node := range *nodes {
+		if node.key.use != NodeKeyUseIndex || node.content.use != NodeContentUseRefTo {
+			continue
+		}
+		if _, isStream := p.isStream(p.objects[node.content.refTo]); !isStream {
+			return nil, ErrStreamNotFound
+		}
+		streamIDs = append(streamIDs, node.content.refTo)
+	}
+	return streamIDs, nil
+}
+
+//getStreamOfContentOfPage decoded content of page (content streams are concatenated)
+func (p *PdfData) getStreamOfContentOfPage(pageID objectID) (*bytes.Buffer, error) {
+
+	streamIDs, err := p.contentStreamIDs(pageID)
+	if err != nil {
+		return nil, errors.Wrap(err, "")
+	}
+
+	buff := bytes.NewBuffer(nil)
+	for _, streamID := range streamIDs {
+		stm, err := p.decodeStream(streamID)
+		if err != nil {
+			return nil, errors.Wrapf(err, "p.decodeStream(%s) fail", streamID)
+		}
+		//streams are separated by white space
+		if buff.Len() > 0 && !bytes.ContainsAny(buff.Bytes()[buff.Len()-1:], " \t\r\n") {
+			buff.WriteString("\n")
+		}
+		buff.Write(stm)
+	}
+	return buff, nil
+}
+
+//decodeStream data of stream object (flate stream is decompressed)
+func (p *PdfData) decodeStream(id objectID) ([]byte, error) {
 	filter := ""
 	var stm []byte
-	if id, ok := contentObjectIDs[pageIndex]; ok {
-		nodes = p.objects[id]
+	if nodes, ok := p.objects[id]; ok {
 		for _, node := range *nodes {
 			if node.key.name == "Filter" {
 				filter = node.content.str
@@ -260,7 +402,6 @@ func (p *PdfData) getStreamOfContentOfPage(contentObjectIDs map[int]objectID, pa
 		}
 	}
 
-	var buff *bytes.Buffer
 	if filter == "/FlateDecode" { //zip
 		buffZip := bytes.NewBuffer(stm)
 		r, err := zlib.NewReader(buffZip)
@@ -268,15 +409,14 @@ func (p *PdfData) getStreamOfContentOfPage(contentObjectIDs map[int]objectID, pa
 			return nil, errors.Wrap(err, "")
 		}
 		defer r.Close()
-		buff = bytes.NewBuffer(nil)
+		buff := bytes.NewBuffer(nil)
 		_, err = io.Copy(buff, r)
 		if err != nil {
 			return nil, errors.Wrap(err, "")
 		}
-	} else {
-		buff = bytes.NewBuffer(stm)
+		return buff.Bytes(), nil
 	}
-	return buff, nil
+	return stm, nil
 }
 
 //bytes return []byte of pdf file
@@ -455,7 +595,7 @@ func (p PdfData) writeStream(nodes *pdfNodes, indexOfStream int, buff *bytes.Buf
 	stream := (*nodes)[indexOfStream].content.stream
 	buff.WriteString("\nstream\n")
 	buff.Write(stream)
-	if stream[len(stream)-1] != 0xA {
+	if len(stream) == 0 || stream[len(stream)-1] != 0xA {
 		buff.WriteString("\n")
 	}
 	buff.WriteString("endstream")
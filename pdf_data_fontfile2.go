@@ -200,7 +200,7 @@ func (p *PdfData) makeGlyfAndLocaTable(ssf *subsetFont) ([]byte, []int, error) {
 
 	numGlyphs := int(ttfp.NumGlyphs())
 
-	_, glyphArray := p.completeGlyphClosure(ssf, ssf.glyphIndexs)
+	glyphArray := p.completeGlyphClosure(ssf, ssf.glyphs())
 	glyphCount := len(glyphArray)
 	sort.Ints(glyphArray)
 
@@ -256,7 +256,7 @@ func (p *PdfData) getGlyphData(ssf *subsetFont, glyph int) []byte {
 	return data
 }
 
-func (p *PdfData) completeGlyphClosure(ssf *subsetFont, glyphs map[rune]uint) (map[rune]uint, []int) {
+func (p *PdfData) completeGlyphClosure(ssf *subsetFont, glyphs []uint) []int {
 	var glyphArray []int
 	//copy
 	isContainZero := false
@@ -276,7 +276,7 @@ func (p *PdfData) completeGlyphClosure(ssf *subsetFont, glyphs map[rune]uint) (m
 		p.AddCompositeGlyphs(ssf, &glyphArray, glyphArray[i])
 		i++
 	}
-	return glyphs, glyphArray
+	return glyphArray
 }
 
 const weHaveAScale = 8
@@ -51,6 +51,10 @@ func (p *PdfData) appendSubsetFont(ssf *subsetFont, fontRef FontRef, maxRealID u
 		},
 	}
 
+	encoding := "/Identity-H"
+	if ssf.vertical {
+		encoding = "/Identity-V"
+	}
 	encodingNode := pdfNode{
 		key: nodeKey{
 			name: "Encoding",
@@ -58,7 +62,7 @@ func (p *PdfData) appendSubsetFont(ssf *subsetFont, fontRef FontRef, maxRealID u
 		},
 		content: nodeContent{
 			use: NodeContentUseString,
-			str: "/Identity-H",
+			str: encoding,
 		},
 	}
 
@@ -240,6 +244,26 @@ func (p *PdfData) appendCidFont(
 	cidFontNodes.append(fontDescriptorNode)
 	cidFontNodes.append(baseFontNode)
 
+	if ssf.vertical {
+		maxFakeID++
+		w2RefID := objectID{
+			id:     maxFakeID,
+			isReal: false,
+		}
+		w2Node := pdfNode{
+			key: nodeKey{
+				name: "W2",
+				use:  NodeKeyUseName,
+			},
+			content: nodeContent{
+				use:   NodeContentUseRefTo,
+				refTo: w2RefID,
+			},
+		}
+		cidFontNodes.append(w2Node)
+		p.appendW2(ssf, w2RefID)
+	}
+
 	//fontDescriptor
 	maxRealID, maxFakeID, err := p.appendFontDescriptor(ssf, fontRef, fontDescriptorRefID, maxRealID, maxFakeID)
 	if err != nil {
@@ -250,7 +274,7 @@ func (p *PdfData) appendCidFont(
 	wNodes := pdfNodes{}
 	p.objects[wRefID] = &wNodes
 
-	for _, glyphIndex := range ssf.glyphIndexs {
+	for _, glyphIndex := range ssf.glyphs() {
 
 		width := ssf.glyphIndexToPdfWidth(glyphIndex)
 
@@ -308,6 +332,32 @@ func (p *PdfData) appendCidFont(
 	return maxRealID, maxFakeID, nil
 }
 
+//appendW2 vertical metrics of glyphs, each item is "cid [w1y vx vy]"
+func (p *PdfData) appendW2(ssf *subsetFont, w2RefID objectID) {
+
+	w2Nodes := pdfNodes{}
+	p.objects[w2RefID] = &w2Nodes
+
+	unitsPerEm := ssf.ttfp.UnitsPerEm()
+	for _, glyphIndex := range ssf.glyphs() {
+
+		height := ssf.glyphIndexToPdfHeight(glyphIndex)
+		width := ssf.glyphIndexToPdfWidth(glyphIndex)
+		originY := toPdfUnit(ssf.ttfp.VerticalOriginY(glyphIndex), unitsPerEm)
+
+		w2ItemNode := pdfNode{
+			key: nodeKey{
+				use: NodeKeyUseIndex,
+			},
+			content: nodeContent{
+				use: NodeContentUseString,
+				str: fmt.Sprintf("%d[%d %d %d]", glyphIndex, -int(height), width/2, originY),
+			},
+		}
+		w2Nodes.append(w2ItemNode)
+	}
+}
+
 func (p *PdfData) appendFontDescriptor(
 	ssf *subsetFont,
 	fontRef FontRef,
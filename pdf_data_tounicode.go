@@ -3,7 +3,9 @@ package nxpdf
 import (
 	"bytes"
 	"fmt"
+	"sort"
 	"strconv"
+	"unicode/utf16"
 )
 
 func (p *PdfData) appendToUnicode(
@@ -22,20 +24,54 @@ func (p *PdfData) appendToUnicode(
 			"/CMapName /Adobe-Identity-UCS def /CMapType 2 def\n"
 	suffix := "endcmap CMapName currentdict /CMap defineresource pop end end"
 
-	characterToGlyphIndex := ssf.glyphIndexs
+	//text of glyph from cmap, then from shaping (ex. ligature that is not in cmap),
+	//glyph of many characters map to the smallest one and notdef (glyph 0) has no text
+	var runes []rune
+	for k := range ssf.glyphIndexs {
+		runes = append(runes, k)
+	}
+	sort.Slice(runes, func(i, j int) bool { return runes[i] < runes[j] })
+	glyphIndexToText := make(map[uint][]rune)
+	for _, r := range runes {
+		v := ssf.glyphIndexs[r]
+		if _, ok := glyphIndexToText[v]; !ok && v != 0 {
+			glyphIndexToText[v] = []rune{r}
+		}
+	}
+	for k, v := range ssf.shapedGlyphs {
+		if _, ok := glyphIndexToText[k]; !ok && k != 0 && len(v) > 0 {
+			glyphIndexToText[k] = v
+		}
+	}
+
+	var glyphIndexs []uint
+	for k := range glyphIndexToText {
+		glyphIndexs = append(glyphIndexs, k)
+	}
+	sort.Slice(glyphIndexs, func(i, j int) bool { return glyphIndexs[i] < glyphIndexs[j] })
 
-	glyphIndexToCharacter := make(map[int]rune)
 	lowIndex := 65536
 	hiIndex := -1
-	for k, v := range characterToGlyphIndex {
-		index := int(v)
+	var bfranges, bfchars []string
+	for _, k := range glyphIndexs {
+		index := int(k)
 		if index < lowIndex {
 			lowIndex = index
 		}
 		if index > hiIndex {
 			hiIndex = index
 		}
-		glyphIndexToCharacter[index] = k
+		codes := utf16.Encode(glyphIndexToText[k])
+		if len(codes) == 1 {
+			bfranges = append(bfranges, fmt.Sprintf("<%04X><%04X><%04X>\n", index, index, codes[0]))
+			continue
+		}
+		//one glyph to many characters (or character that is not in BMP)
+		var dst bytes.Buffer
+		for _, code := range codes {
+			dst.WriteString(fmt.Sprintf("%04X", code))
+		}
+		bfchars = append(bfchars, fmt.Sprintf("<%04X><%s>\n", index, dst.String()))
 	}
 
 	var buff bytes.Buffer
@@ -43,11 +79,8 @@ func (p *PdfData) appendToUnicode(
 	buff.WriteString("1 begincodespacerange\n")
 	buff.WriteString(fmt.Sprintf("<%04X><%04X>\n", lowIndex, hiIndex))
 	buff.WriteString("endcodespacerange\n")
-	buff.WriteString(fmt.Sprintf("%d beginbfrange\n", len(glyphIndexToCharacter)))
-	for k, v := range glyphIndexToCharacter {
-		buff.WriteString(fmt.Sprintf("<%04X><%04X><%04X>\n", k, k, v))
-	}
-	buff.WriteString("endbfrange\n")
+	writeBfEntries(&buff, "bfrange", bfranges)
+	writeBfEntries(&buff, "bfchar", bfchars)
 	buff.WriteString(suffix)
 	buff.WriteString("\n")
 
@@ -80,3 +113,19 @@ func (p *PdfData) appendToUnicode(
 
 	return maxRealID, maxFakeID, nil
 }
+
+//writeBfEntries write entries of bfrange or bfchar, not more than 100 entries in each block
+func writeBfEntries(buff *bytes.Buffer, name string, entries []string) {
+	for len(entries) > 0 {
+		size := len(entries)
+		if size > 100 {
+			size = 100
+		}
+		buff.WriteString(fmt.Sprintf("%d begin%s\n", size, name))
+		for _, entry := range entries[:size] {
+			buff.WriteString(entry)
+		}
+		buff.WriteString(fmt.Sprintf("end%s\n", name))
+		entries = entries[size:]
+	}
+}
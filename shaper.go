@@ -0,0 +1,311 @@
+package nxpdf
+
+import (
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/oneplus1000/nxpdf/font"
+	"github.com/pkg/errors"
+)
+
+//gsubFeatures features of GSUB that always apply
+var gsubFeatures = []string{"ccmp", "locl", "rlig"}
+
+//gposFeatures features of GPOS that always apply
+var gposFeatures = []string{"mark", "mkmk"}
+
+//shapedGlyph glyph after shaping, xAdvance, xOffset and yOffset are in 1/1000 of text space unit
+//(xAdvance is advance height in vertical writing)
+type shapedGlyph struct {
+	glyph    uint
+	runes    []rune //source text of glyph
+	isMark   bool   //mark glyph (in GDEF) that has no character spacing
+	xAdvance int
+	xOffset  int
+	yOffset  int
+}
+
+//textFont font and its subset font
+type textFont struct {
+	fontRef FontRef
+	ssf     *subsetFont
+}
+
+//textRun text that use same font and has same bidi level
+type textRun struct {
+	textFont
+	text   string
+	level  int           //bidi embedding level, glyphs of odd level (right-to-left) are in visual order
+	glyphs []shapedGlyph //result of shapeRun()
+}
+
+//shape split text (a line of paragraph that direction is rtl) into runs by bidi level and font,
+//and convert each run to glyphs, runs are in logical order (see reorderRuns),
+//forms is joining form of each rune of text that found from whole paragraph (see arabicJoiningForms)
+func (c *contenteCacheText) shape(text string, rtl bool, forms []string) ([]textRun, error) {
+	var runs []textRun
+	offset := 0 //index of first rune of bidi run in text
+	for _, bidiRun := range splitBidiRuns(text, rtl) {
+		size := utf8.RuneCountInString(bidiRun.text)
+		fontRuns, err := c.shapeBidiRun(bidiRun.text, bidiRun.level, forms[offset:offset+size])
+		if err != nil {
+			return nil, errors.Wrap(err, "")
+		}
+		runs = append(runs, fontRuns...)
+		offset += size
+	}
+	return runs, nil
+}
+
+//shapeBidiRun split text that has same embedding level into runs by font and convert each run to glyphs
+func (c *contenteCacheText) shapeBidiRun(text string, level int, forms []string) ([]textRun, error) {
+	var runs []textRun
+	offset := 0 //index of first rune of run in text
+	for _, run := range c.splitRuns(text) {
+		run.level = level
+		size := utf8.RuneCountInString(run.text)
+		glyphs, err := c.shapeRun(run.ssf, run.text, level%2 == 1, forms[offset:offset+size])
+		if err != nil {
+			return nil, errors.Wrapf(err, "c.shapeRun(%s) fail", run.text)
+		}
+		run.glyphs = glyphs
+		runs = append(runs, run)
+		offset += size
+	}
+	return runs, nil
+}
+
+func (c *contenteCacheText) splitRuns(text string) []textRun {
+	var runs []textRun
+	var curr textFont
+	start := 0
+	for i, r := range text {
+		f := c.fontOfRune(r, curr, i > 0)
+		if i > 0 && f.fontRef != curr.fontRef {
+			runs = append(runs, textRun{textFont: curr, text: text[start:i]})
+			start = i
+		}
+		curr = f
+	}
+	if start < len(text) {
+		runs = append(runs, textRun{textFont: curr, text: text[start:]})
+	}
+	return runs
+}
+
+//fontOfRune find font for r, marks and spaces use font of previous rune if it has glyph
+func (c *contenteCacheText) fontOfRune(r rune, prev textFont, hasPrev bool) textFont {
+	if hasPrev && (unicode.Is(unicode.Mn, r) || unicode.IsSpace(r)) && prev.ssf.hasGlyph(r) {
+		return prev
+	}
+	if c.ssf.hasGlyph(r) {
+		return textFont{fontRef: c.fontRef, ssf: c.ssf}
+	}
+	for _, fallback := range c.fallbacks {
+		if fallback.ssf.hasGlyph(r) {
+			return fallback
+		}
+	}
+	return textFont{fontRef: c.fontRef, ssf: c.ssf}
+}
+
+//shapeRun convert text to glyphs by GSUB and GPOS of font (and kern table),
+//glyphs of right-to-left text are reversed to visual order, forms is joining form of each rune of text
+func (c *contenteCacheText) shapeRun(ssf *subsetFont, text string, rtl bool, forms []string) ([]shapedGlyph, error) {
+
+	runes := []rune(text)
+	script := shapeScript(runes)
+	ttfp := &ssf.ttfp
+
+	glyphRunes := runes
+	if rtl {
+		glyphRunes = make([]rune, len(runes))
+		for i, r := range runes {
+			glyphRunes[i] = mirrorRune(r)
+		}
+	}
+	glyphs := mapGlyphs(ssf, glyphRunes, script)
+
+	if script == "arab" {
+		glyphs = applyJoiningForms(ttfp, forms, glyphs, script)
+	}
+
+	features := gsubFeatures
+	if c.option.Ligature {
+		features = append([]string{"liga"}, gsubFeatures...)
+	}
+	if ssf.vertical {
+		features = append([]string{"vert"}, features...)
+	}
+	glyphs = ttfp.ApplyGSUB(glyphs, script, "", features)
+
+	numberOfHMetrics := ttfp.NumberOfHMetrics()
+	widths := ttfp.Widths()
+	for i := range glyphs {
+		glyphIndex := glyphs[i].Glyph
+		if ssf.vertical {
+			glyphs[i].XAdvance = int(ttfp.AdvanceHeight(glyphIndex))
+			continue
+		}
+		if glyphIndex >= numberOfHMetrics {
+			glyphIndex = numberOfHMetrics - 1
+		}
+		glyphs[i].XAdvance = int(widths[glyphIndex])
+	}
+
+	if ssf.vertical {
+		//GPOS and kerning are for horizontal writing
+		return c.shapedGlyphs(ssf, runes, glyphs), nil
+	}
+
+	glyphs = ttfp.ApplyGPOS(glyphs, script, "", gposFeatures)
+
+	unitsPerEm := int(ttfp.UnitsPerEm())
+	results := c.shapedGlyphs(ssf, runes, glyphs)
+
+	//kerning between base glyphs, x advance of left glyph is added to advance of glyph before right glyph (so marks of left glyph are not moved),
+	//in right-to-left text, to advance of last glyph of right glyph and its marks,
+	//x advance of right glyph is added to advance of last glyph of right glyph and its marks,
+	//x placement of each glyph is added to offset of glyph and its marks
+	left := -1
+	for i, glyph := range glyphs {
+		if results[i].isMark {
+			continue
+		}
+		if left >= 0 {
+			leftRune := runes[glyphs[left].Cluster]
+			rightRune := runes[glyph.Cluster]
+			pairval := c.kerning(ssf, script, leftRune, rightRune, glyphs[left].Glyph, glyph.Glyph)
+			last := i
+			for last+1 < len(results) && results[last+1].isMark {
+				last++
+			}
+			if rtl {
+				results[last].xAdvance += convertTTFUnit2PDFUnit(pairval.First.XAdvance, unitsPerEm)
+			} else {
+				results[i-1].xAdvance += convertTTFUnit2PDFUnit(pairval.First.XAdvance, unitsPerEm)
+			}
+			results[last].xAdvance += convertTTFUnit2PDFUnit(pairval.Second.XAdvance, unitsPerEm)
+			for k := left; k < i; k++ {
+				results[k].xOffset += convertTTFUnit2PDFUnit(pairval.First.XPlacement, unitsPerEm)
+			}
+			for k := i; k <= last; k++ {
+				results[k].xOffset += convertTTFUnit2PDFUnit(pairval.Second.XPlacement, unitsPerEm)
+			}
+		}
+		left = i
+	}
+
+	if rtl {
+		results = reverseClusters(results)
+	}
+	return results, nil
+}
+
+//applyJoiningForms substitute glyph of arabic letter by its joining form (isol, init, medi or fina feature of GSUB),
+//forms is joining form of each rune that glyphs come from
+func applyJoiningForms(ttfp *font.TTFParser, forms []string, glyphs []font.GlyphInfo, script string) []font.GlyphInfo {
+	for i, glyph := range glyphs {
+		form := forms[glyph.Cluster]
+		if form == "" {
+			continue
+		}
+		substituted := ttfp.ApplyGSUB([]font.GlyphInfo{glyph}, script, "", []string{form})
+		if len(substituted) == 1 {
+			glyphs[i] = substituted[0]
+		}
+	}
+	return glyphs
+}
+
+//reverseClusters reverse order of base glyphs (a base glyph and its marks are moved together, marks are still after base glyph)
+func reverseClusters(glyphs []shapedGlyph) []shapedGlyph {
+	results := make([]shapedGlyph, 0, len(glyphs))
+	end := len(glyphs)
+	for end > 0 {
+		start := end - 1
+		for start > 0 && glyphs[start].isMark {
+			start--
+		}
+		results = append(results, glyphs[start:end]...)
+		end = start
+	}
+	return results
+}
+
+//shapedGlyphs convert glyphs (in font unit) to shapedGlyphs and add word spacing
+func (c *contenteCacheText) shapedGlyphs(ssf *subsetFont, runes []rune, glyphs []font.GlyphInfo) []shapedGlyph {
+	unitsPerEm := int(ssf.ttfp.UnitsPerEm())
+	results := make([]shapedGlyph, len(glyphs))
+	for i, glyph := range glyphs {
+		results[i] = shapedGlyph{
+			glyph:    glyph.Glyph,
+			runes:    clusterRunes(runes, glyphs, i),
+			xAdvance: convertTTFUnit2PDFUnit(glyph.XAdvance, unitsPerEm),
+			xOffset:  convertTTFUnit2PDFUnit(glyph.XOffset, unitsPerEm),
+			yOffset:  convertTTFUnit2PDFUnit(glyph.YOffset, unitsPerEm),
+			isMark:   isMarkGlyph(ssf, glyph.Glyph),
+		}
+		//word spacing (Tw does not work with 2 bytes character code of Identity-H)
+		if len(results[i].runes) == 1 && results[i].runes[0] == ' ' {
+			results[i].xAdvance += c.wordSpacing()
+		}
+	}
+	return results
+}
+
+//mapGlyphs map runes to glyphs, cluster of glyph is index of rune
+func mapGlyphs(ssf *subsetFont, runes []rune, script string) []font.GlyphInfo {
+
+	if script == "thai" {
+		return mapThaiGlyphs(ssf, runes)
+	}
+
+	var glyphs []font.GlyphInfo
+	for i, r := range runes {
+		glyphs = append(glyphs, font.GlyphInfo{Glyph: ssf.findGlyphIndex(r), Cluster: i})
+	}
+
+	return glyphs
+}
+
+func isMarkGlyph(ssf *subsetFont, glyph uint) bool {
+	gdef := ssf.ttfp.GDEF()
+	return gdef != nil && gdef.GlyphClassDef.Class(glyph) == font.GlyphClassMark
+}
+
+//clusterRunes source runes of glyphs[i], from its cluster to next cluster
+//(only first glyph of cluster has source runes)
+func clusterRunes(runes []rune, glyphs []font.GlyphInfo, i int) []rune {
+	start := glyphs[i].Cluster
+	for _, glyph := range glyphs[:i] {
+		if glyph.Cluster == start {
+			return nil
+		}
+	}
+	end := len(runes)
+	for _, glyph := range glyphs {
+		if glyph.Cluster > start && glyph.Cluster < end {
+			end = glyph.Cluster
+		}
+	}
+	return runes[start:end]
+}
+
+//shapeScript script tag of text
+func shapeScript(runes []rune) string {
+	for _, r := range runes {
+		if isThai(r) {
+			return "thai"
+		} else if unicode.Is(unicode.Arabic, r) {
+			return "arab"
+		} else if unicode.Is(unicode.Hebrew, r) {
+			return "hebr"
+		} else if unicode.In(r, unicode.Hiragana, unicode.Katakana) {
+			return "kana"
+		} else if unicode.Is(unicode.Han, r) {
+			return "hani"
+		}
+	}
+	return "latn"
+}
@@ -0,0 +1,37 @@
+package nxpdf
+
+import "github.com/oneplus1000/nxpdf/font"
+
+//mapThaiGlyphs map runes of thai text to glyphs (cluster of glyph is index of rune),
+//sara am is decomposed to nikhahit and sara aa, and nikhahit is moved before above marks
+//(so GSUB and GPOS of font can position them like other above marks)
+func mapThaiGlyphs(ssf *subsetFont, runes []rune) []font.GlyphInfo {
+
+	canDecompose := ssf.hasGlyph(0x0E4D) && ssf.hasGlyph(0x0E32)
+
+	var glyphs []font.GlyphInfo
+	for i, r := range runes {
+
+		if r == 0x0E33 && canDecompose {
+			nikhahit := ssf.charCodeToGlyphIndex(0x0E4D)
+			saraAa := ssf.charCodeToGlyphIndex(0x0E32)
+			j := len(glyphs)
+			for j > 0 && isThaiAboveMark(runes[glyphs[j-1].Cluster]) {
+				j--
+			}
+			glyphs = append(glyphs[:j], append([]font.GlyphInfo{{Glyph: nikhahit, Cluster: i}}, glyphs[j:]...)...)
+			glyphs = append(glyphs, font.GlyphInfo{Glyph: saraAa, Cluster: i})
+			continue
+		}
+
+		glyph := ssf.findGlyphIndex(r)
+		glyphs = append(glyphs, font.GlyphInfo{Glyph: glyph, Cluster: i})
+	}
+
+	return glyphs
+}
+
+//isThaiAboveMark mai han-akat, above vowels, tone marks and other above marks
+func isThaiAboveMark(r rune) bool {
+	return r == 0x0E31 || (r >= 0x0E34 && r <= 0x0E37) || (r >= 0x0E47 && r <= 0x0E4E)
+}
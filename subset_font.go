@@ -1,6 +1,8 @@
 package nxpdf
 
 import (
+	"sort"
+
 	"github.com/oneplus1000/nxpdf/font"
 	"github.com/pkg/errors"
 )
@@ -8,18 +10,25 @@ import (
 type subsetFont struct {
 	fontfileRaw []byte
 	glyphIndexs map[rune]uint
-	ttfp        font.TTFParser
+	//glyphs from shaping (ex. ligature, glyph that not in cmap), map[glyph index]source text
+	shapedGlyphs map[uint][]rune
+	ttfp         font.TTFParser
+	vertical     bool //vertical writing (Identity-V)
+	//funcKernOverride adjust kerning value from font (nil mean use value from font)
+	funcKernOverride FuncKernOverride
 }
 
 func newSubsetFont(fontfile []byte) *subsetFont {
 	var s subsetFont
 	s.glyphIndexs = make(map[rune]uint)
+	s.shapedGlyphs = make(map[uint][]rune)
 	s.fontfileRaw = fontfile
 	return &s
 }
 
 func (s *subsetFont) init() error {
 	s.ttfp.SetUseKerning(true)
+	s.ttfp.SetUseOpenTypeLayout(true)
 	err := s.ttfp.ParseByBytes(s.fontfileRaw)
 	if err != nil {
 		return errors.Wrap(err, "")
@@ -27,20 +36,48 @@ func (s *subsetFont) init() error {
 	return nil
 }
 
-func (s *subsetFont) addChars(text string) error {
+func (s *subsetFont) addChars(text string) {
 
 	for _, r := range text {
 		if _, ok := s.glyphIndexs[r]; ok {
 			continue
 		}
-		glyphIndex, err := s.charCodeToGlyphIndex(r)
-		if err != nil {
-			return errors.Wrap(err, "")
+		s.glyphIndexs[r] = s.charCodeToGlyphIndex(r)
+	}
+}
+
+//addShapedGlyphs add glyphs from shaping to subset font
+func (s *subsetFont) addShapedGlyphs(glyphs []shapedGlyph) {
+	for _, glyph := range glyphs {
+		if runes, ok := s.shapedGlyphs[glyph.glyph]; !ok || len(runes) == 0 {
+			s.shapedGlyphs[glyph.glyph] = glyph.runes
 		}
-		s.glyphIndexs[r] = glyphIndex
 	}
+}
 
-	return nil
+//glyphs all glyph indexs in subset font (sorted)
+func (s *subsetFont) glyphs() []uint {
+	found := make(map[uint]bool)
+	var glyphs []uint
+	for _, glyphIndex := range s.glyphIndexs {
+		if !found[glyphIndex] {
+			found[glyphIndex] = true
+			glyphs = append(glyphs, glyphIndex)
+		}
+	}
+	for glyphIndex := range s.shapedGlyphs {
+		if !found[glyphIndex] {
+			found[glyphIndex] = true
+			glyphs = append(glyphs, glyphIndex)
+		}
+	}
+	sort.Slice(glyphs, func(i, j int) bool { return glyphs[i] < glyphs[j] })
+	return glyphs
+}
+
+//hasGlyph font has glyph of r
+func (s *subsetFont) hasGlyph(r rune) bool {
+	return s.charCodeToGlyphIndex(r) != 0
 }
 
 func (s *subsetFont) getGlyphIndex(r rune) (uint, error) {
@@ -52,42 +89,45 @@ func (s *subsetFont) getGlyphIndex(r rune) (uint, error) {
 	return 0, ErrRuneNotFound
 }
 
-//charCodeToGlyphIndex get glyph index from char code
-func (s *subsetFont) charCodeToGlyphIndex(r rune) (uint, error) {
+//findGlyphIndex get glyph index of r, from cmap if r was not added (subset font is not changed)
+func (s *subsetFont) findGlyphIndex(r rune) uint {
 
-	value := uint64(r)
-	if value <= 0xFFFF {
-		index, err := s.charCodeToGlyphIndexFormat4(r)
-		if err != nil {
-			return 0, errors.Wrap(err, "")
-		}
-		return index, nil
+	if idx, ok := s.glyphIndexs[r]; ok {
+		return idx
 	}
 
-	index, err := s.charCodeToGlyphIndexFormat12(r)
-	if err != nil {
-		return 0, errors.Wrap(err, "")
+	return s.charCodeToGlyphIndex(r)
+}
+
+//charCodeToGlyphIndex get glyph index from char code, cmap format 12 is used if font has it (it has all characters
+//of format 4), rune that is not in cmap is notdef (zero) in both formats
+func (s *subsetFont) charCodeToGlyphIndex(r rune) uint {
+
+	if len(s.ttfp.GroupingTables()) > 0 {
+		return s.charCodeToGlyphIndexFormat12(r)
 	}
 
-	return index, nil
+	if uint64(r) > 0xFFFF {
+		return 0
+	}
 
+	return s.charCodeToGlyphIndexFormat4(r)
 }
 
-func (s *subsetFont) charCodeToGlyphIndexFormat12(r rune) (uint, error) {
+func (s *subsetFont) charCodeToGlyphIndexFormat12(r rune) uint {
 
 	value := uint(r)
 	gTbs := s.ttfp.GroupingTables()
 	for _, gTb := range gTbs {
-		if value >= gTb.StartCharCode && value < gTb.EndCharCode {
-			index := (value - gTb.StartCharCode) + gTb.GlyphID
-			return index, nil
+		if value >= gTb.StartCharCode && value <= gTb.EndCharCode {
+			return (value - gTb.StartCharCode) + gTb.GlyphID
 		}
 	}
 
-	return 0, ErrGlyphNotFound
+	return 0
 }
 
-func (s *subsetFont) charCodeToGlyphIndexFormat4(r rune) (uint, error) {
+func (s *subsetFont) charCodeToGlyphIndexFormat4(r rune) uint {
 	value := uint(r)
 	seg := uint(0)
 	segCount := s.ttfp.SegCount
@@ -98,21 +138,49 @@ func (s *subsetFont) charCodeToGlyphIndexFormat4(r rune) (uint, error) {
 		seg++
 	}
 
+	if seg >= segCount {
+		return 0
+	}
+
 	if value < s.ttfp.StartCount[seg] {
-		return 0, nil
+		return 0
 	}
 
 	if s.ttfp.IdRangeOffset[seg] == 0 {
 
-		return (value + s.ttfp.IdDelta[seg]) & 0xFFFF, nil
+		return (value + s.ttfp.IdDelta[seg]) & 0xFFFF
 	}
 	idx := s.ttfp.IdRangeOffset[seg]/2 + (value - s.ttfp.StartCount[seg]) - (segCount - seg)
 
 	if s.ttfp.GlyphIdArray[int(idx)] == uint(0) {
-		return 0, nil
+		return 0
+	}
+
+	return (s.ttfp.GlyphIdArray[int(idx)] + s.ttfp.IdDelta[seg]) & 0xFFFF
+}
+
+//isInCmap r is in cmap of font (glyph of r may be notdef), cmap is chosen same as charCodeToGlyphIndex
+func (s *subsetFont) isInCmap(r rune) bool {
+
+	value := uint(r)
+	if gTbs := s.ttfp.GroupingTables(); len(gTbs) > 0 {
+		for _, gTb := range gTbs {
+			if value >= gTb.StartCharCode && value <= gTb.EndCharCode {
+				return true
+			}
+		}
+		return false
 	}
 
-	return (s.ttfp.GlyphIdArray[int(idx)] + s.ttfp.IdDelta[seg]) & 0xFFFF, nil
+	if value > 0xFFFF {
+		return false
+	}
+	for seg := uint(0); seg < s.ttfp.SegCount; seg++ {
+		if value <= s.ttfp.EndCount[seg] {
+			return value >= s.ttfp.StartCount[seg]
+		}
+	}
+	return false
 }
 
 //GlyphIndexToPdfWidth get with from glyphIndex
@@ -130,6 +198,19 @@ func (s *subsetFont) glyphIndexToPdfWidth(glyphIndex uint) uint {
 	return width * 1000 / unitsPerEm
 }
 
+//glyphIndexToPdfHeight advance height of glyph in 1/1000 of text space unit
+func (s *subsetFont) glyphIndexToPdfHeight(glyphIndex uint) uint {
+	return s.ttfp.AdvanceHeight(glyphIndex) * 1000 / s.ttfp.UnitsPerEm()
+}
+
+//glyphIndexToPdfAdvance advance of glyph in writing direction in 1/1000 of text space unit
+func (s *subsetFont) glyphIndexToPdfAdvance(glyphIndex uint) uint {
+	if s.vertical {
+		return s.glyphIndexToPdfHeight(glyphIndex)
+	}
+	return s.glyphIndexToPdfWidth(glyphIndex)
+}
+
 //KernValueByLeft find kern value from kern table by left
 func (s *subsetFont) kernValueByLeft(left uint) (bool, *font.KernValue) {
 
@@ -144,3 +225,18 @@ func (s *subsetFont) kernValueByLeft(left uint) (bool, *font.KernValue) {
 
 	return false, nil
 }
+
+//gposKerning find values of pair of glyph in script from GPOS table
+func (s *subsetFont) gposKerning(left uint, right uint, script string) (bool, font.PairValue) {
+
+	gpos := s.ttfp.GPOS()
+	if gpos == nil {
+		return false, font.PairValue{}
+	}
+
+	if v, ok := gpos.Kerning(left, right, script); ok {
+		return true, v
+	}
+
+	return false, font.PairValue{}
+}
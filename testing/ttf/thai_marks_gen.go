@@ -0,0 +1,374 @@
+//go:build ignore
+// +build ignore
+
+//generate thai_marks.ttf (go run thai_marks_gen.go), a small font for testing thai shaping,
+//glyphs are rectangles made by this program so the font is free to use like the rest of nxpdf.
+//Marks have zero advance and are attached by GPOS mark (to base) and mkmk (to nikhahit and sara ii),
+//vertical origin of all glyphs is at y 880 (vhea and vmtx).
+package main
+
+import (
+	"encoding/binary"
+	"io/ioutil"
+	"log"
+	"sort"
+)
+
+//glyph glyph of font, box is xMin, yMin, xMax, yMax of outline (no outline if box is zero)
+type glyph struct {
+	char    rune
+	advance int
+	class   int //class in GDEF (1 base, 3 mark)
+	box     [4]int
+}
+
+var glyphs = []glyph{
+	{0, 500, 0, [4]int{50, 0, 450, 700}},        //0 .notdef
+	{0x0020, 250, 1, [4]int{}},                  //1 space
+	{0x0E19, 600, 1, [4]int{50, 0, 550, 450}},   //2 no nu
+	{0x0E17, 620, 1, [4]int{50, 0, 570, 450}},   //3 tho thahan
+	{0x0E49, 0, 3, [4]int{-170, 650, -70, 750}}, //4 mai tho
+	{0x0E48, 0, 3, [4]int{-140, 650, -80, 750}}, //5 mai ek
+	{0x0E33, 400, 1, [4]int{-150, 0, 350, 750}}, //6 sara am
+	{0x0E4D, 0, 3, [4]int{-140, 650, -60, 730}}, //7 nikhahit
+	{0x0E32, 400, 1, [4]int{50, 0, 350, 450}},   //8 sara aa
+	{0x0E35, 0, 3, [4]int{-500, 550, -50, 700}}, //9 sara ii
+}
+
+//markAnchors anchor of marks (class 0) in mark lookup, baseAnchors anchor of bases
+var markAnchors = map[int][2]int{4: {-120, 700}, 5: {-110, 700}, 7: {-100, 700}, 9: {-130, 700}}
+var baseAnchors = map[int][2]int{2: {450, 700}, 3: {470, 700}}
+
+//advanceHeights advance height of glyphs that is not 1000
+var advanceHeights = map[int]int{2: 900}
+
+//mark1Anchors anchor of tone marks in mkmk lookup, mark2Anchors anchor of marks that tone marks are attached to
+var mark1Anchors = map[int][2]int{4: {-120, 700}, 5: {-110, 700}}
+var mark2Anchors = map[int][2]int{7: {-90, 850}, 9: {-150, 900}}
+
+func main() {
+	tables := map[string][]byte{
+		"head": head(),
+		"hhea": hhea(),
+		"maxp": maxp(),
+		"hmtx": hmtx(),
+		"cmap": cmap(),
+		"name": name("NxThaiMarks"),
+		"OS/2": os2(),
+		"post": post(),
+		"vhea": vhea(),
+		"vmtx": vmtx(),
+		"GDEF": gdef(),
+		"GPOS": gpos(),
+	}
+	tables["glyf"], tables["loca"] = glyfAndLoca()
+
+	err := ioutil.WriteFile("thai_marks.ttf", fontFile(tables), 0644)
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+//fontFile table directory and tables (in order of tag), checkSumAdjustment of head is set
+func fontFile(tables map[string][]byte) []byte {
+	var tags []string
+	for tag := range tables {
+		tags = append(tags, tag)
+	}
+	sort.Strings(tags)
+
+	entrySelector := 0
+	for 1<<uint(entrySelector+1) <= len(tags) {
+		entrySelector++
+	}
+	searchRange := (1 << uint(entrySelector)) * 16
+	header := concat(u32(0x00010000), u16(len(tags), searchRange, entrySelector, len(tags)*16-searchRange))
+
+	var directory, data []byte
+	offset := len(header) + 16*len(tags)
+	headOffset := 0
+	for _, tag := range tags {
+		table := tables[tag]
+		if tag == "head" {
+			headOffset = offset + len(data)
+		}
+		directory = append(directory, tag...)
+		directory = append(directory, concat(u32(int(checkSum(table))), u32(offset+len(data)), u32(len(table)))...)
+		data = append(data, table...)
+		for len(data)%4 != 0 {
+			data = append(data, 0)
+		}
+	}
+
+	file := concat(header, directory, data)
+	binary.BigEndian.PutUint32(file[headOffset+8:], 0xB1B0AFBA-checkSum(file))
+	return file
+}
+
+func checkSum(data []byte) uint32 {
+	sum := uint32(0)
+	for i := 0; i < len(data); i += 4 {
+		var b [4]byte
+		copy(b[:], data[i:])
+		sum += binary.BigEndian.Uint32(b[:])
+	}
+	return sum
+}
+
+func head() []byte {
+	return concat(
+		u32(0x00010000, 0x00010000, 0, 0x5F0F3CF5), //version, fontRevision, checkSumAdjustment, magicNumber
+		u16(0x000B, 1000),                          //flags, unitsPerEm
+		u32(0, 0, 0, 0),                            //created, modified
+		u16(-500, 0, 570, 750),                     //xMin, yMin, xMax, yMax
+		u16(0, 8, 2, 0, 0),                         //macStyle, lowestRecPPEM, fontDirectionHint, indexToLocFormat, glyphDataFormat
+	)
+}
+
+func hhea() []byte {
+	return concat(
+		u32(0x00010000),
+		u16(800, -200, 0, 620, -500, 0, 570), //ascender, descender, lineGap, advanceWidthMax, minLeftSideBearing, minRightSideBearing, xMaxExtent
+		u16(1, 0, 0, 0, 0, 0, 0, 0),          //caretSlopeRise, caretSlopeRun, caretOffset, reserved, metricDataFormat
+		u16(len(glyphs)),                     //numberOfHMetrics
+	)
+}
+
+func maxp() []byte {
+	return concat(
+		u32(0x00010000),
+		u16(len(glyphs), 4, 1, 0, 0, 2, 0, 0, 0, 0, 0, 0, 0, 0),
+	)
+}
+
+func hmtx() []byte {
+	var data []byte
+	for _, g := range glyphs {
+		data = append(data, u16(g.advance, g.box[0])...)
+	}
+	return data
+}
+
+//cmap format 4 subtable of platform 3 encoding 1, a segment for each char
+func cmap() []byte {
+	type segment struct{ char, glyph int }
+	var segments []segment
+	for i, g := range glyphs {
+		if g.char != 0 {
+			segments = append(segments, segment{int(g.char), i})
+		}
+	}
+	sort.Slice(segments, func(i, j int) bool { return segments[i].char < segments[j].char })
+	segments = append(segments, segment{0xFFFF, 1})
+
+	segCount := len(segments)
+	entrySelector := 0
+	for 1<<uint(entrySelector+1) <= segCount {
+		entrySelector++
+	}
+	searchRange := (1 << uint(entrySelector)) * 2
+
+	var ends, starts, deltas, rangeOffsets []int
+	for _, s := range segments {
+		ends = append(ends, s.char)
+		starts = append(starts, s.char)
+		deltas = append(deltas, s.glyph-s.char)
+		rangeOffsets = append(rangeOffsets, 0)
+	}
+	subtable := concat(u16(ends...), u16(0), u16(starts...), u16(deltas...), u16(rangeOffsets...))
+	subtable = concat(u16(4, 14+len(subtable), 0, segCount*2, searchRange, entrySelector, segCount*2-searchRange), subtable)
+	return concat(u16(0, 1, 3, 1), u32(12), subtable)
+}
+
+//name family name (name ID 1) and postscript name (name ID 6) in UTF-16BE
+func name(s string) []byte {
+	var str []byte
+	for _, r := range s {
+		str = append(str, u16(int(r))...)
+	}
+	records := concat(
+		u16(3, 1, 0x0409, 1, len(str), 0),
+		u16(3, 1, 0x0409, 6, len(str), 0),
+	)
+	return concat(u16(0, 2, 6+len(records)), records, str)
+}
+
+func os2() []byte {
+	return concat(
+		u16(4, 400, 400, 5, 0),                 //version, xAvgCharWidth, usWeightClass, usWidthClass, fsType
+		u16(650, 600, 0, 75, 650, 600, 0, 350), //subscript and superscript
+		u16(50, 250, 0),                        //yStrikeoutSize, yStrikeoutPosition, sFamilyClass
+		make([]byte, 10),                       //panose
+		u32(1<<24, 0, 0, 0),                    //ulUnicodeRange (thai)
+		[]byte("NXPD"),                         //achVendID
+		u16(0x40, 0x20, 0x0E4D),                //fsSelection, usFirstCharIndex, usLastCharIndex
+		u16(800, -200, 0, 900, 200),            //sTypoAscender, sTypoDescender, sTypoLineGap, usWinAscent, usWinDescent
+		u32(1<<16, 0),                          //ulCodePageRange (thai)
+		u16(450, 650, 0, 0x20, 2),              //sxHeight, sCapHeight, usDefaultChar, usBreakChar, usMaxContext
+	)
+}
+
+func vhea() []byte {
+	return concat(
+		u32(0x00011000),
+		u16(880, -120, 0, 1000, 130, 0, 1380), //vertTypoAscender, vertTypoDescender, vertTypoLineGap, advanceHeightMax, minTopSideBearing, minBottomSideBearing, yMaxExtent
+		u16(0, 1, 0, 0, 0, 0, 0, 0),           //caretSlopeRise, caretSlopeRun, caretOffset, reserved, metricDataFormat
+		u16(len(glyphs)),                      //numOfLongVerMetrics
+	)
+}
+
+func vmtx() []byte {
+	var data []byte
+	for i, g := range glyphs {
+		advanceHeight, ok := advanceHeights[i]
+		if !ok {
+			advanceHeight = 1000
+		}
+		topSideBearing := 0
+		if g.box != [4]int{} {
+			topSideBearing = 880 - g.box[3]
+		}
+		data = append(data, u16(advanceHeight, topSideBearing)...)
+	}
+	return data
+}
+
+func post() []byte {
+	return concat(u32(0x00030000, 0), u16(-100, 50), u32(0, 0, 0, 0, 0))
+}
+
+//glyfAndLoca rectangle outline of each glyph and short loca
+func glyfAndLoca() ([]byte, []byte) {
+	var glyf []byte
+	loca := u16(0)
+	for _, g := range glyphs {
+		if g.box != [4]int{} {
+			x0, y0, x1, y1 := g.box[0], g.box[1], g.box[2], g.box[3]
+			glyf = append(glyf, concat(
+				u16(1, x0, y0, x1, y1), //numberOfContours, bounding box
+				u16(3, 0),              //endPtsOfContours, instructionLength
+				[]byte{1, 1, 1, 1},     //flags (on curve)
+				u16(x0, 0, x1-x0, 0),   //x (delta)
+				u16(y0, y1-y0, 0, y0-y1),
+			)...)
+		}
+		loca = append(loca, u16(len(glyf)/2)...)
+	}
+	return glyf, loca
+}
+
+func gdef() []byte {
+	classes := []int{1, len(glyphs) - 1} //class definition format 1 start from glyph 1
+	for _, g := range glyphs[1:] {
+		classes = append(classes, g.class)
+	}
+	return concat(u16(1, 0, 12, 0, 0, 0), u16(classes...))
+}
+
+//gpos feature mark (lookup 0) and mkmk (lookup 1) of script thai
+func gpos() []byte {
+	langSys := u16(0, 0xFFFF, 2, 0, 1)
+	script := concat(u16(4, 0), langSys)
+	scriptList := taggedList([]string{"thai"}, [][]byte{script})
+	featureList := taggedList([]string{"mark", "mkmk"}, [][]byte{u16(0, 1, 0), u16(0, 1, 1)})
+	lookupList := offsetList(
+		lookup(4, markBasePos(markAnchors, baseAnchors)),
+		lookup(6, markBasePos(mark1Anchors, mark2Anchors)),
+	)
+	return concat(
+		u16(1, 0, 10, 10+len(scriptList), 10+len(scriptList)+len(featureList)),
+		scriptList, featureList, lookupList,
+	)
+}
+
+//markBasePos mark-to-base or mark-to-mark subtable format 1 that has one mark class
+func markBasePos(marks map[int][2]int, bases map[int][2]int) []byte {
+	markGlyphs := sortedGlyphs(marks)
+	baseGlyphs := sortedGlyphs(bases)
+
+	markCoverage := u16(append([]int{1, len(markGlyphs)}, markGlyphs...)...)
+	baseCoverage := u16(append([]int{1, len(baseGlyphs)}, baseGlyphs...)...)
+
+	var markRecords, markAnchorTables []byte
+	for _, g := range markGlyphs {
+		markRecords = append(markRecords, u16(0, 2+4*len(markGlyphs)+len(markAnchorTables))...)
+		markAnchorTables = append(markAnchorTables, u16(1, marks[g][0], marks[g][1])...)
+	}
+	markArray := concat(u16(len(markGlyphs)), markRecords, markAnchorTables)
+
+	var baseRecords, baseAnchorTables []byte
+	for _, g := range baseGlyphs {
+		baseRecords = append(baseRecords, u16(2+2*len(baseGlyphs)+len(baseAnchorTables))...)
+		baseAnchorTables = append(baseAnchorTables, u16(1, bases[g][0], bases[g][1])...)
+	}
+	baseArray := concat(u16(len(baseGlyphs)), baseRecords, baseAnchorTables)
+
+	offset := 12
+	return concat(
+		u16(1, offset, offset+len(markCoverage), 1,
+			offset+len(markCoverage)+len(baseCoverage),
+			offset+len(markCoverage)+len(baseCoverage)+len(markArray)),
+		markCoverage, baseCoverage, markArray, baseArray,
+	)
+}
+
+func sortedGlyphs(anchors map[int][2]int) []int {
+	var glyphs []int
+	for g := range anchors {
+		glyphs = append(glyphs, g)
+	}
+	sort.Ints(glyphs)
+	return glyphs
+}
+
+//lookup lookup table (flag 0) that has one subtable
+func lookup(lookupType int, subtable []byte) []byte {
+	return concat(u16(lookupType, 0, 1, 8), subtable)
+}
+
+//offsetList count and offsets of items then items
+func offsetList(items ...[]byte) []byte {
+	offset := 2 + 2*len(items)
+	var offsets, data []byte
+	for _, item := range items {
+		offsets = append(offsets, u16(offset+len(data))...)
+		data = append(data, item...)
+	}
+	return concat(u16(len(items)), offsets, data)
+}
+
+//taggedList count and records of tag and offset then items (script list and feature list)
+func taggedList(tags []string, items [][]byte) []byte {
+	offset := 2 + 6*len(items)
+	var records, data []byte
+	for i, item := range items {
+		records = append(records, tags[i]...)
+		records = append(records, u16(offset+len(data))...)
+		data = append(data, item...)
+	}
+	return concat(u16(len(items)), records, data)
+}
+
+func u16(values ...int) []byte {
+	data := make([]byte, 2*len(values))
+	for i, v := range values {
+		binary.BigEndian.PutUint16(data[2*i:], uint16(v))
+	}
+	return data
+}
+
+func u32(values ...int) []byte {
+	data := make([]byte, 4*len(values))
+	for i, v := range values {
+		binary.BigEndian.PutUint32(data[4*i:], uint32(v))
+	}
+	return data
+}
+
+func concat(parts ...[]byte) []byte {
+	var data []byte
+	for _, part := range parts {
+		data = append(data, part...)
+	}
+	return data
+}
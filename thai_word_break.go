@@ -0,0 +1,190 @@
+package nxpdf
+
+import (
+	"bufio"
+	"bytes"
+	"strings"
+	"sync"
+	"unicode/utf8"
+)
+
+//thaiDict dictionary for find word boundaries of thai text (thai has no spaces between words)
+type thaiDict struct {
+	words  map[string]bool
+	maxLen int //max length (in rune) of word
+}
+
+func newThaiDict(words []string) *thaiDict {
+	var d thaiDict
+	d.words = make(map[string]bool)
+	for _, word := range words {
+		word = strings.TrimSpace(word)
+		if word == "" {
+			continue
+		}
+		d.words[word] = true
+		if n := utf8.RuneCountInString(word); n > d.maxLen {
+			d.maxLen = n
+		}
+	}
+	return &d
+}
+
+//newThaiDictByBytes create thaiDict from word list (one word per line)
+func newThaiDictByBytes(data []byte) *thaiDict {
+	var words []string
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		words = append(words, scanner.Text())
+	}
+	return newThaiDict(words)
+}
+
+var defaultThaiDictOnce sync.Once
+var defaultThaiDictCache *thaiDict
+
+//defaultThaiDict thaiDict from default word list (see thai_word_break_dict.go)
+func defaultThaiDict() *thaiDict {
+	defaultThaiDictOnce.Do(func() {
+		defaultThaiDictCache = newThaiDictByBytes([]byte(defaultThaiWords))
+	})
+	return defaultThaiDictCache
+}
+
+//split split text into words at thai word boundaries,
+//text that is not thai is kept together with thai word next to it
+func (d *thaiDict) split(text string) []string {
+	var words []string
+	runes := []rune(text)
+	pending := ""
+	start := 0
+	for start < len(runes) {
+		end := start + 1
+		for end < len(runes) && isThai(runes[end]) == isThai(runes[start]) {
+			end++
+		}
+		if isThai(runes[start]) {
+			thaiWords := d.splitThai(runes[start:end])
+			thaiWords[0] = pending + thaiWords[0]
+			pending = ""
+			words = append(words, thaiWords...)
+		} else if len(words) > 0 {
+			words[len(words)-1] += string(runes[start:end])
+		} else {
+			pending = string(runes[start:end])
+		}
+		start = end
+	}
+	if pending != "" {
+		words = append(words, pending)
+	}
+	return words
+}
+
+//splitThai split thai text by maximal matching, choose the way that has least unknown characters then least words.
+//unknown characters that next to each other are kept together in one word.
+func (d *thaiDict) splitThai(runes []rune) []string {
+
+	type state struct {
+		reached bool
+		unknown int
+		words   int
+		prev    int
+		isKnown bool
+	}
+
+	size := len(runes)
+	states := make([]state, size+1)
+	states[0].reached = true
+	better := func(j int, s state) {
+		if !states[j].reached ||
+			s.unknown < states[j].unknown ||
+			(s.unknown == states[j].unknown && s.words < states[j].words) {
+			states[j] = s
+		}
+	}
+
+	for i := 0; i < size; i++ {
+		if !states[i].reached {
+			continue
+		}
+		for j := i + 1; j <= size && j-i <= d.maxLen; j++ {
+			if canBreakThai(runes, j) && d.words[string(runes[i:j])] {
+				better(j, state{
+					reached: true,
+					unknown: states[i].unknown,
+					words:   states[i].words + 1,
+					prev:    i,
+					isKnown: true,
+				})
+			}
+		}
+		j := nextThaiCluster(runes, i)
+		better(j, state{
+			reached: true,
+			unknown: states[i].unknown + (j - i),
+			words:   states[i].words + 1,
+			prev:    i,
+			isKnown: false,
+		})
+	}
+
+	//back track
+	var words []string
+	end := size
+	for end > 0 {
+		start := states[end].prev
+		if !states[end].isKnown {
+			for start > 0 && !states[start].isKnown {
+				start = states[start].prev
+			}
+		}
+		words = append([]string{string(runes[start:end])}, words...)
+		end = start
+	}
+	return words
+}
+
+//nextThaiCluster find end of thai character cluster (the smallest unit that can not be split) that start at i
+func nextThaiCluster(runes []rune, i int) int {
+	j := i + 1
+	for j < len(runes) && !canBreakThai(runes, j) {
+		j++
+	}
+	return j
+}
+
+//canBreakThai can break thai text before runes[i]
+func canBreakThai(runes []rune, i int) bool {
+	if i <= 0 || i >= len(runes) {
+		return true
+	}
+	if isThaiLeadingVowel(runes[i-1]) {
+		return false
+	}
+	return !isThaiFollowing(runes[i])
+}
+
+func isThai(r rune) bool {
+	return r >= 0x0E00 && r <= 0x0E7F
+}
+
+//isThaiLeadingVowel เ แ โ ใ ไ
+func isThaiLeadingVowel(r rune) bool {
+	return r >= 0x0E40 && r <= 0x0E44
+}
+
+//isThaiFollowing character that always follow other character: above/below vowels, tone marks, ะ า ำ ๅ ฯ ๆ
+func isThaiFollowing(r rune) bool {
+	switch {
+	case r == 0x0E2F: //ฯ
+		return true
+	case r >= 0x0E30 && r <= 0x0E3A: //ะ ั า ำ ิ ี ึ ื ุ ู ฺ
+		return true
+	case r == 0x0E45 || r == 0x0E46: //ๅ ๆ
+		return true
+	case r >= 0x0E47 && r <= 0x0E4E: //็ ่ ้ ๊ ๋ ์ ํ ๎
+		return true
+	}
+	return false
+}
@@ -0,0 +1,643 @@
+package nxpdf
+
+//defaultThaiWords default word list for thai word break (one word per line),
+//use SetThaiWords or SetThaiWordsPath for use your own word list.
+const defaultThaiWords = `
+ผม
+ฉัน
+ดิฉัน
+เรา
+พวกเรา
+คุณ
+ท่าน
+เขา
+เธอ
+มัน
+พวกเขา
+ตัวเอง
+ใคร
+อะไร
+ที่ไหน
+เมื่อไร
+เมื่อไหร่
+อย่างไร
+ทำไม
+เท่าไร
+เท่าไหร่
+ไหน
+นี้
+นั้น
+โน้น
+นี่
+นั่น
+ที่
+ซึ่ง
+อัน
+และ
+หรือ
+แต่
+กับ
+แก่
+แด่
+ของ
+ใน
+บน
+ใต้
+ล่าง
+นอก
+ระหว่าง
+ตาม
+จาก
+ถึง
+จน
+โดย
+เพื่อ
+เพราะ
+เพราะว่า
+ดังนั้น
+ถ้า
+หาก
+แม้
+แม้ว่า
+เมื่อ
+ขณะ
+ขณะที่
+ก่อน
+หลัง
+หลังจาก
+ตั้งแต่
+จนถึง
+สำหรับ
+เกี่ยวกับ
+ว่า
+ให้
+ได้
+ไม่
+ไม่ได้
+ไม่ใช่
+ใช่
+เป็น
+อยู่
+คือ
+มี
+จะ
+ต้อง
+ควร
+อาจ
+อาจจะ
+กำลัง
+แล้ว
+ยัง
+เคย
+ก็
+ค่ะ
+คะ
+ครับ
+นะ
+จ้ะ
+จ๊ะ
+เลย
+ด้วย
+อีก
+มาก
+มากมาย
+น้อย
+ทุก
+ทั้ง
+ทั้งหมด
+บาง
+หลาย
+แต่ละ
+อื่น
+อื่นๆ
+เดียว
+เดียวกัน
+เอง
+กัน
+ทำ
+ไป
+มา
+กิน
+ดื่ม
+นอน
+พูด
+บอก
+ถาม
+ตอบ
+เขียน
+อ่าน
+ฟัง
+ดู
+เห็น
+รู้
+รู้จัก
+เข้าใจ
+คิด
+ชอบ
+รัก
+อยาก
+ต้องการ
+ใช้
+ซื้อ
+ขาย
+จ่าย
+ชำระ
+รับ
+ส่ง
+เปิด
+ปิด
+เริ่ม
+จบ
+เสร็จ
+หยุด
+ออก
+เข้า
+ขึ้น
+ลง
+กลับ
+เดิน
+วิ่ง
+นั่ง
+ยืน
+เล่น
+เรียน
+สอน
+ทำงาน
+ช่วย
+หา
+พบ
+เจอ
+ลืม
+จำ
+เก็บ
+วาง
+ถือ
+เอา
+แจ้ง
+ติดต่อ
+ลงนาม
+ลงชื่อ
+ตกลง
+ยินยอม
+อนุญาต
+อนุมัติ
+ยกเลิก
+แก้ไข
+เปลี่ยนแปลง
+เพิ่ม
+ลด
+คืน
+ยืม
+เช่า
+จ้าง
+โอน
+ตรวจสอบ
+รับรอง
+ยืนยัน
+ดำเนินการ
+ปฏิบัติ
+พิจารณา
+กำหนด
+ระบุ
+เรียก
+ชื่อ
+นามสกุล
+คำนำหน้า
+นาย
+นาง
+นางสาว
+เด็กชาย
+เด็กหญิง
+บริษัท
+จำกัด
+มหาชน
+ห้างหุ้นส่วน
+สามัญ
+นิติบุคคล
+ร้าน
+สาขา
+สำนักงาน
+สำนักงานใหญ่
+ใหญ่
+เล็ก
+ที่อยู่
+เลขที่
+บ้าน
+บ้านเลขที่
+หมู่
+หมู่บ้าน
+หมู่ที่
+ซอย
+ถนน
+ตรอก
+แยก
+ตำบล
+แขวง
+อำเภอ
+เขต
+จังหวัด
+รหัส
+ไปรษณีย์
+รหัสไปรษณีย์
+ประเทศ
+ประเทศไทย
+ไทย
+กรุงเทพ
+กรุงเทพฯ
+กรุงเทพมหานคร
+มหานคร
+เชียงใหม่
+เชียงราย
+ภูเก็ต
+ขอนแก่น
+นครราชสีมา
+ชลบุรี
+นนทบุรี
+ปทุมธานี
+สมุทรปราการ
+อาคาร
+ชั้น
+ห้อง
+ตึก
+โทรศัพท์
+มือถือ
+โทรสาร
+อีเมล
+เว็บไซต์
+หมายเลข
+เลข
+เลขประจำตัว
+ประจำตัว
+ผู้เสียภาษี
+ภาษี
+ภาษีมูลค่าเพิ่ม
+มูลค่า
+บัตร
+ประชาชน
+บัตรประชาชน
+หนังสือ
+เดินทาง
+หนังสือเดินทาง
+วัน
+เดือน
+ปี
+วันที่
+เวลา
+นาที
+ชั่วโมง
+สัปดาห์
+วันนี้
+พรุ่งนี้
+เมื่อวาน
+ปัจจุบัน
+อดีต
+อนาคต
+เช้า
+สาย
+บ่าย
+เย็น
+ค่ำ
+กลางคืน
+กลางวัน
+จันทร์
+อังคาร
+พุธ
+พฤหัสบดี
+ศุกร์
+เสาร์
+อาทิตย์
+มกราคม
+กุมภาพันธ์
+มีนาคม
+เมษายน
+พฤษภาคม
+มิถุนายน
+กรกฎาคม
+สิงหาคม
+กันยายน
+ตุลาคม
+พฤศจิกายน
+ธันวาคม
+พุทธศักราช
+คริสต์ศักราช
+หนึ่ง
+สอง
+สาม
+สี่
+ห้า
+หก
+เจ็ด
+แปด
+เก้า
+สิบ
+ยี่สิบ
+เอ็ด
+ร้อย
+พัน
+หมื่น
+แสน
+ล้าน
+บาท
+สตางค์
+ถ้วน
+จำนวน
+จำนวนเงิน
+เงิน
+ราคา
+ค่า
+ค่าใช้จ่าย
+รวม
+รวมทั้งสิ้น
+ทั้งสิ้น
+ยอด
+ยอดรวม
+ส่วนลด
+คงเหลือ
+ค้างชำระ
+ดอกเบี้ย
+เงินต้น
+งวด
+ผ่อน
+ผ่อนชำระ
+ใบเสร็จ
+ใบเสร็จรับเงิน
+ใบกำกับภาษี
+ใบแจ้งหนี้
+ใบสั่งซื้อ
+ใบเสนอราคา
+สินค้า
+บริการ
+รายการ
+รายละเอียด
+หน่วย
+ชิ้น
+ราคาต่อหน่วย
+สัญญา
+ข้อ
+ข้อตกลง
+เงื่อนไข
+คู่สัญญา
+ผู้ซื้อ
+ผู้ขาย
+ผู้เช่า
+ผู้ให้เช่า
+ผู้กู้
+ผู้ให้กู้
+ผู้ค้ำประกัน
+ค้ำประกัน
+ผู้รับจ้าง
+ผู้ว่าจ้าง
+ผู้รับ
+ผู้ส่ง
+ผู้มีอำนาจ
+อำนาจ
+พยาน
+ผู้จัดการ
+กรรมการ
+ประธาน
+ตัวแทน
+ผู้รับมอบอำนาจ
+มอบอำนาจ
+ฝ่าย
+แผนก
+หน่วยงาน
+องค์กร
+รัฐ
+รัฐบาล
+กระทรวง
+กรม
+กฎหมาย
+พระราชบัญญัติ
+ประมวล
+ตามกฎหมาย
+สิทธิ
+หน้าที่
+ความรับผิดชอบ
+รับผิดชอบ
+ความเสียหาย
+เสียหาย
+ชดใช้
+ค่าเสียหาย
+ค่าปรับ
+ปรับ
+บอกเลิก
+เลิก
+สิ้นสุด
+ระยะเวลา
+เริ่มต้น
+นับ
+นับแต่
+ภายใน
+ไม่เกิน
+ไม่น้อยกว่า
+อย่างน้อย
+อย่างมาก
+ทั้งนี้
+อนึ่ง
+กล่าว
+ดังกล่าว
+ดังนี้
+ต่อไปนี้
+ต่อไป
+เรียกว่า
+ซึ่งต่อไปนี้
+ฉบับ
+ฉบับนี้
+สองฉบับ
+ข้อความ
+เอกสาร
+แบบฟอร์ม
+แบบ
+คำขอ
+คำร้อง
+เรื่อง
+สิ่งที่ส่งมาด้วย
+อ้างถึง
+ขอแสดงความนับถือ
+ความนับถือ
+ขอบคุณ
+ขอโทษ
+สวัสดี
+ยินดี
+ต้อนรับ
+ความ
+การ
+ผู้
+นัก
+ชาว
+คน
+คนไทย
+ภาษา
+ภาษาไทย
+อังกฤษ
+ภาษาอังกฤษ
+จีน
+ญี่ปุ่น
+โลก
+เมือง
+ชนบท
+ทะเล
+ภูเขา
+แม่น้ำ
+น้ำ
+ไฟ
+ลม
+ดิน
+ฟ้า
+ฝน
+อากาศ
+ร้อน
+หนาว
+อุ่น
+ดี
+เลว
+สวย
+งาม
+ใหม่
+เก่า
+สูง
+ต่ำ
+ยาว
+สั้น
+กว้าง
+แคบ
+หนัก
+เบา
+เร็ว
+ช้า
+ง่าย
+ยาก
+ถูก
+แพง
+จริง
+เท็จ
+สำคัญ
+พิเศษ
+ทั่วไป
+ต่าง
+ต่างๆ
+เหมือน
+คล้าย
+แตกต่าง
+เท่า
+เท่ากับ
+กว่า
+ที่สุด
+มากกว่า
+น้อยกว่า
+ขนาด
+สี
+ขาว
+ดำ
+แดง
+เขียว
+น้ำเงิน
+เหลือง
+อาหาร
+ข้าว
+ผลไม้
+ผัก
+เนื้อ
+ไก่
+หมู
+ปลา
+กุ้ง
+ไข่
+นม
+กาแฟ
+ชา
+ร้านอาหาร
+โรงแรม
+โรงเรียน
+มหาวิทยาลัย
+โรงพยาบาล
+ธนาคาร
+ตลาด
+สนามบิน
+สถานี
+รถ
+รถยนต์
+รถไฟ
+เรือ
+เครื่องบิน
+ทาง
+ทางด่วน
+สะพาน
+ประตู
+หน้าต่าง
+โต๊ะ
+เก้าอี้
+คอมพิวเตอร์
+โทรทัศน์
+ระบบ
+ข้อมูล
+ข่าว
+งาน
+ธุรกิจ
+การค้า
+ตลาดหลักทรัพย์
+เศรษฐกิจ
+สังคม
+การเมือง
+วัฒนธรรม
+ศาสนา
+การศึกษา
+สุขภาพ
+ครอบครัว
+พ่อ
+แม่
+ลูก
+พี่
+น้อง
+ปู่
+ย่า
+ตา
+ยาย
+สามี
+ภรรยา
+เพื่อน
+ครู
+นักเรียน
+นักศึกษา
+แพทย์
+หมอ
+พยาบาล
+ตำรวจ
+ทหาร
+พนักงาน
+ลูกค้า
+เจ้าหน้าที่
+เจ้าของ
+สมาชิก
+ประชุม
+ประกาศ
+ประกัน
+ประกันภัย
+ประกันชีวิต
+ประเภท
+ประมาณ
+ประสงค์
+ประโยชน์
+ผล
+ผลิต
+ผลิตภัณฑ์
+ปัญหา
+แก้ปัญหา
+คำถาม
+คำตอบ
+ตัวอย่าง
+หมายเหตุ
+สรุป
+ส่วน
+ส่วนที่
+หน้า
+หัวข้อ
+บท
+ตอน
+ลำดับ
+อันดับ
+ครั้ง
+ครั้งที่
+แห่ง
+ฯลฯ
+`